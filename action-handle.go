@@ -2,7 +2,6 @@ package webthing
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 )
@@ -26,7 +25,7 @@ func (h *ActionHandle) Get(w http.ResponseWriter, r *http.Request) {
 	if descriptions := h.Thing.ActionDescriptions(h.ActionName); len(descriptions) > 0 {
 		content, _ := json.Marshal(descriptions)
 		if _, err := w.Write(content); err != nil {
-			fmt.Println(err)
+			h.Thing.requestLog(r).Error("Write response failure", "error", err)
 		}
 	}
 }
@@ -45,19 +44,19 @@ func handleActionPost(th *Thing, w http.ResponseWriter, r *http.Request) {
 	var obj map[string]map[string]*json.RawMessage
 	err := json.Unmarshal(body, &obj)
 	if err != nil {
-		fmt.Println(err)
+		th.requestLog(r).Debug("Invalid action request", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	var description []json.RawMessage
 	for name, params := range obj {
-		if _, ok := th.actions[name]; ok {
+		if _, ok := th.availableActions[name]; ok {
 			input := params["input"]
-			action, err := th.PerformAction(name, input)
+			action, err := th.PerformActionContext(r.Context(), name, input)
 
 			if action == nil || err != nil {
-				fmt.Println("PerformAction failed! The action name is: ", name)
+				th.requestLog(r, "action", name).Warn("Perform action failure", "error", err)
 				w.WriteHeader(http.StatusBadRequest)
 				// w.Write([]byte(err.Error()))
 				return
@@ -92,7 +91,7 @@ func (h *ActionIDHandle) Handle(w http.ResponseWriter, r *http.Request) {
 	if h.Action == nil {
 		w.WriteHeader(http.StatusBadRequest)
 		if _, err := w.Write([]byte(`Bad request. Action not found.`)); err != nil {
-			fmt.Print(err)
+			h.ActionHandle.Thing.requestLog(r).Error("Write response failure", "error", err)
 		}
 		return
 	}
@@ -105,7 +104,7 @@ func (h *ActionIDHandle) Handle(w http.ResponseWriter, r *http.Request) {
 // @param {Object} w The response object
 func (h *ActionIDHandle) Get(w http.ResponseWriter, r *http.Request) {
 	if _, err := w.Write(h.Action.AsActionDescription()); err != nil {
-		fmt.Println(err)
+		h.ActionHandle.Thing.requestLog(r, "action", h.Action.ID()).Error("Write response failure", "error", err)
 	}
 }
 
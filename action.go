@@ -1,8 +1,15 @@
 package webthing
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Action An Action represents an individual action on a thing.
@@ -13,9 +20,15 @@ type Action struct {
 	input         *json.RawMessage
 	hrefPrefix    string
 	href          string
-	status        string
 	timeRequested string
+	cancelled     int32
+
+	// mu Guards the state changing while the action is performed.
+	mu            sync.RWMutex
+	status        string
 	timeCompleted string
+	ctx           context.Context
+	err           error
 
 	// Override this with the code necessary to perform the action.
 	PerformAction func() *Action
@@ -98,7 +111,7 @@ func (action *Action) AsActionDescription() []byte {
 
 	description, err := json.Marshal(obj)
 	if err != nil {
-		fmt.Println("Error: ", err.Error())
+		action.thing.log("action", action.id).Error("Encode action failure", "error", err)
 		return []byte(err.Error())
 	}
 
@@ -133,6 +146,8 @@ func (action *Action) Href() string {
 // Get this action's status.
 // @returns {String} The status.
 func (action *Action) Status() string {
+	action.mu.RLock()
+	defer action.mu.RUnlock()
 	return action.status
 }
 
@@ -151,6 +166,8 @@ func (action *Action) TimeRequested() string {
 // TimeCompleted Get the time the action was completed.
 // @returns {String} The time.
 func (action *Action) TimeCompleted() string {
+	action.mu.RLock()
+	defer action.mu.RUnlock()
 	return action.timeCompleted
 }
 
@@ -168,28 +185,104 @@ func (action *Action) SetInput(input *json.RawMessage) {
 	}
 }
 
+// Context Get the context carrying the span the action was requested in.
+// While the action is performed it carries the span of the action.
+func (action *Action) Context() context.Context {
+	action.mu.RLock()
+	defer action.mu.RUnlock()
+	if action.ctx == nil {
+		return context.Background()
+	}
+	return action.ctx
+}
+
+// Fail Mark the action as failed. It finishes with the status "failed"
+// once PerformAction returns.
+//
+// @param err Why the action failed
+func (action *Action) Fail(err error) {
+	action.mu.Lock()
+	defer action.mu.Unlock()
+	action.err = err
+}
+
+// failure Get why the action failed, if it did.
+func (action *Action) failure() error {
+	action.mu.RLock()
+	defer action.mu.RUnlock()
+	return action.err
+}
+
+// setStatus Change the status of the action, which is completed unless it
+// is "pending".
+func (action *Action) setStatus(status string) {
+	action.mu.Lock()
+	defer action.mu.Unlock()
+	action.status = status
+	if status != "pending" {
+		action.timeCompleted = Timestamp()
+	}
+}
+
 // Start performing the action.
 func (action *Action) Start() *Action {
-	// Todo
-	// Handle an error performing the action.
+	ctx, span := action.thing.tracer().Start(action.Context(), "PerformAction "+action.name,
+		trace.WithAttributes(
+			attribute.String("webthing.thing.id", action.thing.ID()),
+			attribute.String("webthing.action", action.name),
+			attribute.String("webthing.action.id", action.id),
+		))
+	action.mu.Lock()
+	action.ctx = ctx
+	action.mu.Unlock()
+	defer span.End()
+
+	action.thing.actionStarted(action)
+	defer action.thing.actionStopped(action)
+
 	defer func() {
 		if e := recover(); e != nil {
-			fmt.Println("Perform Action encountered an error")
+			action.thing.log("action", action.id).Error("Perform action panic", "name", action.name, "error", e)
+			span.SetStatus(codes.Error, fmt.Sprint(e))
+			action.setStatus("failed")
+			action.thing.ActionNotify(action)
 		}
 	}()
 
-	action.status = "pending"
+	action.setStatus("pending")
 	action.thing.ActionNotify(action)
-	action.PerformAction()
+	// An action cancelled before it was started, e.g. by Shutdown, is not
+	// performed.
+	if atomic.LoadInt32(&action.cancelled) == 0 {
+		action.PerformAction()
+	}
+	if err := action.failure(); err != nil {
+		action.thing.log("action", action.id).Warn("Perform action failure", "name", action.name, "error", err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 	action.Finish()
 
 	return action
 }
 
+// cancel Cancel the action, unless it was cancelled before. An action
+// still being performed finishes with the status "cancelled".
+func (action *Action) cancel() {
+	if atomic.CompareAndSwapInt32(&action.cancelled, 0, 1) && action.Cancel != nil {
+		action.Cancel()
+	}
+}
+
 // Finish performing the action.
 func (action *Action) Finish() *Action {
-	action.status = "completed"
-	action.timeCompleted = Timestamp()
+	status := "completed"
+	switch {
+	case action.failure() != nil:
+		status = "failed"
+	case atomic.LoadInt32(&action.cancelled) == 1:
+		status = "cancelled"
+	}
+	action.setStatus(status)
 	action.thing.ActionNotify(action)
 	return action
 }
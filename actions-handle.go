@@ -3,7 +3,6 @@ package webthing
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"regexp"
@@ -48,23 +47,17 @@ func (h *ActionsHandle) matchActionOrID(path string) (actionName, actionID strin
 // @param {Object} r The request object
 // @param {Object} w The response object
 func (h *ActionsHandle) Get(w http.ResponseWriter, r *http.Request) {
-	var description []json.RawMessage
-
-	for name := range h.Thing.actions {
-		if content := h.Thing.ActionDescriptions(name); content != nil {
-			description = append(description, content...)
-		}
-	}
+	description := h.Thing.ActionDescriptions("")
 	if len(description) == 0 {
 		if _, err := w.Write([]byte(`{}`)); err != nil {
-			fmt.Println(err)
+			h.Thing.requestLog(r).Error("Write response failure", "error", err)
 		}
 		return
 	}
 
 	content, _ := json.Marshal(description)
 	if _, err := w.Write(content); err != nil {
-		fmt.Println(err)
+		h.Thing.requestLog(r).Error("Write response failure", "error", err)
 	}
 }
 
@@ -78,19 +71,19 @@ func (h *ActionsHandle) Post(w http.ResponseWriter, r *http.Request) {
 	var obj map[string]map[string]*json.RawMessage
 	err := json.Unmarshal(body, &obj)
 	if err != nil {
-		fmt.Println(err)
+		h.Thing.requestLog(r).Debug("Invalid action request", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	var description []json.RawMessage
 	for name, params := range obj {
-		if _, ok := h.Thing.actions[name]; ok {
+		if _, ok := h.Thing.availableActions[name]; ok {
 			input := params["input"]
-			action, err := h.Thing.PerformAction(name, input)
+			action, err := h.Thing.PerformActionContext(r.Context(), name, input)
 
 			if action == nil || err != nil {
-				fmt.Println("PerformAction failed! The action name is: ", name)
+				h.Thing.requestLog(r, "action", name).Warn("Perform action failure", "error", err)
 				w.WriteHeader(http.StatusBadRequest)
 				// w.Write([]byte(err.Error()))
 				return
@@ -0,0 +1,197 @@
+package webthing
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Alarm A threshold alarm on a numeric property.
+//
+// The event is added when the value rises to High or falls to Low and stays
+// there for at least For. The clear event is added when the value returns
+// past the threshold by more than Hysteresis, so that a value hovering
+// around the threshold does not raise the alarm again and again.
+type Alarm struct {
+	// Property The numeric property watched.
+	Property string `json:"property"`
+
+	// High, Low The thresholds. At least one is required.
+	High *float64 `json:"high,omitempty"`
+	Low  *float64 `json:"low,omitempty"`
+
+	// Hysteresis How far the value must return past the threshold to clear
+	// the alarm.
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+
+	// For How long the threshold must be crossed to raise the alarm.
+	For Duration `json:"for,omitempty"`
+
+	// Event, Data The event added when the alarm is raised and its data, the
+	// value of the property if nil.
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data,omitempty"`
+
+	// ClearEvent, ClearData The event added when the alarm is cleared, if
+	// any, and its data, the value of the property if nil.
+	ClearEvent string          `json:"clearEvent,omitempty"`
+	ClearData  json.RawMessage `json:"clearData,omitempty"`
+}
+
+// Alarm levels.
+const (
+	alarmNormal = iota
+	alarmHigh
+	alarmLow
+)
+
+// alarmState The state of an alarm of a thing.
+type alarmState struct {
+	Alarm
+	thing *Thing
+
+	mu      sync.Mutex
+	level   int
+	pending int
+	timer   *time.Timer
+}
+
+// AddAlarm Add events raised and cleared automatically when a numeric
+// property crosses a threshold. The events must be available events of this
+// thing. The current value is checked immediately.
+//
+// @param alarm The alarm
+func (thing *Thing) AddAlarm(alarm Alarm) error {
+	if !thing.HasProperty(alarm.Property) {
+		return errors.New("Not found property: " + alarm.Property)
+	}
+	if alarm.High == nil && alarm.Low == nil {
+		return errors.New("An alarm requires a high or low threshold: " + alarm.Property)
+	}
+	if alarm.High != nil && alarm.Low != nil && *alarm.Low >= *alarm.High {
+		return errors.New("The low threshold of an alarm must be below the high threshold: " + alarm.Property)
+	}
+	for _, event := range []string{alarm.Event, alarm.ClearEvent} {
+		if _, ok := thing.availableEvents[event]; event != "" && !ok {
+			return errors.New("Not found event: " + event)
+		}
+	}
+	if alarm.Event == "" {
+		return errors.New("An alarm requires an event: " + alarm.Property)
+	}
+
+	a := &alarmState{Alarm: alarm, thing: thing}
+	thing.OnPropertyChange(func(property *Property) {
+		if property.Name() == alarm.Property {
+			a.update(property.Value().Get())
+		}
+	})
+	a.update(thing.Property(alarm.Property).Get())
+	return nil
+}
+
+// update Raise or clear the alarm for a new value. The events are added
+// once the lock is released, as their hooks may change the property again.
+func (a *alarmState) update(value interface{}) {
+	v, ok := Number(value)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	events := a.transition(v, value)
+	a.mu.Unlock()
+	for _, event := range events {
+		a.emit(event)
+	}
+}
+
+// transition Change the level of the alarm for a new value and get the
+// events to add. Callers hold the lock.
+func (a *alarmState) transition(v float64, value interface{}) []alarmEvent {
+	level := a.levelOf(v)
+	if level == a.level {
+		a.cancel()
+		return nil
+	}
+	var events []alarmEvent
+	if a.level != alarmNormal {
+		a.level = alarmNormal
+		events = append(events, alarmEvent{a.ClearEvent, a.ClearData, value})
+	}
+	if level == alarmNormal {
+		a.cancel()
+		return events
+	}
+	if a.For <= 0 {
+		return append(events, a.raise(level, value))
+	}
+	if a.timer != nil && a.pending == level {
+		return events
+	}
+	a.cancel()
+	a.pending = level
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(a.For), func() {
+		a.mu.Lock()
+		fire := a.timer == timer
+		var event alarmEvent
+		if fire {
+			a.timer = nil
+			event = a.raise(level, a.thing.Property(a.Property).Get())
+		}
+		a.mu.Unlock()
+		if fire {
+			a.emit(event)
+		}
+	})
+	a.timer = timer
+	return events
+}
+
+// levelOf Get the level of a value, keeping a raised alarm within the
+// hysteresis.
+func (a *alarmState) levelOf(v float64) int {
+	if a.High != nil && (v >= *a.High || a.level == alarmHigh && v > *a.High-a.Hysteresis) {
+		return alarmHigh
+	}
+	if a.Low != nil && (v <= *a.Low || a.level == alarmLow && v < *a.Low+a.Hysteresis) {
+		return alarmLow
+	}
+	return alarmNormal
+}
+
+// raise Raise the alarm and get its event. Callers hold the lock.
+func (a *alarmState) raise(level int, value interface{}) alarmEvent {
+	a.level = level
+	return alarmEvent{a.Event, a.Data, value}
+}
+
+// cancel Stop waiting to raise the alarm. Callers hold the lock.
+func (a *alarmState) cancel() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+}
+
+// alarmEvent An event of an alarm with its data, or the value of the
+// property if there is none.
+type alarmEvent struct {
+	name  string
+	data  json.RawMessage
+	value interface{}
+}
+
+// emit Add an alarm event. Callers do not hold the lock.
+func (a *alarmState) emit(event alarmEvent) {
+	if event.name == "" {
+		return
+	}
+	data := event.data
+	if data == nil {
+		data, _ = json.Marshal(event.value)
+	}
+	a.thing.AddEvent(NewEvent(a.thing, event.name, data))
+}
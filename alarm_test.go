@@ -0,0 +1,79 @@
+package webthing
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAlarmHooks(t *testing.T) {
+	thing := NewThing("urn:dev:ops:alarm", "Alarm", nil, "")
+	thing.AddProperty(NewProperty(thing, "temperature", NewValue(20.0), json.RawMessage(`{"type": "number"}`)))
+	thing.AddAvailableEvent("overheated", json.RawMessage(`{"type": "number"}`))
+	high := 80.0
+	if err := thing.AddAlarm(Alarm{Property: "temperature", High: &high, Event: "overheated"}); err != nil {
+		t.Fatalf("AddAlarm: %v", err)
+	}
+
+	// The alarm adds the event from a property hook, and the event hook
+	// registers another hook.
+	raised := make(chan *Event, 1)
+	thing.OnEvent(func(event *Event) {
+		thing.OnEvent(func(*Event) {})
+		raised <- event
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		value := NewValue(90.0)
+		done <- thing.SetProperty("temperature", &value)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("SetProperty: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Deadlock calling the hooks")
+	}
+	if event := <-raised; event.Name() != "overheated" || string(event.Data()) != "90" {
+		t.Fatalf("Expected the overheated event with the value, got %s %s", event.Name(), event.Data())
+	}
+}
+
+func TestAlarmEventHookWritesProperty(t *testing.T) {
+	thing := NewThing("urn:dev:ops:alarm", "Alarm", nil, "")
+	thing.AddProperty(NewProperty(thing, "temperature", NewValue(20.0), json.RawMessage(`{"type": "number"}`)))
+	thing.AddAvailableEvent("overheated", json.RawMessage(`{"type": "number"}`))
+	thing.AddAvailableEvent("cooled", json.RawMessage(`{"type": "number"}`))
+	high := 80.0
+	err := thing.AddAlarm(Alarm{Property: "temperature", High: &high, Event: "overheated", ClearEvent: "cooled"})
+	if err != nil {
+		t.Fatalf("AddAlarm: %v", err)
+	}
+
+	// Cooling down from the event hook updates the alarm again.
+	cooled := make(chan *Event, 1)
+	thing.OnEvent(func(event *Event) {
+		switch event.Name() {
+		case "overheated":
+			value := NewValue(20.0)
+			thing.SetProperty("temperature", &value)
+		case "cooled":
+			cooled <- event
+		}
+	})
+
+	go func() {
+		value := NewValue(90.0)
+		thing.SetProperty("temperature", &value)
+	}()
+	select {
+	case event := <-cooled:
+		if string(event.Data()) != "20" {
+			t.Fatalf("Expected the cooled event with the value, got %s", event.Data())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Deadlock writing the property from an alarm event hook")
+	}
+}
@@ -0,0 +1,191 @@
+package webthing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AsyncAPIPath Path of the AsyncAPI document below the base path of a
+// server.
+const AsyncAPIPath = "/asyncapi.json"
+
+// AsyncAPI Get the AsyncAPI 2.6 document describing the WebSocket API of
+// the things of this server. Every thing has a channel at its href.
+//
+// @param host Host and port the server is reached at, e.g. "localhost:8888"
+func (server *ThingServer) AsyncAPI(host string) []byte {
+	channels := make(map[string]interface{})
+	for _, thing := range server.Things {
+		channels[thing.Href()] = thing.asyncAPIChannel()
+	}
+
+	doc := map[string]interface{}{
+		"asyncapi": "2.6.0",
+		"info": map[string]interface{}{
+			"title":       server.Name,
+			"version":     "1.0.0",
+			"description": "Messages exchanged over the WebSocket of each thing.",
+		},
+		"servers": map[string]interface{}{
+			"default": map[string]interface{}{
+				"url":      host,
+				"protocol": "ws",
+			},
+		},
+		"defaultContentType": "application/json",
+		"channels":           channels,
+	}
+	content, _ := json.MarshalIndent(doc, "", "  ")
+	return content
+}
+
+// asyncAPIChannel Get the AsyncAPI channel of the WebSocket of this thing.
+// In AsyncAPI 2, clients subscribe to messages the thing sends and publish
+// messages the thing receives.
+func (thing *Thing) asyncAPIChannel() map[string]interface{} {
+	values := make(map[string]interface{})
+	writable := make(map[string]interface{})
+	for _, name := range thing.propertyNames() {
+		property, ok := thing.FindProperty(name)
+		if !ok {
+			continue
+		}
+		schema := dataSchema(property.Metadata())
+		values[name] = schema
+		if readOnly, _ := schema["readOnly"].(bool); !readOnly {
+			writable[name] = schema
+		}
+	}
+
+	statuses := make(map[string]interface{})
+	requests := make(map[string]interface{})
+	for _, name := range thing.actionNames() {
+		var metadata map[string]interface{}
+		json.Unmarshal(thing.availableActions[name].Metadata(), &metadata)
+		input := map[string]interface{}{}
+		if v, ok := metadata["input"]; ok {
+			content, _ := json.Marshal(v)
+			input = dataSchema(content)
+		}
+		requests[name] = map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"input": input},
+		}
+		statuses[name] = map[string]interface{}{
+			"type":     "object",
+			"required": []string{"href", "status", "timeRequested"},
+			"properties": map[string]interface{}{
+				"input":         input,
+				"href":          map[string]interface{}{"type": "string"},
+				"status":        map[string]interface{}{"type": "string", "enum": []string{"created", "pending", "completed", "cancelled", "failed"}},
+				"timeRequested": map[string]interface{}{"type": "string", "format": "date-time"},
+				"timeCompleted": map[string]interface{}{"type": "string", "format": "date-time"},
+			},
+		}
+	}
+
+	events := make(map[string]interface{})
+	subscriptions := make(map[string]interface{})
+	for _, name := range thing.eventNames() {
+		events[name] = map[string]interface{}{
+			"type":     "object",
+			"required": []string{"timestamp"},
+			"properties": map[string]interface{}{
+				"timestamp": map[string]interface{}{"type": "string", "format": "date-time"},
+				"data":      dataSchema(thing.availableEvents[name].Metadata()),
+			},
+		}
+		subscriptions[name] = map[string]interface{}{"type": "object"}
+	}
+
+	received := []interface{}{
+		asyncMessage("propertyStatus", "The values of properties changed", members(values)),
+		asyncMessage("actionStatus", "The status of an action request changed", members(statuses)),
+		asyncMessage("event", "An event the client subscribed to was emitted", members(events)),
+		asyncMessage("connectivityStatus", "The connectivity of the device changed", map[string]interface{}{
+			"type":     "object",
+			"required": []string{"state"},
+			"properties": map[string]interface{}{
+				"state":    map[string]interface{}{"type": "string", "enum": []ConnectivityState{Online, Degraded, Offline}},
+				"reason":   map[string]interface{}{"type": "string"},
+				"lastSeen": map[string]interface{}{"type": "string", "format": "date-time"},
+			},
+		}),
+		asyncMessage("error", "A message of the client could not be handled", map[string]interface{}{
+			"type":     "object",
+			"required": []string{"status", "message"},
+			"properties": map[string]interface{}{
+				"status":  map[string]interface{}{"type": "string"},
+				"message": map[string]interface{}{"type": "string"},
+				"request": map[string]interface{}{"description": "The message that caused the error"},
+			},
+		}),
+	}
+	sent := []interface{}{
+		asyncMessage("setProperty", "Set the values of properties", members(writable)),
+		asyncMessage("requestAction", "Request actions", members(requests)),
+		asyncMessage("addEventSubscription", "Subscribe to events", members(subscriptions)),
+	}
+
+	id := strings.NewReplacer("/", "_", ":", "_").Replace(strings.Trim(thing.Href(), "/"))
+	if id != "" {
+		id += "_"
+	}
+	return map[string]interface{}{
+		"description": "WebSocket of " + thing.Title(),
+		"subscribe": map[string]interface{}{
+			"operationId": id + "receive",
+			"summary":     "Messages sent by the thing",
+			"message":     map[string]interface{}{"oneOf": received},
+		},
+		"publish": map[string]interface{}{
+			"operationId": id + "send",
+			"summary":     "Messages sent to the thing",
+			"message":     map[string]interface{}{"oneOf": sent},
+		},
+	}
+}
+
+// AsyncAPIHandle Handle a request to the AsyncAPI document.
+type AsyncAPIHandle struct {
+	server *ThingServer
+}
+
+// Handle Serve the AsyncAPI document.
+func (h *AsyncAPIHandle) Handle(w http.ResponseWriter, r *http.Request) {
+	corsResponse(w)
+	jsonResponse(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := w.Write(h.server.AsyncAPI(r.Host)); err != nil {
+		h.server.Logger().Error("Write response failure", "request", RequestID(r), "error", err)
+	}
+}
+
+// asyncMessage Build an AsyncAPI message of the Web Thing protocol.
+func asyncMessage(messageType, summary string, data interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"name":    messageType,
+		"summary": summary,
+		"payload": map[string]interface{}{
+			"type":     "object",
+			"required": []string{"messageType", "data"},
+			"properties": map[string]interface{}{
+				"messageType": map[string]interface{}{"const": messageType},
+				"data":        data,
+			},
+		},
+	}
+}
+
+// members Get the schema of an object with optional members.
+func members(schemas map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           schemas,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,66 @@
+// Package boltstore A webthing.Store keeping the state of things in an
+// embedded bbolt key-value database.
+package boltstore
+
+import (
+	"encoding/json"
+
+	"github.com/dravenk/webthing-go"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucket = []byte("things")
+
+// Store A webthing.Store backed by a bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open Open or create the database file.
+//
+// @param path Path of the database file
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Load Load the saved state of a thing.
+func (s *Store) Load(thingID string) (*webthing.ThingState, error) {
+	var state *webthing.ThingState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		content := tx.Bucket(bucket).Get([]byte(thingID))
+		if content == nil {
+			return nil
+		}
+		state = &webthing.ThingState{}
+		return json.Unmarshal(content, state)
+	})
+	return state, err
+}
+
+// Save Save the state of a thing.
+func (s *Store) Save(thingID string, state *webthing.ThingState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(thingID), content)
+	})
+}
+
+// Close Close the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
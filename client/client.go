@@ -0,0 +1,154 @@
+// Package client Consume Web Things served by a ThingServer or any other
+// implementation of the Web Thing API or the W3C WoT Thing Description.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client A client for remote Web Things.
+type Client struct {
+	// HTTPClient The client used for HTTP requests.
+	HTTPClient *http.Client
+
+	// Dialer The dialer used for websocket connections.
+	Dialer *websocket.Dialer
+}
+
+// New Create a client using the default HTTP client and websocket dialer.
+func New() *Client {
+	return &Client{
+		HTTPClient: http.DefaultClient,
+		Dialer:     websocket.DefaultDialer,
+	}
+}
+
+// Fetch Fetch the thing description served at the given URL.
+//
+// @param ctx    Context of the request
+// @param rawURL URL of the thing
+// @return The consumed thing.
+func (c *Client) Fetch(ctx context.Context, rawURL string) (*Thing, error) {
+	things, err := c.FetchAll(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(things) != 1 {
+		return nil, errors.New("client: expected a single thing description")
+	}
+	return things[0], nil
+}
+
+// FetchAll Fetch the thing descriptions served at the given URL.
+//
+// The URL may either serve a single thing description or a list of thing
+// descriptions, as done by a server of multiple things.
+//
+// @param ctx    Context of the request
+// @param rawURL URL of the thing or of the things
+// @return The consumed things.
+func (c *Client) FetchAll(ctx context.Context, rawURL string) ([]*Thing, error) {
+	var raw json.RawMessage
+	if err := c.do(ctx, http.MethodGet, rawURL, nil, &raw); err != nil {
+		return nil, err
+	}
+
+	var descriptions []*ThingDescription
+	if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '[' {
+		if err := json.Unmarshal(raw, &descriptions); err != nil {
+			return nil, err
+		}
+	} else {
+		td := &ThingDescription{}
+		if err := json.Unmarshal(raw, td); err != nil {
+			return nil, err
+		}
+		descriptions = append(descriptions, td)
+	}
+
+	things := make([]*Thing, 0, len(descriptions))
+	for _, td := range descriptions {
+		thing, err := c.Consume(td, rawURL)
+		if err != nil {
+			return nil, err
+		}
+		things = append(things, thing)
+	}
+	return things, nil
+}
+
+// Consume Create a consumed thing from a thing description.
+//
+// @param td      The thing description
+// @param baseURL URL relative hrefs are resolved against, unless the
+// thing description declares its own base
+// @return The consumed thing.
+func (c *Client) Consume(td *ThingDescription, baseURL string) (*Thing, error) {
+	if td.Base != "" {
+		baseURL = td.Base
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Thing{td: td, client: c, base: base, observers: newObservers()}, nil
+}
+
+// do Send a request and decode the JSON response into out.
+func (c *Client) do(ctx context.Context, method, rawURL string, in, out interface{}) error {
+	var body *bytes.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{
+			Method:     method,
+			URL:        rawURL,
+			StatusCode: resp.StatusCode,
+			Body:       content,
+		}
+	}
+	if out == nil || len(bytes.TrimSpace(content)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(content, out)
+}
@@ -0,0 +1,403 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	lampOnce   sync.Once
+	lampThing  *webthing.Thing
+	lampServer *httptest.Server
+)
+
+// toggleAction Toggle the on property of the lamp.
+type toggleAction struct {
+	*webthing.Action
+}
+
+func (toggle *toggleAction) Generator(thing *webthing.Thing) *webthing.Action {
+	toggle.Action = webthing.NewAction(uuid.New().String(), thing, "toggle", nil, toggle.PerformAction, toggle.Cancel)
+	return toggle.Action
+}
+
+func (toggle *toggleAction) PerformAction() *webthing.Action {
+	on := toggle.Thing().Property("on")
+	on.Set(!on.Get().(bool))
+	return toggle.Action
+}
+
+func (toggle *toggleAction) Cancel() {}
+
+// serveLamp Serve a lamp from a ThingServer, which registers its routes on
+// the default mux and is therefore shared by the tests.
+func serveLamp(t *testing.T) (*webthing.Thing, string) {
+	lampOnce.Do(func() {
+		lampThing = webthing.NewThing("urn:dev:ops:test-lamp", "Lamp", []string{"OnOffSwitch"}, "A test lamp")
+		lampThing.AddProperty(webthing.NewProperty(lampThing, "on", webthing.NewValue(false),
+			[]byte(`{"type": "boolean", "title": "On/Off"}`)))
+		lampThing.AddProperty(webthing.NewProperty(lampThing, "level", webthing.NewValue(50.0),
+			[]byte(`{"type": "number", "minimum": 0, "maximum": 100}`)))
+		lampThing.AddAvailableAction("toggle", []byte(`{"title": "Toggle"}`), &toggleAction{})
+		lampThing.AddAvailableEvent("ping", []byte(`{"type": "string"}`))
+
+		webthing.NewWebThingServer(webthing.NewSingleThing(lampThing), &http.Server{}, "")
+		lampServer = httptest.NewServer(http.DefaultServeMux)
+	})
+	return lampThing, lampServer.URL
+}
+
+func fetchLamp(t *testing.T, c *Client) *Thing {
+	_, url := serveLamp(t)
+	thing, err := c.Fetch(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	t.Cleanup(func() { thing.Close() })
+	return thing
+}
+
+// receive Wait for a value sent on a channel.
+func receive[T any](t *testing.T, ch chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout")
+	}
+	var zero T
+	return zero
+}
+
+func TestFetchLinks(t *testing.T) {
+	thing := fetchLamp(t, New())
+	td := thing.Description()
+	if td.ID != "urn:dev:ops:test-lamp" || td.Title != "Lamp" || !td.Type.Has("OnOffSwitch") {
+		t.Fatalf("Unexpected description: %+v", td)
+	}
+	if _, ok := td.Properties["on"]; !ok {
+		t.Fatal("Missing property on")
+	}
+	if _, ok := td.Actions["toggle"]; !ok {
+		t.Fatal("Missing action toggle")
+	}
+	if _, ok := td.Events["ping"]; !ok {
+		t.Fatal("Missing event ping")
+	}
+	if _, ok := td.link("properties"); !ok {
+		t.Fatal("Missing properties link")
+	}
+}
+
+func TestReadWriteProperty(t *testing.T) {
+	ctx := context.Background()
+	thing := fetchLamp(t, New())
+
+	if err := thing.WriteProperty(ctx, "level", 20.0); err != nil {
+		t.Fatalf("WriteProperty: %v", err)
+	}
+	value, err := thing.ReadProperty(ctx, "level")
+	if err != nil {
+		t.Fatalf("ReadProperty: %v", err)
+	}
+	if value != 20.0 {
+		t.Fatalf("Expected 20, got %v", value)
+	}
+
+	values, err := thing.ReadAllProperties(ctx)
+	if err != nil {
+		t.Fatalf("ReadAllProperties: %v", err)
+	}
+	if values["level"] != 20.0 {
+		t.Fatalf("Expected level 20, got %v", values)
+	}
+}
+
+func TestInvokeAction(t *testing.T) {
+	ctx := context.Background()
+	lamp, _ := serveLamp(t)
+	thing := fetchLamp(t, New())
+	before := lamp.Property("on").Get().(bool)
+
+	status, err := thing.InvokeAction(ctx, "toggle", nil)
+	if err != nil {
+		t.Fatalf("InvokeAction: %v", err)
+	}
+	if status.Name != "toggle" || status.Href == "" {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status.Status != "completed" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Action not completed: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if status, err = thing.QueryAction(ctx, status); err != nil {
+			t.Fatalf("QueryAction: %v", err)
+		}
+	}
+	if lamp.Property("on").Get().(bool) == before {
+		t.Fatal("Action not performed")
+	}
+}
+
+func TestObserveProperty(t *testing.T) {
+	lamp, _ := serveLamp(t)
+	thing := fetchLamp(t, New())
+
+	values := make(chan interface{}, 10)
+	s, err := thing.ObserveProperty(context.Background(), "level", func(v interface{}) {
+		values <- v
+	})
+	if err != nil {
+		t.Fatalf("ObserveProperty: %v", err)
+	}
+	defer s.Unsubscribe()
+
+	lamp.Property("level").NotifyOfExternalUpdate(33.0)
+	if v := receive(t, values); v != 33.0 {
+		t.Fatalf("Expected 33, got %v", v)
+	}
+}
+
+func TestSubscribeEvent(t *testing.T) {
+	lamp, _ := serveLamp(t)
+	thing := fetchLamp(t, New())
+
+	events := make(chan *Event, 10)
+	s, err := thing.SubscribeEvent(context.Background(), "ping", func(e *Event) {
+		events <- e
+	})
+	if err != nil {
+		t.Fatalf("SubscribeEvent: %v", err)
+	}
+	defer s.Unsubscribe()
+
+	emit(t, lamp, events, "hello")
+}
+
+// emit Emit ping events until one is received, as the subscription is sent
+// asynchronously.
+func emit(t *testing.T, lamp *webthing.Thing, events chan *Event, data string) {
+	t.Helper()
+	content, _ := json.Marshal(data)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		lamp.AddEvent(webthing.NewEvent(lamp, "ping", content))
+		select {
+		case e := <-events:
+			if e.Name != "ping" || string(e.Data) != string(content) {
+				t.Fatalf("Unexpected event: %+v", e)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Fatal("Event not received")
+}
+
+func TestReconnect(t *testing.T) {
+	lamp, _ := serveLamp(t)
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	c := New()
+	c.Dialer = &websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		mu.Lock()
+		conns = append(conns, conn)
+		mu.Unlock()
+		return conn, err
+	}}
+	thing := fetchLamp(t, c)
+
+	errs := make(chan error, 10)
+	thing.ErrorHandler = func(err error) { errs <- err }
+	values := make(chan interface{}, 10)
+	if _, err := thing.ObserveProperty(context.Background(), "level", func(v interface{}) {
+		values <- v
+	}); err != nil {
+		t.Fatalf("ObserveProperty: %v", err)
+	}
+	events := make(chan *Event, 10)
+	if _, err := thing.SubscribeEvent(context.Background(), "ping", func(e *Event) {
+		events <- e
+	}); err != nil {
+		t.Fatalf("SubscribeEvent: %v", err)
+	}
+
+	mu.Lock()
+	conns[0].Close()
+	mu.Unlock()
+	receive(t, errs)
+
+	if err := thing.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	emit(t, lamp, events, "again")
+	lamp.Property("level").NotifyOfExternalUpdate(44.0)
+	for v := receive(t, values); v != 44.0; v = receive(t, values) {
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	thing := fetchLamp(t, New())
+
+	if _, err := thing.ReadProperty(ctx, "missing"); !errors.Is(err, ErrPropertyNotFound) {
+		t.Errorf("Expected ErrPropertyNotFound, got %v", err)
+	}
+	if err := thing.WriteProperty(ctx, "missing", 1); !errors.Is(err, ErrPropertyNotFound) {
+		t.Errorf("Expected ErrPropertyNotFound, got %v", err)
+	}
+	if _, err := thing.ObserveProperty(ctx, "missing", func(interface{}) {}); !errors.Is(err, ErrPropertyNotFound) {
+		t.Errorf("Expected ErrPropertyNotFound, got %v", err)
+	}
+	if _, err := thing.InvokeAction(ctx, "missing", nil); !errors.Is(err, ErrActionNotFound) {
+		t.Errorf("Expected ErrActionNotFound, got %v", err)
+	}
+	if _, err := thing.SubscribeEvent(ctx, "missing", func(*Event) {}); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("Expected ErrEventNotFound, got %v", err)
+	}
+	if _, err := thing.QueryAction(ctx, &ActionStatus{Name: "toggle"}); !errors.Is(err, ErrNoHref) {
+		t.Errorf("Expected ErrNoHref, got %v", err)
+	}
+
+	// A thing description declaring a property the remote thing lacks.
+	_, url := serveLamp(t)
+	td := *thing.Description()
+	td.Properties = map[string]*Affordance{"missing": {Links: []Link{{Href: "/properties/missing"}}}}
+	stale, err := New().Consume(&td, url)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	_, err = stale.ReadProperty(ctx, "missing")
+	var statusError *StatusError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &statusError) || statusError.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 StatusError, got %v", err)
+	}
+
+	errs := make(chan error, 1)
+	thing.ErrorHandler = func(err error) { errs <- err }
+	c, err := thing.connect(ctx)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := c.send("unknown", map[string]interface{}{}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	var protocolError *ProtocolError
+	if err := receive(t, errs); !errors.As(err, &protocolError) || protocolError.Status != "400 Bad Request" {
+		t.Errorf("Expected a ProtocolError, got %v", err)
+	}
+
+	thing.Close()
+	if err := c.send("unknown", map[string]interface{}{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// formsServer Serve a thing described with the forms of the W3C WoT Thing
+// Description, which exchanges unwrapped values.
+func formsServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	level := 10.0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/td", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+  "@context": "https://www.w3.org/2019/wot/td/v1",
+  "id": "urn:dev:ops:forms-dimmer",
+  "title": "Dimmer",
+  "@type": "Light",
+  "forms": [{"href": "/properties", "op": "readallproperties"}],
+  "properties": {
+    "level": {"type": "number", "forms": [{"href": "/properties/level", "op": ["readproperty", "writeproperty"]}]}
+  },
+  "actions": {
+    "dim": {"forms": [{"href": "/actions/dim", "op": "invokeaction"}]}
+  }
+}`))
+	})
+	mux.HandleFunc("/properties", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"level": level})
+	})
+	mux.HandleFunc("/properties/level", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			if err := json.NewDecoder(r.Body).Decode(&level); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(level)
+	})
+	mux.HandleFunc("/actions/dim", func(w http.ResponseWriter, r *http.Request) {
+		var input float64
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		level = input
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"href": "/actions/dim/1", "status": "completed"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchForms(t *testing.T) {
+	ctx := context.Background()
+	server := formsServer(t)
+	thing, err := New().Fetch(ctx, server.URL+"/td")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if td := thing.Description(); td.ID != "urn:dev:ops:forms-dimmer" || !td.Type.Has("Light") {
+		t.Fatalf("Unexpected description: %+v", td)
+	}
+
+	if value, err := thing.ReadProperty(ctx, "level"); err != nil || value != 10.0 {
+		t.Fatalf("Expected 10, got %v, %v", value, err)
+	}
+	if err := thing.WriteProperty(ctx, "level", 30.0); err != nil {
+		t.Fatalf("WriteProperty: %v", err)
+	}
+	if value, err := thing.ReadProperty(ctx, "level"); err != nil || value != 30.0 {
+		t.Fatalf("Expected 30, got %v, %v", value, err)
+	}
+
+	status, err := thing.InvokeAction(ctx, "dim", 70.0)
+	if err != nil {
+		t.Fatalf("InvokeAction: %v", err)
+	}
+	if status.Name != "dim" || status.Href != "/actions/dim/1" || status.Status != "completed" {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+	values, err := thing.ReadAllProperties(ctx)
+	if err != nil || values["level"] != 70.0 {
+		t.Fatalf("Expected level 70, got %v, %v", values, err)
+	}
+
+	if _, err := thing.ObserveProperty(ctx, "level", func(interface{}) {}); !errors.Is(err, ErrNoHref) {
+		t.Fatalf("Expected ErrNoHref, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// ThingDescription A Thing Description as served by a remote thing.
+//
+// Both the Web Thing API format, which describes endpoints with links, and
+// the W3C WoT Thing Description format, which describes them with forms, are
+// understood.
+type ThingDescription struct {
+	ID          string                 `json:"id,omitempty"`
+	Context     interface{}            `json:"@context,omitempty"`
+	Type        Types                  `json:"@type,omitempty"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	Base        string                 `json:"base,omitempty"`
+	Properties  map[string]*Affordance `json:"properties,omitempty"`
+	Actions     map[string]*Affordance `json:"actions,omitempty"`
+	Events      map[string]*Affordance `json:"events,omitempty"`
+	Links       []Link                 `json:"links,omitempty"`
+	Forms       []Form                 `json:"forms,omitempty"`
+}
+
+// Affordance A property, action or event of a thing description.
+type Affordance struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	ReadOnly    bool   `json:"readOnly,omitempty"`
+	Links       []Link `json:"links,omitempty"`
+	Forms       []Form `json:"forms,omitempty"`
+
+	// Metadata The complete affordance object as it appeared in the
+	// thing description.
+	Metadata json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON Decode the affordance and keep its raw metadata.
+func (a *Affordance) UnmarshalJSON(data []byte) error {
+	type affordance Affordance
+	if err := json.Unmarshal(data, (*affordance)(a)); err != nil {
+		return err
+	}
+	a.Metadata = append(json.RawMessage{}, data...)
+	return nil
+}
+
+// Link A link of the Web Thing API.
+type Link struct {
+	Href      string `json:"href,omitempty"`
+	Rel       string `json:"rel,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+// Form A form of the W3C WoT Thing Description.
+type Form struct {
+	Href        string `json:"href"`
+	Op          Types  `json:"op,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Subprotocol string `json:"subprotocol,omitempty"`
+}
+
+// Types A list of strings that may be encoded as a single string.
+type Types []string
+
+// UnmarshalJSON Decode a string or an array of strings.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = Types{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// Has Report whether the list contains the given string.
+func (t Types) Has(s string) bool {
+	for _, v := range t {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoint An href resolved for an operation together with the wire format
+// that is used on it.
+type endpoint struct {
+	href string
+
+	// wrapped Whether payloads are wrapped in an object keyed by the
+	// affordance name, as done by the Web Thing API.
+	wrapped bool
+}
+
+// href Find the endpoint of an affordance for the given operation.
+//
+// Forms are preferred over links. Only http(s) and relative hrefs are
+// considered.
+func (a *Affordance) href(op string) (endpoint, bool) {
+	for _, form := range a.Forms {
+		if (len(form.Op) == 0 || form.Op.Has(op)) && isHTTP(form.Href) {
+			return endpoint{href: form.Href}, true
+		}
+	}
+	for _, link := range a.Links {
+		if isHTTP(link.Href) {
+			return endpoint{href: link.Href, wrapped: true}, true
+		}
+	}
+	return endpoint{}, false
+}
+
+// link Find the href of a thing level link with the given relation.
+func (td *ThingDescription) link(rel string) (string, bool) {
+	for _, link := range td.Links {
+		if link.Rel == rel && isHTTP(link.Href) {
+			return link.Href, true
+		}
+	}
+	return "", false
+}
+
+// webSocketHref Find the websocket endpoint of the thing.
+func (td *ThingDescription) webSocketHref() (string, bool) {
+	for _, link := range td.Links {
+		if link.Rel == "alternate" && isWebSocket(link.Href) {
+			return link.Href, true
+		}
+	}
+	for _, form := range td.Forms {
+		if isWebSocket(form.Href) {
+			return form.Href, true
+		}
+	}
+	// The thing is served at the parent of its properties resource.
+	if href, ok := td.link("properties"); ok {
+		return strings.TrimSuffix(href, "/properties"), true
+	}
+	return "", false
+}
+
+func isHTTP(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https"
+}
+
+func isWebSocket(href string) bool {
+	return strings.HasPrefix(href, "ws://") || strings.HasPrefix(href, "wss://")
+}
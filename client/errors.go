@@ -0,0 +1,55 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrNotFound The remote thing does not know the requested resource.
+	ErrNotFound = errors.New("client: resource not found")
+
+	// ErrPropertyNotFound The thing description does not contain the property.
+	ErrPropertyNotFound = errors.New("client: property not found")
+
+	// ErrActionNotFound The thing description does not contain the action.
+	ErrActionNotFound = errors.New("client: action not found")
+
+	// ErrEventNotFound The thing description does not contain the event.
+	ErrEventNotFound = errors.New("client: event not found")
+
+	// ErrNoHref No usable href was found for the requested operation.
+	ErrNoHref = errors.New("client: no href for operation")
+
+	// ErrClosed The websocket connection of the thing has been closed.
+	ErrClosed = errors.New("client: connection closed")
+)
+
+// StatusError An HTTP request was answered with an unexpected status code.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client: %s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is Report whether a 404 response matches ErrNotFound.
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// ProtocolError An error message received over the websocket.
+type ProtocolError struct {
+	Status  string
+	Message string
+	Request []byte
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("client: %s: %s", e.Status, e.Message)
+}
@@ -0,0 +1,318 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Thing A remote thing consumed through its thing description.
+type Thing struct {
+	td     *ThingDescription
+	client *Client
+	base   *url.URL
+
+	mu        sync.Mutex
+	conn      *conn
+	observers *observers
+
+	// ErrorHandler Called with errors reported by the remote thing over the
+	// websocket and with the error that ended the connection.
+	ErrorHandler func(error)
+}
+
+// ActionStatus The status of an action requested on a remote thing.
+type ActionStatus struct {
+	Name          string          `json:"-"`
+	Href          string          `json:"href,omitempty"`
+	Status        string          `json:"status,omitempty"`
+	TimeRequested string          `json:"timeRequested,omitempty"`
+	TimeCompleted string          `json:"timeCompleted,omitempty"`
+	Input         json.RawMessage `json:"input,omitempty"`
+}
+
+// Event An event emitted by a remote thing.
+type Event struct {
+	Name      string          `json:"-"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Description Get the thing description of the thing.
+//
+// @return The thing description.
+func (t *Thing) Description() *ThingDescription {
+	return t.td
+}
+
+// ReadProperty Read the current value of a property.
+//
+// @param ctx  Context of the request
+// @param name Name of the property
+// @return The property value.
+func (t *Thing) ReadProperty(ctx context.Context, name string) (interface{}, error) {
+	ep, err := t.propertyEndpoint(name, "readproperty")
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if !ep.wrapped {
+		err = t.client.do(ctx, http.MethodGet, ep.href, nil, &value)
+		return value, err
+	}
+	obj := map[string]interface{}{}
+	if err = t.client.do(ctx, http.MethodGet, ep.href, nil, &obj); err != nil {
+		return nil, err
+	}
+	return obj[name], nil
+}
+
+// ReadAllProperties Read the current values of all properties.
+//
+// @param ctx Context of the request
+// @return Mapping of property name to value.
+func (t *Thing) ReadAllProperties(ctx context.Context) (map[string]interface{}, error) {
+	href, ok := t.td.link("properties")
+	if !ok {
+		for _, form := range t.td.Forms {
+			if form.Op.Has("readallproperties") && isHTTP(form.Href) {
+				href, ok = form.Href, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, ErrNoHref
+	}
+
+	values := map[string]interface{}{}
+	err := t.client.do(ctx, http.MethodGet, t.resolve(href), nil, &values)
+	return values, err
+}
+
+// WriteProperty Write a new value to a property.
+//
+// @param ctx   Context of the request
+// @param name  Name of the property
+// @param value The value to write
+func (t *Thing) WriteProperty(ctx context.Context, name string, value interface{}) error {
+	ep, err := t.propertyEndpoint(name, "writeproperty")
+	if err != nil {
+		return err
+	}
+	if ep.wrapped {
+		value = map[string]interface{}{name: value}
+	}
+	return t.client.do(ctx, http.MethodPut, ep.href, value, nil)
+}
+
+// InvokeAction Request an action on the thing.
+//
+// @param ctx   Context of the request
+// @param name  Name of the action
+// @param input Input of the action, or nil
+// @return Status of the created action.
+func (t *Thing) InvokeAction(ctx context.Context, name string, input interface{}) (*ActionStatus, error) {
+	affordance, ok := t.td.Actions[name]
+	if !ok {
+		return nil, ErrActionNotFound
+	}
+	ep, ok := affordance.href("invokeaction")
+	if !ok {
+		return nil, ErrNoHref
+	}
+
+	body := input
+	if ep.wrapped {
+		params := map[string]interface{}{}
+		if input != nil {
+			params["input"] = input
+		}
+		body = map[string]interface{}{name: params}
+	}
+
+	var raw json.RawMessage
+	if err := t.client.do(ctx, http.MethodPost, t.resolve(ep.href), body, &raw); err != nil {
+		return nil, err
+	}
+	return decodeActionStatus(name, raw), nil
+}
+
+// QueryAction Get the current status of a requested action.
+//
+// @param ctx    Context of the request
+// @param action The action as returned by InvokeAction
+// @return The current status of the action.
+func (t *Thing) QueryAction(ctx context.Context, action *ActionStatus) (*ActionStatus, error) {
+	if action.Href == "" {
+		return nil, ErrNoHref
+	}
+	var raw json.RawMessage
+	if err := t.client.do(ctx, http.MethodGet, t.resolve(action.Href), nil, &raw); err != nil {
+		return nil, err
+	}
+	return decodeActionStatus(action.Name, raw), nil
+}
+
+// CancelAction Cancel a requested action.
+//
+// @param ctx    Context of the request
+// @param action The action as returned by InvokeAction
+func (t *Thing) CancelAction(ctx context.Context, action *ActionStatus) error {
+	if action.Href == "" {
+		return ErrNoHref
+	}
+	return t.client.do(ctx, http.MethodDelete, t.resolve(action.Href), nil, nil)
+}
+
+// ObserveProperty Call handler whenever the value of a property changes.
+//
+// @param ctx     Context used to open the websocket connection
+// @param name    Name of the property
+// @param handler Called with each new value
+// @return The subscription.
+func (t *Thing) ObserveProperty(ctx context.Context, name string, handler func(interface{})) (*Subscription, error) {
+	if _, ok := t.td.Properties[name]; !ok {
+		return nil, ErrPropertyNotFound
+	}
+	if _, err := t.connect(ctx); err != nil {
+		return nil, err
+	}
+	return t.observers.observeProperty(name, handler), nil
+}
+
+// ObserveActions Call handler whenever the status of an action changes.
+//
+// @param ctx     Context used to open the websocket connection
+// @param handler Called with each new action status
+// @return The subscription.
+func (t *Thing) ObserveActions(ctx context.Context, handler func(*ActionStatus)) (*Subscription, error) {
+	if _, err := t.connect(ctx); err != nil {
+		return nil, err
+	}
+	return t.observers.observeActions(handler), nil
+}
+
+// SubscribeEvent Call handler whenever the thing emits an event.
+//
+// @param ctx     Context used to open the websocket connection
+// @param name    Name of the event
+// @param handler Called with each emitted event
+// @return The subscription.
+func (t *Thing) SubscribeEvent(ctx context.Context, name string, handler func(*Event)) (*Subscription, error) {
+	if _, ok := t.td.Events[name]; !ok {
+		return nil, ErrEventNotFound
+	}
+	c, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.observers.subscribeEvent(c, name, handler)
+}
+
+// Connect Open the websocket connection of the thing if it is not open,
+// e.g. after it was lost. The observers registered on the previous connection
+// are kept and the events they observe are subscribed to again.
+//
+// @param ctx Context used to open the websocket connection
+func (t *Thing) Connect(ctx context.Context) error {
+	_, err := t.connect(ctx)
+	return err
+}
+
+// Close Close the websocket connection of the thing, if any. The observers
+// are kept until they are unsubscribed, and called again once the connection
+// is opened again.
+func (t *Thing) Close() error {
+	t.mu.Lock()
+	c := t.conn
+	t.conn = nil
+	t.mu.Unlock()
+
+	if c == nil {
+		return nil
+	}
+	return c.close()
+}
+
+// connect Return the websocket connection, opening it if necessary.
+func (t *Thing) connect(ctx context.Context) (*conn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil && !t.conn.closed() {
+		return t.conn, nil
+	}
+
+	href, ok := t.td.webSocketHref()
+	if !ok {
+		return nil, ErrNoHref
+	}
+	u, err := url.Parse(t.resolve(href))
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+
+	c, err := dial(ctx, t.client.Dialer, u.String(), t.observers, t.handleError)
+	if err != nil {
+		return nil, err
+	}
+	t.conn = c
+	return c, nil
+}
+
+func (t *Thing) handleError(err error) {
+	if t.ErrorHandler != nil {
+		t.ErrorHandler(err)
+	}
+}
+
+// propertyEndpoint Find the resolved endpoint of a property operation.
+func (t *Thing) propertyEndpoint(name, op string) (endpoint, error) {
+	affordance, ok := t.td.Properties[name]
+	if !ok {
+		return endpoint{}, ErrPropertyNotFound
+	}
+	ep, ok := affordance.href(op)
+	if !ok {
+		href, ok := t.td.link("properties")
+		if !ok {
+			return endpoint{}, ErrNoHref
+		}
+		ep = endpoint{href: href + "/" + url.PathEscape(name), wrapped: true}
+	}
+	ep.href = t.resolve(ep.href)
+	return ep, nil
+}
+
+// resolve Resolve an href against the base URL of the thing.
+func (t *Thing) resolve(href string) string {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return t.base.ResolveReference(ref).String()
+}
+
+// decodeActionStatus Decode an action description, which may be wrapped in
+// an object keyed by the action name.
+func decodeActionStatus(name string, raw json.RawMessage) *ActionStatus {
+	status := &ActionStatus{}
+	wrapped := map[string]*ActionStatus{}
+	if err := json.Unmarshal(raw, &wrapped); err == nil && wrapped[name] != nil {
+		status = wrapped[name]
+	} else {
+		json.Unmarshal(raw, status)
+	}
+	status.Name = name
+	return status
+}
@@ -0,0 +1,291 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subscription A registered observer of a remote thing.
+type Subscription struct {
+	once        sync.Once
+	unsubscribe func()
+}
+
+// Unsubscribe Stop calling the observer.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(s.unsubscribe)
+}
+
+// observers The observers of a remote thing. They are kept by the thing
+// rather than by a connection, so that they survive a reconnection.
+type observers struct {
+	mu       sync.Mutex
+	nextID   int
+	property map[string]map[int]func(interface{})
+	action   map[int]func(*ActionStatus)
+	event    map[string]map[int]func(*Event)
+}
+
+func newObservers() *observers {
+	return &observers{
+		property: map[string]map[int]func(interface{}){},
+		action:   map[int]func(*ActionStatus){},
+		event:    map[string]map[int]func(*Event){},
+	}
+}
+
+// conn A websocket connection to a remote thing.
+type conn struct {
+	ws        *websocket.Conn
+	writeMu   sync.Mutex
+	onError   func(error)
+	observers *observers
+
+	mu      sync.Mutex
+	closing bool
+	done    chan struct{}
+}
+
+type message struct {
+	MessageType string          `json:"messageType"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// dial Open a websocket connection, subscribe to the events that have
+// observers and start reading messages from it.
+func dial(ctx context.Context, dialer *websocket.Dialer, rawURL string, o *observers, onError func(error)) (*conn, error) {
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	ws, _, err := dialer.DialContext(ctx, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		ws:        ws,
+		onError:   onError,
+		observers: o,
+		done:      make(chan struct{}),
+	}
+	go c.read()
+
+	if names := o.events(); len(names) > 0 {
+		if err := c.send("addEventSubscription", names); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *conn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *conn) close() error {
+	c.mu.Lock()
+	c.closing = true
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	c.ws.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	return c.ws.Close()
+}
+
+// send Write a message of the Web Thing websocket protocol.
+func (c *conn) send(messageType string, data interface{}) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed() {
+		return ErrClosed
+	}
+	return c.ws.WriteJSON(message{MessageType: messageType, Data: content})
+}
+
+// read Dispatch incoming messages until the connection is closed. The
+// connection is marked closed before the error that ended it is reported, so
+// that the error handler can reconnect.
+func (c *conn) read() {
+	for {
+		var msg message
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			close(c.done)
+			c.mu.Lock()
+			closing := c.closing
+			c.mu.Unlock()
+			if !closing && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				c.onError(err)
+			}
+			return
+		}
+
+		switch msg.MessageType {
+		case "propertyStatus":
+			values := map[string]interface{}{}
+			if err := json.Unmarshal(msg.Data, &values); err != nil {
+				c.onError(err)
+				continue
+			}
+			for name, value := range values {
+				for _, observer := range c.observers.propertyObserversOf(name) {
+					observer(value)
+				}
+			}
+		case "actionStatus":
+			actions := map[string]*ActionStatus{}
+			if err := json.Unmarshal(msg.Data, &actions); err != nil {
+				c.onError(err)
+				continue
+			}
+			for name, action := range actions {
+				action.Name = name
+				for _, observer := range c.observers.actionObserversOf() {
+					observer(action)
+				}
+			}
+		case "event":
+			events := map[string]*Event{}
+			if err := json.Unmarshal(msg.Data, &events); err != nil {
+				c.onError(err)
+				continue
+			}
+			for name, event := range events {
+				event.Name = name
+				for _, observer := range c.observers.eventObserversOf(name) {
+					observer(event)
+				}
+			}
+		case "error":
+			protocolError := &ProtocolError{}
+			var data struct {
+				Status  string          `json:"status"`
+				Message string          `json:"message"`
+				Request json.RawMessage `json:"request"`
+			}
+			json.Unmarshal(msg.Data, &data)
+			protocolError.Status = data.Status
+			protocolError.Message = data.Message
+			protocolError.Request = data.Request
+			c.onError(protocolError)
+		}
+	}
+}
+
+func (o *observers) observeProperty(name string, handler func(interface{})) *Subscription {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := o.nextID
+	o.nextID++
+	if o.property[name] == nil {
+		o.property[name] = map[int]func(interface{}){}
+	}
+	o.property[name][id] = handler
+
+	return &Subscription{unsubscribe: func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.property[name], id)
+	}}
+}
+
+func (o *observers) observeActions(handler func(*ActionStatus)) *Subscription {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := o.nextID
+	o.nextID++
+	o.action[id] = handler
+
+	return &Subscription{unsubscribe: func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.action, id)
+	}}
+}
+
+// subscribeEvent Add an observer of an event, subscribing to the event over
+// the connection if it is the first one.
+func (o *observers) subscribeEvent(c *conn, name string, handler func(*Event)) (*Subscription, error) {
+	o.mu.Lock()
+	id := o.nextID
+	o.nextID++
+	first := len(o.event[name]) == 0
+	if o.event[name] == nil {
+		o.event[name] = map[int]func(*Event){}
+	}
+	o.event[name][id] = handler
+	o.mu.Unlock()
+
+	if first {
+		if err := c.send("addEventSubscription", map[string]interface{}{name: struct{}{}}); err != nil {
+			o.mu.Lock()
+			delete(o.event[name], id)
+			o.mu.Unlock()
+			return nil, err
+		}
+	}
+
+	return &Subscription{unsubscribe: func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.event[name], id)
+	}}, nil
+}
+
+// events Get the events that have observers, as the data of an
+// addEventSubscription message.
+func (o *observers) events() map[string]interface{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	names := map[string]interface{}{}
+	for name, observers := range o.event {
+		if len(observers) > 0 {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+func (o *observers) propertyObserversOf(name string) []func(interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	observers := make([]func(interface{}), 0, len(o.property[name]))
+	for _, observer := range o.property[name] {
+		observers = append(observers, observer)
+	}
+	return observers
+}
+
+func (o *observers) actionObserversOf() []func(*ActionStatus) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	observers := make([]func(*ActionStatus), 0, len(o.action))
+	for _, observer := range o.action {
+		observers = append(observers, observer)
+	}
+	return observers
+}
+
+func (o *observers) eventObserversOf(name string) []func(*Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	observers := make([]func(*Event), 0, len(o.event[name]))
+	for _, observer := range o.event[name] {
+		observers = append(observers, observer)
+	}
+	return observers
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// description The parts of a Thing Description or Thing Model that are
+// needed to generate code.
+type description struct {
+	ID          string                     `json:"id"`
+	Title       string                     `json:"title"`
+	Description string                     `json:"description"`
+	AtType      types                      `json:"@type"`
+	Properties  map[string]json.RawMessage `json:"properties"`
+	Actions     map[string]json.RawMessage `json:"actions"`
+	Events      map[string]json.RawMessage `json:"events"`
+}
+
+// schema A JSON schema as used by properties, action inputs and events.
+type schema struct {
+	Type        string             `json:"type"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	ReadOnly    bool               `json:"readOnly"`
+	Default     interface{}        `json:"default"`
+	Const       interface{}        `json:"const"`
+	Items       *schema            `json:"items"`
+	Properties  map[string]*schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Input       *schema            `json:"input"`
+	Data        *schema            `json:"data"`
+}
+
+// types A list of strings that may be encoded as a single string.
+type types []string
+
+func (t *types) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = types{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// options Options of the generated code.
+type options struct {
+	Package string
+	Type    string
+	Source  string
+}
+
+type thingData struct {
+	options
+	Title       string
+	Description string
+	AtType      []string
+	Properties  []propertyData
+	Actions     []actionData
+	Events      []eventData
+}
+
+type propertyData struct {
+	Name     string
+	GoName   string
+	GoType   string
+	Doc      string
+	ReadOnly bool
+	Initial  string
+	Metadata string
+}
+
+type actionData struct {
+	Name     string
+	GoName   string
+	Doc      string
+	Input    string
+	Fields   []fieldData
+	Metadata string
+}
+
+type fieldData struct {
+	Name     string
+	GoName   string
+	GoType   string
+	Required bool
+}
+
+type eventData struct {
+	Name     string
+	GoName   string
+	Doc      string
+	GoType   string
+	Metadata string
+}
+
+// generate Generate Go source code from a Thing Description or Thing Model.
+//
+// @param src  The JSON document
+// @param opts Options of the generated code
+// @return The formatted source code.
+func generate(src []byte, opts options) ([]byte, error) {
+	var td description
+	if err := json.Unmarshal(src, &td); err != nil {
+		return nil, err
+	}
+	if td.Title == "" && opts.Type == "" {
+		return nil, errors.New("the description has no title, use -type to name the generated type")
+	}
+	if opts.Type == "" {
+		opts.Type = goName(td.Title)
+	}
+
+	data := &thingData{
+		options:     opts,
+		Title:       td.Title,
+		Description: td.Description,
+	}
+	for _, t := range td.AtType {
+		// Thing Model annotations are not semantic types of the thing.
+		if !strings.HasPrefix(t, "tm:") {
+			data.AtType = append(data.AtType, t)
+		}
+	}
+
+	methods := thingMethods()
+	for _, name := range sortedKeys(td.Properties) {
+		s, metadata, err := parseAffordance(td.Properties[name])
+		if err != nil {
+			return nil, fmt.Errorf("property %q: %v", name, err)
+		}
+		initial := s.Default
+		if s.Const != nil {
+			initial = s.Const
+		}
+		// Accessors must not shadow the methods of the embedded thing, e.g.
+		// Title for a property named title.
+		goPropertyName := goName(name)
+		setter := "Set"
+		if s.ReadOnly {
+			setter = "Update"
+		}
+		if methods[goPropertyName] || methods[setter+goPropertyName] {
+			goPropertyName += "Property"
+		}
+		for _, method := range []string{goPropertyName, setter + goPropertyName} {
+			if methods[method] {
+				return nil, fmt.Errorf("property %q: method %s is already defined", name, method)
+			}
+			methods[method] = true
+		}
+		data.Properties = append(data.Properties, propertyData{
+			Name:     name,
+			GoName:   goPropertyName,
+			GoType:   goType(s),
+			Doc:      doc(s),
+			ReadOnly: s.ReadOnly,
+			Initial:  goValue(s, initial),
+			Metadata: metadata,
+		})
+	}
+
+	handlers := map[string]bool{}
+	for _, name := range sortedKeys(td.Actions) {
+		s, metadata, err := parseAffordance(td.Actions[name])
+		if err != nil {
+			return nil, fmt.Errorf("action %q: %v", name, err)
+		}
+		if handlers[goName(name)] {
+			return nil, fmt.Errorf("action %q: method %s is already defined", name, goName(name))
+		}
+		handlers[goName(name)] = true
+		action := actionData{
+			Name:     name,
+			GoName:   goName(name),
+			Doc:      doc(s),
+			Metadata: metadata,
+		}
+		if s.Input != nil {
+			if s.Input.Type == "object" && len(s.Input.Properties) > 0 {
+				action.Input = opts.Type + action.GoName + "Input"
+				for _, field := range sortedKeys(s.Input.Properties) {
+					action.Fields = append(action.Fields, fieldData{
+						Name:     field,
+						GoName:   goName(field),
+						GoType:   goType(s.Input.Properties[field]),
+						Required: contains(s.Input.Required, field),
+					})
+				}
+			} else {
+				action.Input = goType(s.Input)
+			}
+		}
+		data.Actions = append(data.Actions, action)
+	}
+
+	for _, name := range sortedKeys(td.Events) {
+		s, metadata, err := parseAffordance(td.Events[name])
+		if err != nil {
+			return nil, fmt.Errorf("event %q: %v", name, err)
+		}
+		if methods["Emit"+goName(name)] {
+			return nil, fmt.Errorf("event %q: method Emit%s is already defined", name, goName(name))
+		}
+		methods["Emit"+goName(name)] = true
+		event := eventData{
+			Name:     name,
+			GoName:   goName(name),
+			Doc:      doc(s),
+			Metadata: metadata,
+		}
+		// Thing Descriptions describe the event data with a data schema,
+		// the Web Thing API inlines it into the event.
+		if s.Data != nil {
+			event.GoType = goType(s.Data)
+		} else if s.Type != "" {
+			event.GoType = goType(s)
+		}
+		data.Events = append(data.Events, event)
+	}
+
+	var buf bytes.Buffer
+	if err := thingTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return out, nil
+}
+
+// parseAffordance Decode the schema of an affordance and return its metadata
+// without forms and links, which are generated by the server.
+func parseAffordance(raw json.RawMessage) (*schema, string, error) {
+	s := &schema{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, "", err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, "", err
+	}
+	delete(m, "forms")
+	delete(m, "links")
+	metadata, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	return s, string(metadata), nil
+}
+
+// thingMethods Get the names of the methods of a generated thing that are
+// not generated for its affordances: those of the embedded thing and the
+// helpers of the generated type.
+func thingMethods() map[string]bool {
+	methods := map[string]bool{"convert": true}
+	t := reflect.TypeOf(&webthing.Thing{})
+	for i := 0; i < t.NumMethod(); i++ {
+		methods[t.Method(i).Name] = true
+	}
+	return methods
+}
+
+// goType Map a JSON schema to a Go type.
+func goType(s *schema) string {
+	if s == nil {
+		return "interface{}"
+	}
+	switch s.Type {
+	case "boolean":
+		return "bool"
+	case "integer":
+		return "int"
+	case "number":
+		return "float64"
+	case "string":
+		return "string"
+	case "array":
+		return "[]" + goType(s.Items)
+	case "object":
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+// goValue Format the initial value of a property as a Go expression.
+func goValue(s *schema, v interface{}) string {
+	if v == nil {
+		switch goType(s) {
+		case "bool":
+			return "false"
+		case "int":
+			return "0"
+		case "float64":
+			return "0.0"
+		case "string":
+			return `""`
+		case "interface{}":
+			return "nil"
+		}
+		return goType(s) + "{}"
+	}
+	return goLiteral(s, v)
+}
+
+// goLiteral Format a JSON value as a Go expression of the type of its
+// schema, with nested values of unknown type as decoded from JSON.
+func goLiteral(s *schema, v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if s != nil && s.Type == "integer" {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		f := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(f, ".eE") {
+			f += ".0"
+		}
+		return f
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		t, items := "[]interface{}", (*schema)(nil)
+		if s != nil && s.Type == "array" {
+			t, items = goType(s), s.Items
+		}
+		elements := make([]string, len(v))
+		for i, item := range v {
+			elements[i] = goLiteral(items, item)
+		}
+		return t + "{" + strings.Join(elements, ", ") + "}"
+	case map[string]interface{}:
+		var properties map[string]*schema
+		if s != nil {
+			properties = s.Properties
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		members := make([]string, len(keys))
+		for i, key := range keys {
+			members[i] = strconv.Quote(key) + ": " + goLiteral(properties[key], v[key])
+		}
+		return "map[string]interface{}{" + strings.Join(members, ", ") + "}"
+	}
+	return "nil"
+}
+
+// goName Convert a name to an exported Go identifier.
+func goName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	if s == "" || unicode.IsDigit(rune(s[0])) {
+		s = "X" + s
+	}
+	return s
+}
+
+// doc Get the text describing a schema on a single line.
+func doc(s *schema) string {
+	text := s.Description
+	if text == "" {
+		text = s.Title
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// literal Quote a string as a raw string literal when possible.
+func literal(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]json.RawMessage:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*schema:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var thingTemplate = template.Must(template.New("thing").Funcs(template.FuncMap{
+	"literal": literal,
+	"quote":   strconv.Quote,
+}).Parse(`// Code generated by webthing-gen{{if .Source}} from {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"encoding/json"
+
+	"github.com/dravenk/webthing-go"
+{{- if .Actions}}
+	"github.com/google/uuid"
+{{- end}}
+)
+
+{{$t := .Type -}}
+// {{$t}} {{if .Description}}{{.Description}}{{else}}{{.Title}}{{end}}
+type {{$t}} struct {
+	*webthing.Thing
+}
+{{if .Actions}}
+// {{$t}}Handlers Perform the actions of a {{$t}}.
+type {{$t}}Handlers interface {
+{{- range .Actions}}
+	// {{.GoName}} {{if .Doc}}{{.Doc}}{{else}}Perform the {{.Name}} action.{{end}}
+	{{.GoName}}(thing *{{$t}}, action *webthing.Action{{if .Input}}, input {{.Input}}{{end}})
+{{- end}}
+}
+{{end}}
+// New{{$t}} Create a {{$t}} and register its properties, actions and events.
+//
+// @param id       ID of the thing
+{{- if .Actions}}
+// @param handlers Implementation of the actions
+func New{{$t}}(id string, handlers {{$t}}Handlers) *{{$t}} {
+{{- else}}
+func New{{$t}}(id string) *{{$t}} {
+{{- end}}
+	thing := &{{$t}}{webthing.NewThing(id,
+		{{quote .Title}},
+		[]string{ {{- range $i, $v := .AtType}}{{if $i}}, {{end}}{{quote $v}}{{end -}} },
+		{{quote .Description}})}
+{{range .Properties}}
+	thing.AddProperty(webthing.NewProperty(thing.Thing,
+		{{quote .Name}},
+		webthing.NewValue({{.Initial}}),
+		[]byte({{literal .Metadata}})))
+{{end -}}
+{{range .Actions}}
+	thing.AddAvailableAction({{quote .Name}},
+		[]byte({{literal .Metadata}}),
+		&{{$t}}{{.GoName}}Action{thing: thing, handlers: handlers})
+{{end -}}
+{{range .Events}}
+	thing.AddAvailableEvent({{quote .Name}},
+		[]byte({{literal .Metadata}}))
+{{end}}
+	return thing
+}
+{{range .Properties}}
+// {{.GoName}} Get the current value of the {{.Name}} property.
+{{- if .Doc}}
+//
+// {{.Doc}}
+{{- end}}
+func (t *{{$t}}) {{.GoName}}() {{.GoType}} {
+	var v {{.GoType}}
+	t.convert(t.Thing.Property({{quote .Name}}).Get(), &v)
+	return v
+}
+{{if .ReadOnly}}
+// Update{{.GoName}} Report a new value of the read-only {{.Name}} property.
+func (t *{{$t}}) Update{{.GoName}}(v {{.GoType}}) {
+	t.Thing.Property({{quote .Name}}).NotifyOfExternalUpdate(v)
+}
+{{else}}
+// Set{{.GoName}} Set a new value of the {{.Name}} property.
+func (t *{{$t}}) Set{{.GoName}}(v {{.GoType}}) error {
+	value := webthing.NewValue(v)
+	return t.Thing.SetProperty({{quote .Name}}, &value)
+}
+{{end -}}
+{{end -}}
+{{range .Actions}}
+{{- if .Fields}}
+// {{.Input}} Input of the {{.Name}} action.
+type {{.Input}} struct {
+{{- range .Fields}}
+	{{.GoName}} {{.GoType}} ` + "`" + `json:"{{.Name}}{{if not .Required}},omitempty{{end}}"` + "`" + `
+{{- end}}
+}
+{{end}}
+// {{$t}}{{.GoName}}Action {{if .Doc}}{{.Doc}}{{else}}The {{.Name}} action.{{end}}
+type {{$t}}{{.GoName}}Action struct {
+	*webthing.Action
+	thing    *{{$t}}
+	handlers {{$t}}Handlers
+}
+
+// Generator Create a new {{.Name}} action.
+func (a *{{$t}}{{.GoName}}Action) Generator(thing *webthing.Thing) *webthing.Action {
+	action := &{{$t}}{{.GoName}}Action{thing: a.thing, handlers: a.handlers}
+	action.Action = webthing.NewAction(uuid.New().String(), thing, {{quote .Name}}, nil, action.PerformAction, action.Cancel)
+	return action.Action
+}
+
+// PerformAction Perform the {{.Name}} action.
+func (a *{{$t}}{{.GoName}}Action) PerformAction() *webthing.Action {
+{{- if .Input}}
+	var input {{.Input}}
+	if raw := a.Input(); raw != nil {
+		if err := json.Unmarshal(*raw, &input); err != nil {
+			// The action fails.
+			panic("Invalid {{.Name}} action input: " + err.Error())
+		}
+	}
+	a.handlers.{{.GoName}}(a.thing, a.Action, input)
+{{- else}}
+	a.handlers.{{.GoName}}(a.thing, a.Action)
+{{- end}}
+	return a.Action
+}
+
+// Cancel Cancel the {{.Name}} action.
+func (a *{{$t}}{{.GoName}}Action) Cancel() {}
+{{end -}}
+{{range .Events}}
+// Emit{{.GoName}} Emit the {{.Name}} event.
+{{- if .Doc}}
+//
+// {{.Doc}}
+{{- end}}
+func (t *{{$t}}) Emit{{.GoName}}({{if .GoType}}data {{.GoType}}{{end}}) {
+{{- if .GoType}}
+	content, _ := json.Marshal(data)
+	t.AddEvent(webthing.NewEvent(t.Thing, {{quote .Name}}, content))
+{{- else}}
+	t.AddEvent(webthing.NewEvent(t.Thing, {{quote .Name}}, nil))
+{{- end}}
+}
+{{end}}
+// convert Convert a property value into the declared Go type.
+func (t *{{$t}}) convert(value interface{}, v interface{}) {
+	content, err := json.Marshal(value)
+	if err == nil {
+		json.Unmarshal(content, v)
+	}
+}
+
+`))
@@ -0,0 +1,60 @@
+// Command webthing-gen generates typed Go code from a Thing Description or a
+// Thing Model.
+//
+// Usage:
+//
+//	webthing-gen [-pkg name] [-type name] [-o file] description.json
+//
+// The generated code contains a type embedding *webthing.Thing with typed
+// property accessors, input structs and handlers for actions, emitters for
+// events, and a constructor registering all of them with the thing.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	pkg := flag.String("pkg", "main", "package name of the generated code")
+	typeName := flag.String("type", "", "name of the generated thing type (default derived from the title)")
+	output := flag.String("o", "", "output file (default stdout)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: webthing-gen [flags] description.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code, err := generate(src, options{
+		Package: *pkg,
+		Type:    *typeName,
+		Source:  filepath.Base(flag.Arg(0)),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(code)
+		return
+	}
+	if err := ioutil.WriteFile(*output, code, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
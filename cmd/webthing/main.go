@@ -0,0 +1,216 @@
+// Command webthing serves simulated things from description files.
+//
+// Usage:
+//
+//	webthing serve [-addr :8888] [-base-path path] [-name name] [-ui]
+//	    [-directory url [-public-url url]] [-rules rules.json]
+//	    [-schedules dir] thing.json...
+//
+// Description files are JSON or YAML documents as understood by
+// webthing.LoadThingsFile. Properties, actions and events may carry a
+// "simulate" key describing their simulated behaviour:
+//
+//	properties:
+//	  level:
+//	    type: number
+//	    simulate: {mode: sine, period: 1m, interval: 1s}
+//	actions:
+//	  fade:
+//	    simulate: {duration: 2s}
+//	events:
+//	  overheated:
+//	    simulate: {every: 30s, data: 102}
+//
+// Numeric properties support the modes "random-walk" (the default, with
+// "step", "min" and "max") and "sine" (with "period"), boolean properties
+// the mode "toggle". Durations are Go duration strings or seconds.
+//
+// Rules of a -rules file, a JSON array as understood by rules.Engine.Load,
+// automate the things and are managed at /rules. With -schedules, property
+// writes and actions are scheduled at /schedules below each thing and saved
+// in the given directory.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/dashboard"
+	"github.com/dravenk/webthing-go/directory"
+	"github.com/dravenk/webthing-go/rules"
+	"github.com/dravenk/webthing-go/schedule"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "serve" {
+		fmt.Fprintln(os.Stderr, "Usage: webthing serve [flags] thing.json...")
+		os.Exit(2)
+	}
+
+	var cfg config
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&cfg.addr, "addr", ":8888", "address to listen on")
+	flags.StringVar(&cfg.basePath, "base-path", "", "base URL path of the things")
+	flags.StringVar(&cfg.name, "name", "webthing", "server name when serving multiple things")
+	flags.BoolVar(&cfg.ui, "ui", false, "serve a dashboard at /ui below each thing")
+	flags.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 10*time.Second, "time to wait for running actions on shutdown")
+	flags.StringVar(&cfg.directoryURL, "directory", "", "URL of a thing directory to register the things with")
+	flags.StringVar(&cfg.publicURL, "public-url", "", "URL the things are reached at, registered with the directory (default http://localhost<addr><base-path>)")
+	flags.StringVar(&cfg.rulesPath, "rules", "", "JSON file of rules automating the things")
+	flags.StringVar(&cfg.schedulesDir, "schedules", "", "directory saving the schedules of the things, enabling /schedules")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: webthing serve [flags] thing.json...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[2:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cfg.paths = flags.Args()
+
+	if err := serve(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// config The configuration of the serve command, set by its flags.
+type config struct {
+	// paths The description files of the things.
+	paths []string
+
+	addr            string
+	basePath        string
+	name            string
+	ui              bool
+	shutdownTimeout time.Duration
+
+	// directoryURL, publicURL The thing directory to register the things
+	// with and the URL they are registered at.
+	directoryURL string
+	publicURL    string
+
+	rulesPath    string
+	schedulesDir string
+}
+
+// serve Load the things of the configured files and serve them until the
+// process is interrupted.
+func serve(cfg config) error {
+	var things []*webthing.Thing
+	var simulations []*simulation
+
+	for _, path := range cfg.paths {
+		definitions, err := webthing.ParseThingDefinitionsFile(path)
+		if err != nil {
+			return err
+		}
+		for _, definition := range definitions {
+			registry := webthing.NewRegistry()
+			sim, err := prepare(definition, registry)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", path, definition.Line(), err)
+			}
+			thing, err := definition.Build(registry)
+			if err != nil {
+				return err
+			}
+			things = append(things, thing)
+			simulations = append(simulations, sim)
+		}
+	}
+
+	var container webthing.ThingsType
+	if len(things) == 1 {
+		container = webthing.NewSingleThing(things[0])
+	} else {
+		container = webthing.NewMultipleThings(things, cfg.name)
+	}
+
+	server := webthing.NewWebThingServer(container, &http.Server{Addr: cfg.addr}, cfg.basePath)
+	if cfg.ui {
+		dashboard.MountAll(server)
+	}
+	engine := rules.New(things)
+	defer engine.Close()
+	if cfg.rulesPath != "" {
+		if err := engine.LoadFile(cfg.rulesPath); err != nil {
+			return fmt.Errorf("%s: %v", cfg.rulesPath, err)
+		}
+	}
+	engine.Mount(server)
+	if cfg.schedulesDir != "" {
+		store, err := schedule.NewFileStore(cfg.schedulesDir)
+		if err != nil {
+			return err
+		}
+		for _, thing := range things {
+			scheduler, err := schedule.New(thing, schedule.WithStore(store))
+			if err != nil {
+				return err
+			}
+			defer scheduler.Close()
+			scheduler.Mount(server)
+		}
+	}
+	for i, thing := range things {
+		simulations[i].start(thing)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Start()
+	}()
+	log.Printf("Serving %d thing(s) on %s", len(things), cfg.addr)
+
+	announced := make(chan struct{})
+	announceCtx, stopAnnounce := context.WithCancel(context.Background())
+	defer stopAnnounce()
+	if cfg.directoryURL != "" {
+		if cfg.publicURL == "" {
+			cfg.publicURL = localURL(cfg.addr, cfg.basePath)
+		}
+		go func() {
+			directory.Announce(announceCtx, server, cfg.directoryURL, cfg.publicURL, 0)
+			close(announced)
+		}()
+	} else {
+		close(announced)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return err
+	case <-signals:
+	}
+
+	log.Print("Shutting down")
+	stopAnnounce()
+	<-announced
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// localURL Get the URL of a server listening on addr from this host.
+func localURL(addr, basePath string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr + basePath
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + basePath
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/google/uuid"
+)
+
+// duration A duration given as a Go duration string or as seconds.
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*d = duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = duration(parsed)
+	default:
+		return errors.New("invalid duration")
+	}
+	return nil
+}
+
+// propertySimulation How a property changes over time.
+type propertySimulation struct {
+	// Mode One of "random-walk", "sine" and "toggle".
+	Mode     string   `json:"mode"`
+	Interval duration `json:"interval"`
+	Step     float64  `json:"step"`
+	Period   duration `json:"period"`
+	Min      *float64 `json:"min"`
+	Max      *float64 `json:"max"`
+
+	name    string
+	integer bool
+}
+
+// actionSimulation How long an action takes.
+type actionSimulation struct {
+	Duration duration `json:"duration"`
+}
+
+// eventSimulation How often an event is emitted.
+type eventSimulation struct {
+	Every duration    `json:"every"`
+	Data  interface{} `json:"data"`
+
+	name string
+}
+
+// simulation The simulated behaviour of a thing.
+type simulation struct {
+	properties []*propertySimulation
+	events     []*eventSimulation
+}
+
+// prepare Extract the "simulate" keys from a definition and register
+// simulated actions for all of its actions.
+func prepare(definition *webthing.ThingDefinition, registry *webthing.Registry) (*simulation, error) {
+	sim := &simulation{}
+
+	for name, property := range definition.Properties {
+		raw, ok := property.Metadata["simulate"]
+		delete(property.Metadata, "simulate")
+		if !ok {
+			continue
+		}
+
+		var schema struct {
+			Type    string   `json:"type"`
+			Minimum *float64 `json:"minimum"`
+			Maximum *float64 `json:"maximum"`
+		}
+		if err := convert(property.Metadata, &schema); err != nil {
+			return nil, fmt.Errorf("property %q: %v", name, err)
+		}
+		p := &propertySimulation{
+			name:     name,
+			integer:  schema.Type == "integer",
+			Min:      schema.Minimum,
+			Max:      schema.Maximum,
+			Interval: duration(time.Second),
+			Period:   duration(time.Minute),
+		}
+		if schema.Type == "boolean" {
+			p.Mode = "toggle"
+		} else {
+			p.Mode = "random-walk"
+		}
+		if err := convert(raw, p); err != nil {
+			return nil, fmt.Errorf("property %q: simulate: %v", name, err)
+		}
+		if p.Min == nil {
+			p.Min = new(float64)
+		}
+		if p.Max == nil {
+			max := 100.0
+			p.Max = &max
+		}
+		if p.Step == 0 {
+			p.Step = (*p.Max - *p.Min) / 20
+		}
+		switch p.Mode {
+		case "random-walk", "sine", "toggle":
+		default:
+			return nil, fmt.Errorf("property %q: unknown simulation mode %q", name, p.Mode)
+		}
+		if p.Interval <= 0 {
+			return nil, fmt.Errorf("property %q: simulate: interval must be positive", name)
+		}
+		sim.properties = append(sim.properties, p)
+	}
+
+	for name, action := range definition.Actions {
+		a := &actionSimulation{}
+		if raw, ok := action.Metadata["simulate"]; ok {
+			if err := convert(raw, a); err != nil {
+				return nil, fmt.Errorf("action %q: simulate: %v", name, err)
+			}
+			delete(action.Metadata, "simulate")
+		}
+		action.Handler = name
+		registry.RegisterAction(name, &simulatedAction{name: name, duration: time.Duration(a.Duration)})
+	}
+
+	for name, event := range definition.Events {
+		raw, ok := event.Metadata["simulate"]
+		delete(event.Metadata, "simulate")
+		if !ok {
+			continue
+		}
+		e := &eventSimulation{name: name}
+		if err := convert(raw, e); err != nil {
+			return nil, fmt.Errorf("event %q: simulate: %v", name, err)
+		}
+		if e.Every <= 0 {
+			return nil, fmt.Errorf("event %q: simulate: every must be positive", name)
+		}
+		sim.events = append(sim.events, e)
+	}
+
+	return sim, nil
+}
+
+// start Run the simulation of a thing in the background.
+func (sim *simulation) start(thing *webthing.Thing) {
+	for _, p := range sim.properties {
+		go p.run(thing.Property(p.name))
+	}
+	for _, e := range sim.events {
+		go e.run(thing)
+	}
+}
+
+func (p *propertySimulation) run(value *webthing.Value) {
+	start := time.Now()
+	current, _ := value.Get().(float64)
+	if i, ok := value.Get().(int); ok {
+		current = float64(i)
+	}
+
+	for range time.Tick(time.Duration(p.Interval)) {
+		switch p.Mode {
+		case "toggle":
+			on, _ := value.Get().(bool)
+			value.NotifyOfExternalUpdate(!on)
+			continue
+		case "sine":
+			amplitude := (*p.Max - *p.Min) / 2
+			phase := 2 * math.Pi * time.Since(start).Seconds() / time.Duration(p.Period).Seconds()
+			current = *p.Min + amplitude + amplitude*math.Sin(phase)
+		case "random-walk":
+			current += (rand.Float64()*2 - 1) * p.Step
+			current = math.Max(*p.Min, math.Min(*p.Max, current))
+		}
+
+		if p.integer {
+			value.NotifyOfExternalUpdate(int(math.Round(current)))
+		} else {
+			value.NotifyOfExternalUpdate(current)
+		}
+	}
+}
+
+func (e *eventSimulation) run(thing *webthing.Thing) {
+	for range time.Tick(time.Duration(e.Every)) {
+		var data []byte
+		if e.Data != nil {
+			data, _ = json.Marshal(e.Data)
+		}
+		thing.AddEvent(webthing.NewEvent(thing, e.name, data))
+	}
+}
+
+// simulatedAction An action that completes after a fixed duration.
+type simulatedAction struct {
+	*webthing.Action
+	name     string
+	duration time.Duration
+	cancel   chan struct{}
+}
+
+// Generator Create a new simulated action.
+func (a *simulatedAction) Generator(thing *webthing.Thing) *webthing.Action {
+	action := &simulatedAction{name: a.name, duration: a.duration, cancel: make(chan struct{})}
+	action.Action = webthing.NewAction(uuid.New().String(), thing, a.name, nil, action.PerformAction, action.Cancel)
+	return action.Action
+}
+
+// PerformAction Wait for the configured duration.
+func (a *simulatedAction) PerformAction() *webthing.Action {
+	select {
+	case <-time.After(a.duration):
+	case <-a.cancel:
+	}
+	return a.Action
+}
+
+// Cancel Stop waiting.
+func (a *simulatedAction) Cancel() {
+	close(a.cancel)
+}
+
+// convert Decode a value decoded from a definition into v.
+func convert(value interface{}, v interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
@@ -0,0 +1,676 @@
+// Package coap serves Web Things over CoAP (RFC 7252) for constrained
+// clients.
+//
+// The resources mirror the HTTP API below the href of each thing:
+//
+//	GET                /                        Thing Description
+//	GET                /properties              values of all properties
+//	GET, PUT           /properties/<name>       value of a property
+//	GET, POST          /actions                 action requests
+//	GET, POST          /actions/<name>          requests of an action
+//	GET, DELETE        /actions/<name>/<id>     an action request
+//	GET                /events                  emitted events
+//	GET                /events/<name>           emitted events of a kind
+//
+// Properties and events can be observed (RFC 7641). A notification of an
+// event resource carries the single event that was emitted. Payloads are
+// JSON or CBOR, chosen by the Content-Format and Accept options, and large
+// responses are sent in blocks (RFC 7959). The matching forms are added to
+// the Thing Description.
+//
+//	server := coap.NewServer()
+//	server.Bind(thing)
+//	go server.ListenAndServe(":5683")
+package coap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// DefaultBlockSize Largest payload sent in one datagram unless WithBlockSize
+// is given.
+const DefaultBlockSize = 1024
+
+// DefaultMaxRequests Number of requests handled concurrently unless
+// WithMaxRequests is given.
+const DefaultMaxRequests = 64
+
+// exchangeLifetime Time a confirmable request may be retransmitted for,
+// RFC 7252 section 4.8.2.
+const exchangeLifetime = 247 * time.Second
+
+// Server Serve things over CoAP.
+type Server struct {
+	baseURL   string
+	blockSize int
+
+	// requests Limits the requests handled concurrently.
+	requests chan struct{}
+
+	mu        sync.Mutex
+	conn      net.PacketConn
+	things    map[string]*webthing.Thing
+	described map[*webthing.Thing]bool
+	observers map[string][]*observer
+	exchanges map[string]*exchange
+	messageID uint32
+	sequence  uint32
+	closed    bool
+}
+
+// observer A client observing a resource.
+type observer struct {
+	addr      net.Addr
+	token     []byte
+	format    uint32
+	messageID uint16
+}
+
+// exchange The response to a confirmable request, resent when the request
+// is retransmitted.
+type exchange struct {
+	response []byte
+	at       time.Time
+}
+
+// Option Configure a server.
+type Option func(*Server)
+
+// WithBaseURL Use the given URL in the forms of the Thing Description, e.g.
+// when clients reach the server at another address. By default the address
+// the server listens on is used.
+//
+// @param url URL of the server, e.g. "coap://lamp.local:5683"
+func WithBaseURL(url string) Option {
+	return func(s *Server) {
+		s.baseURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithBlockSize Send payloads larger than size in blocks.
+//
+// @param size 16, 32, 64, 128, 256, 512 or 1024
+func WithBlockSize(size int) Option {
+	return func(s *Server) {
+		s.blockSize = size
+	}
+}
+
+// WithMaxRequests Handle at most n requests concurrently. Further datagrams
+// wait in the buffer of the connection.
+//
+// @param n The number of requests
+func WithMaxRequests(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.requests = make(chan struct{}, n)
+		}
+	}
+}
+
+// NewServer Create a CoAP server.
+//
+// @param opts Options
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		blockSize: DefaultBlockSize,
+		things:    make(map[string]*webthing.Thing),
+		described: make(map[*webthing.Thing]bool),
+		observers: make(map[string][]*observer),
+		exchanges: make(map[string]*exchange),
+		messageID: rand.Uint32(),
+		requests:  make(chan struct{}, DefaultMaxRequests),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Bind Serve a thing below its href.
+//
+// @param thing The thing
+func (s *Server) Bind(thing *webthing.Thing) error {
+	base := strings.Trim(thing.Href(), "/")
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("server is closed")
+	}
+	if _, ok := s.things[base]; ok {
+		s.mu.Unlock()
+		return errors.New("a thing is already bound to /" + base)
+	}
+	s.things[base] = thing
+	baseURL := s.url()
+	s.mu.Unlock()
+
+	thing.OnPropertyNotify(func(property *webthing.Property) {
+		name := property.Name()
+		s.notify(join(base, "properties", name), map[string]interface{}{name: property.Value().Get()})
+		s.notify(join(base, "properties"), thing.Properties())
+	})
+	thing.OnEvent(func(event *webthing.Event) {
+		description := json.RawMessage(event.AsEventDescription())
+		s.notify(join(base, "events", event.Name()), description)
+		s.notify(join(base, "events"), description)
+	})
+
+	if baseURL != "" {
+		s.describe(thing, baseURL)
+	}
+	return nil
+}
+
+// ListenAndServe Listen on a UDP address and serve requests.
+//
+// @param addr Address to listen on, e.g. ":5683"
+func (s *Server) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve Serve requests received on a connection until the server is closed.
+//
+// @param conn The connection
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("server is closed")
+	}
+	s.conn = conn
+	baseURL := s.url()
+	var things []*webthing.Thing
+	for _, thing := range s.things {
+		things = append(things, thing)
+	}
+	s.mu.Unlock()
+
+	for _, thing := range things {
+		s.describe(thing, baseURL)
+	}
+
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+		msg, err := parse(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.requests <- struct{}{}
+		go func() {
+			defer func() { <-s.requests }()
+			s.receive(addr, msg)
+		}()
+	}
+}
+
+// Close Stop serving and drop all observers.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.observers = make(map[string][]*observer)
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// receive Handle a message of a client.
+func (s *Server) receive(addr net.Addr, msg *message) {
+	switch {
+	case msg.typ == Reset:
+		s.forget(addr, msg.messageID)
+		return
+	case msg.typ == Acknowledgement || msg.code == Empty:
+		return
+	case msg.code > DELETE:
+		return
+	}
+
+	key := addr.String() + "/" + strconv.Itoa(int(msg.messageID))
+	if msg.typ == Confirmable {
+		s.mu.Lock()
+		if ex, ok := s.exchanges[key]; ok {
+			s.mu.Unlock()
+			// A retransmission; resend the response unless it is pending.
+			if ex.response != nil {
+				s.send(addr, ex.response)
+			}
+			return
+		}
+		now := time.Now()
+		for k, ex := range s.exchanges {
+			if now.Sub(ex.at) > exchangeLifetime {
+				delete(s.exchanges, k)
+			}
+		}
+		s.exchanges[key] = &exchange{at: now}
+		s.mu.Unlock()
+	}
+
+	response := s.respond(addr, msg)
+	if msg.typ == Confirmable {
+		response.typ = Acknowledgement
+		response.messageID = msg.messageID
+	} else {
+		response.typ = NonConfirmable
+		response.messageID = s.nextMessageID()
+	}
+	data := response.encode()
+
+	if msg.typ == Confirmable {
+		s.mu.Lock()
+		if ex, ok := s.exchanges[key]; ok {
+			ex.response = data
+		}
+		s.mu.Unlock()
+	}
+	s.send(addr, data)
+}
+
+// respond Build the response to a request.
+func (s *Server) respond(addr net.Addr, req *message) *message {
+	response := &message{token: req.token}
+
+	format := FormatJSON
+	if f, ok := req.uintOption(optionContentFormat); ok {
+		format = f
+	}
+	if format != FormatJSON && format != FormatCBOR {
+		response.code = UnsupportedContentFormat
+		return response
+	}
+	accept := format
+	if f, ok := req.uintOption(optionAccept); ok {
+		accept = f
+	}
+	if accept != FormatJSON && accept != FormatCBOR {
+		response.code = NotAcceptable
+		return response
+	}
+
+	body, err := toJSON(req.payload, format)
+	if err != nil {
+		response.code = BadRequest
+		return response
+	}
+
+	path := strings.Trim(req.path(), "/")
+	code, content, observable := s.route(req.code, path, body)
+
+	if observable && code == Content {
+		if observe, ok := req.uintOption(optionObserve); ok {
+			switch observe {
+			case 0:
+				s.observe(path, &observer{addr: addr, token: req.token, format: accept})
+				response.setUintOption(optionObserve, s.nextSequence())
+			case 1:
+				s.unobserve(path, addr, req.token)
+			}
+		}
+	}
+
+	response.code = code
+	if content == nil {
+		return response
+	}
+	payload, err := fromJSON(content, accept)
+	if err != nil {
+		response.code = InternalServerError
+		return response
+	}
+	response.setUintOption(optionContentFormat, accept)
+
+	num, _, size, ok := req.block()
+	if !ok {
+		num, size = 0, s.blockSize
+	}
+	if size > s.blockSize {
+		size = s.blockSize
+	}
+	if ok || len(payload) > size {
+		start := int(num) * size
+		if start >= len(payload) && start > 0 {
+			return &message{token: req.token, code: BadOption}
+		}
+		end := start + size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		response.setBlock(num, end < len(payload), size)
+		response.setUintOption(optionSize2, uint32(len(payload)))
+		payload = payload[start:end]
+	}
+	response.payload = payload
+	return response
+}
+
+// route Handle a request to a resource. The request and response bodies
+// are JSON. Properties and events are observable.
+func (s *Server) route(method Code, path string, body []byte) (code Code, content []byte, observable bool) {
+	thing, rest, ok := s.lookup(path)
+	if !ok {
+		if path != "" || method != GET {
+			return NotFound, nil, false
+		}
+		return Content, s.descriptions(), false
+	}
+	log := thing.Logger()
+	affordances := affordancesOf(thing)
+
+	switch {
+	case len(rest) == 0:
+		if method != GET {
+			return MethodNotAllowed, nil, false
+		}
+		return Content, thing.AsThingDescription(), false
+
+	case rest[0] == "properties" && len(rest) == 1:
+		if method != GET {
+			return MethodNotAllowed, nil, false
+		}
+		return Content, marshal(thing.Properties()), true
+
+	case rest[0] == "properties" && len(rest) == 2:
+		name := rest[1]
+		if !thing.HasProperty(name) {
+			return NotFound, nil, false
+		}
+		switch method {
+		case GET:
+			return Content, marshal(map[string]interface{}{name: thing.Property(name).Get()}), true
+		case PUT:
+			var obj map[string]interface{}
+			if err := json.Unmarshal(body, &obj); err != nil {
+				log.Debug("Invalid property request", "thing", thing.ID(), "property", name, "error", err)
+				return BadRequest, nil, false
+			}
+			value := webthing.NewValue(obj[name])
+			if err := thing.SetPropertyContext(context.Background(), name, &value); err != nil {
+				log.Warn("Set property failure", "thing", thing.ID(), "property", name, "error", err)
+				return BadRequest, nil, false
+			}
+			return Changed, marshal(map[string]interface{}{name: thing.Property(name).Get()}), false
+		}
+		return MethodNotAllowed, nil, false
+
+	case rest[0] == "actions" && len(rest) <= 2:
+		name := ""
+		if len(rest) == 2 {
+			name = rest[1]
+			if !affordances.actions[name] {
+				return NotFound, nil, false
+			}
+		}
+		switch method {
+		case GET:
+			descriptions := thing.ActionDescriptions(name)
+			if descriptions == nil {
+				descriptions = []json.RawMessage{}
+			}
+			return Content, marshal(descriptions), false
+		case POST:
+			return performActions(thing, affordances, name, body)
+		}
+		return MethodNotAllowed, nil, false
+
+	case rest[0] == "actions" && len(rest) == 3:
+		action := thing.Action(rest[1], rest[2])
+		if action == nil {
+			return NotFound, nil, false
+		}
+		switch method {
+		case GET:
+			return Content, action.AsActionDescription(), false
+		case DELETE:
+			if thing.RemoveAction(rest[1], rest[2]) {
+				return Deleted, nil, false
+			}
+			return NotFound, nil, false
+		}
+		return MethodNotAllowed, nil, false
+
+	case rest[0] == "events" && len(rest) <= 2:
+		name := ""
+		if len(rest) == 2 {
+			name = rest[1]
+			if !affordances.events[name] {
+				return NotFound, nil, false
+			}
+		}
+		if method != GET {
+			return MethodNotAllowed, nil, false
+		}
+		content := thing.EventDescriptions(name)
+		if content == nil {
+			content = []byte("[]")
+		}
+		return Content, content, true
+	}
+	return NotFound, nil, false
+}
+
+// performActions Request the actions in a body {"<name>": {"input": ...}}.
+// If only is set, other actions are ignored.
+func performActions(thing *webthing.Thing, affordances affordances, only string, body []byte) (Code, []byte, bool) {
+	var obj map[string]map[string]*json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		thing.Logger().Debug("Invalid action request", "thing", thing.ID(), "error", err)
+		return BadRequest, nil, false
+	}
+
+	var descriptions []json.RawMessage
+	for name, params := range obj {
+		if !affordances.actions[name] || (only != "" && name != only) {
+			continue
+		}
+		action, err := thing.PerformActionContext(context.Background(), name, params["input"])
+		if action == nil || err != nil {
+			thing.Logger().Warn("Perform action failure", "thing", thing.ID(), "action", name, "error", err)
+			return BadRequest, nil, false
+		}
+		// Perform an Action in a goroutine.
+		go action.Start()
+		descriptions = append(descriptions, action.AsActionDescription())
+	}
+	if len(descriptions) == 0 {
+		return BadRequest, nil, false
+	}
+	if len(descriptions) == 1 {
+		return Created, descriptions[0], false
+	}
+	return Created, marshal(descriptions), false
+}
+
+// lookup Find the thing serving a path and the path below its href.
+func (s *Server) lookup(path string) (*webthing.Thing, []string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *webthing.Thing
+	var rest []string
+	longest := -1
+	for base, thing := range s.things {
+		var remainder string
+		switch {
+		case base == "":
+			remainder = path
+		case path == base:
+			remainder = ""
+		case strings.HasPrefix(path, base+"/"):
+			remainder = path[len(base)+1:]
+		default:
+			continue
+		}
+		if len(base) > longest {
+			found, longest, rest = thing, len(base), nil
+			if remainder != "" {
+				rest = strings.Split(remainder, "/")
+			}
+		}
+	}
+	return found, rest, found != nil
+}
+
+// descriptions Get the Thing Descriptions of all things.
+func (s *Server) descriptions() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	descriptions := []json.RawMessage{}
+	for _, thing := range s.things {
+		descriptions = append(descriptions, thing.AsThingDescription())
+	}
+	return marshal(descriptions)
+}
+
+// observe Register an observer of a resource, replacing an earlier
+// registration with the same token.
+func (s *Server) observe(path string, o *observer) {
+	s.unobserve(path, o.addr, o.token)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.observers[path] = append(s.observers[path], o)
+	}
+}
+
+// unobserve Remove an observer of a resource.
+func (s *Server) unobserve(path string, addr net.Addr, token []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	observers := s.observers[path][:0]
+	for _, o := range s.observers[path] {
+		if o.addr.String() != addr.String() || string(o.token) != string(token) {
+			observers = append(observers, o)
+		}
+	}
+	s.observers[path] = observers
+}
+
+// forget Remove the observer that rejected a notification.
+func (s *Server) forget(addr net.Addr, messageID uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, list := range s.observers {
+		observers := list[:0]
+		for _, o := range list {
+			if o.addr.String() != addr.String() || o.messageID != messageID {
+				observers = append(observers, o)
+			}
+		}
+		s.observers[path] = observers
+	}
+}
+
+// notify Send a notification to the observers of a resource.
+func (s *Server) notify(path string, value interface{}) {
+	s.mu.Lock()
+	observers := append([]*observer(nil), s.observers[path]...)
+	s.mu.Unlock()
+	if len(observers) == 0 {
+		return
+	}
+
+	content := marshal(value)
+	sequence := s.nextSequence()
+	for _, o := range observers {
+		payload, err := fromJSON(content, o.format)
+		if err != nil {
+			continue
+		}
+		msg := &message{
+			typ:       NonConfirmable,
+			code:      Content,
+			messageID: s.nextMessageID(),
+			token:     o.token,
+		}
+		msg.setUintOption(optionObserve, sequence)
+		msg.setUintOption(optionContentFormat, o.format)
+		if len(payload) > s.blockSize {
+			// The client fetches the other blocks with GET requests.
+			msg.setBlock(0, true, s.blockSize)
+			msg.setUintOption(optionSize2, uint32(len(payload)))
+			payload = payload[:s.blockSize]
+		}
+		msg.payload = payload
+
+		s.mu.Lock()
+		o.messageID = msg.messageID
+		s.mu.Unlock()
+		s.send(o.addr, msg.encode())
+	}
+}
+
+func (s *Server) send(addr net.Addr, data []byte) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		conn.WriteTo(data, addr)
+	}
+}
+
+func (s *Server) nextMessageID() uint16 {
+	return uint16(atomic.AddUint32(&s.messageID, 1))
+}
+
+// nextSequence Get the next Observe sequence number, which has 24 bits.
+func (s *Server) nextSequence() uint32 {
+	return atomic.AddUint32(&s.sequence, 1) & 0xffffff
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// url Get the base URL of the forms, empty until the server listens.
+// Callers hold the lock.
+func (s *Server) url() string {
+	if s.baseURL != "" || s.conn == nil {
+		return s.baseURL
+	}
+	addr, ok := s.conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return ""
+	}
+	host := "localhost"
+	if !addr.IP.IsUnspecified() {
+		host = addr.IP.String()
+	}
+	return "coap://" + net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+func join(segments ...string) string {
+	return strings.Trim(strings.Join(segments, "/"), "/")
+}
+
+func marshal(v interface{}) []byte {
+	content, _ := json.Marshal(v)
+	return content
+}
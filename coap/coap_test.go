@@ -0,0 +1,172 @@
+package coap
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// serve Serve a thing with a level and a long name on a local port and
+// dial it.
+func serve(t *testing.T, opts ...Option) (*webthing.Thing, net.Conn) {
+	thing := webthing.NewThing("urn:dev:ops:coap", "CoAP", nil, "")
+	thing.AddProperty(webthing.NewProperty(thing, "level", webthing.NewValue(1.0),
+		json.RawMessage(`{"type": "number"}`)))
+	thing.AddProperty(webthing.NewProperty(thing, "name", webthing.NewValue(strings.Repeat("lamp ", 20)),
+		json.RawMessage(`{"type": "string"}`)))
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	server := NewServer(opts...)
+	if err := server.Bind(thing); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	go server.Serve(pc)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return thing, conn
+}
+
+// request Build a confirmable request to a path.
+func request(code Code, messageID uint16, path string) *message {
+	msg := &message{typ: Confirmable, code: code, messageID: messageID, token: []byte{byte(messageID)}}
+	for _, segment := range strings.Split(path, "/") {
+		msg.options = append(msg.options, option{optionURIPath, []byte(segment)})
+	}
+	return msg
+}
+
+// roundTrip Send a request and wait for its response.
+func roundTrip(t *testing.T, conn net.Conn, req *message) *message {
+	t.Helper()
+	if _, err := conn.Write(req.encode()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return receive(t, conn)
+}
+
+// receive Wait for the next message of the server.
+func receive(t *testing.T, conn net.Conn) *message {
+	t.Helper()
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	msg, err := parse(buf[:n])
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return msg
+}
+
+func TestGetPut(t *testing.T) {
+	thing, conn := serve(t)
+
+	response := roundTrip(t, conn, request(GET, 1, "properties/level"))
+	if response.typ != Acknowledgement || response.messageID != 1 || response.code != Content {
+		t.Fatalf("Unexpected response %+v", response)
+	}
+	if string(response.payload) != `{"level":1}` {
+		t.Fatalf("Expected the level, got %s", response.payload)
+	}
+
+	req := request(PUT, 2, "properties/level")
+	req.payload = []byte(`{"level": 42}`)
+	if response := roundTrip(t, conn, req); response.code != Changed {
+		t.Fatalf("Expected 2.04, got %s", response.code)
+	}
+	if level := thing.Property("level").Get(); level != 42.0 {
+		t.Fatalf("Expected level 42, got %v", level)
+	}
+
+	if response := roundTrip(t, conn, request(GET, 3, "properties/missing")); response.code != NotFound {
+		t.Fatalf("Expected 4.04, got %s", response.code)
+	}
+}
+
+func TestBlock2(t *testing.T) {
+	thing, conn := serve(t, WithBlockSize(16), WithMaxRequests(1))
+	want, _ := json.Marshal(thing.Properties())
+
+	var got []byte
+	for num := uint32(0); ; num++ {
+		req := request(GET, uint16(10+num), "properties")
+		if num > 0 {
+			req.setBlock(num, false, 16)
+		}
+		response := roundTrip(t, conn, req)
+		if response.code != Content {
+			t.Fatalf("Expected 2.05, got %s", response.code)
+		}
+		n, more, size, ok := response.block()
+		if !ok || n != num || size != 16 {
+			t.Fatalf("Expected block %d of size 16, got %d of %d", num, n, size)
+		}
+		if total, _ := response.uintOption(optionSize2); int(total) != len(want) {
+			t.Fatalf("Expected Size2 %d, got %d", len(want), total)
+		}
+		got = append(got, response.payload...)
+		if !more {
+			break
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+
+	req := request(GET, 100, "properties")
+	req.setBlock(uint32(len(want)/16+1), false, 16)
+	if response := roundTrip(t, conn, req); response.code != BadOption {
+		t.Fatalf("Expected 4.02 for a block past the end, got %s", response.code)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	thing, conn := serve(t)
+
+	req := request(GET, 1, "properties/level")
+	req.setUintOption(optionObserve, 0)
+	response := roundTrip(t, conn, req)
+	if _, ok := response.uintOption(optionObserve); !ok || response.code != Content {
+		t.Fatalf("Expected an observed response, got %+v", response)
+	}
+
+	value := webthing.NewValue(7.0)
+	if err := thing.SetProperty("level", &value); err != nil {
+		t.Fatalf("SetProperty: %v", err)
+	}
+	notification := receive(t, conn)
+	if !bytes.Equal(notification.token, req.token) || notification.code != Content {
+		t.Fatalf("Unexpected notification %+v", notification)
+	}
+	if _, ok := notification.uintOption(optionObserve); !ok {
+		t.Fatal("Missing the Observe option of the notification")
+	}
+	if string(notification.payload) != `{"level":7}` {
+		t.Fatalf("Expected the new level, got %s", notification.payload)
+	}
+
+	// Rejecting a notification cancels the observation.
+	conn.Write((&message{typ: Reset, messageID: notification.messageID}).encode())
+	time.Sleep(50 * time.Millisecond)
+	value = webthing.NewValue(8.0)
+	thing.SetProperty("level", &value)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 1024)); err == nil {
+		t.Fatalf("Expected no notification after a reset, got %d bytes", n)
+	}
+}
@@ -0,0 +1,105 @@
+package coap
+
+import (
+	"encoding/json"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// contentTypes Media types of the content formats, RFC 7252 section 12.3.
+var contentTypes = map[uint32]string{
+	FormatJSON: "application/json",
+	FormatCBOR: "application/cbor",
+}
+
+// affordances The interaction affordances of a thing.
+type affordances struct {
+	writable map[string]bool
+	actions  map[string]bool
+	events   map[string]bool
+}
+
+// affordancesOf Get the affordances of a thing from its description.
+func affordancesOf(thing *webthing.Thing) affordances {
+	var description struct {
+		Properties map[string]struct {
+			ReadOnly bool `json:"readOnly"`
+		} `json:"properties"`
+		Actions map[string]json.RawMessage `json:"actions"`
+		Events  map[string]json.RawMessage `json:"events"`
+	}
+	json.Unmarshal(thing.AsThingDescription(), &description)
+
+	a := affordances{
+		writable: make(map[string]bool),
+		actions:  make(map[string]bool),
+		events:   make(map[string]bool),
+	}
+	for name, property := range description.Properties {
+		a.writable[name] = !property.ReadOnly
+	}
+	for name := range description.Actions {
+		a.actions[name] = true
+	}
+	for name := range description.Events {
+		a.events[name] = true
+	}
+	return a
+}
+
+// describe Add the CoAP forms of a thing to its description, once.
+func (s *Server) describe(thing *webthing.Thing, baseURL string) {
+	s.mu.Lock()
+	if s.described[thing] {
+		s.mu.Unlock()
+		return
+	}
+	s.described[thing] = true
+	s.mu.Unlock()
+
+	href := func(segments ...string) string {
+		return baseURL + "/" + join(append([]string{thing.Href()}, segments...)...)
+	}
+	a := affordancesOf(thing)
+
+	for _, format := range []uint32{FormatJSON, FormatCBOR} {
+		contentType := contentTypes[format]
+		form := func(href, method string, op ...string) webthing.Form {
+			return webthing.Form{
+				"href":        href,
+				"op":          op,
+				"contentType": contentType,
+				"cov:method":  method,
+			}
+		}
+		observe := func(href string, op ...string) webthing.Form {
+			f := form(href, "GET", op...)
+			f["subprotocol"] = "cov:observe"
+			return f
+		}
+
+		for name, writable := range a.writable {
+			thing.AddForm("properties", name, form(href("properties", name), "GET", "readproperty"))
+			if writable {
+				thing.AddForm("properties", name, form(href("properties", name), "PUT", "writeproperty"))
+			}
+			thing.AddForm("properties", name, observe(href("properties", name), "observeproperty", "unobserveproperty"))
+		}
+		for name := range a.actions {
+			thing.AddForm("actions", name, form(href("actions", name), "POST", "invokeaction"))
+		}
+		for name := range a.events {
+			thing.AddForm("events", name, observe(href("events", name), "subscribeevent", "unsubscribeevent"))
+		}
+	}
+}
+
+// toJSON Convert a request payload to JSON.
+func toJSON(payload []byte, format uint32) ([]byte, error) {
+	return webthing.ToJSON(payload, contentTypes[format])
+}
+
+// fromJSON Convert JSON content to a response payload.
+func fromJSON(content []byte, format uint32) ([]byte, error) {
+	return webthing.FromJSON(content, contentTypes[format])
+}
@@ -0,0 +1,262 @@
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Type Type of a CoAP message.
+type Type uint8
+
+// Message types, RFC 7252 section 3.
+const (
+	Confirmable     Type = 0
+	NonConfirmable  Type = 1
+	Acknowledgement Type = 2
+	Reset           Type = 3
+)
+
+// Code Code of a CoAP request or response, class << 5 | detail.
+type Code uint8
+
+// Method and response codes, RFC 7252 section 12.1.
+const (
+	Empty  Code = 0
+	GET    Code = 1
+	POST   Code = 2
+	PUT    Code = 3
+	DELETE Code = 4
+
+	Created                  Code = 2<<5 | 1
+	Deleted                  Code = 2<<5 | 2
+	Changed                  Code = 2<<5 | 4
+	Content                  Code = 2<<5 | 5
+	BadRequest               Code = 4<<5 | 0
+	BadOption                Code = 4<<5 | 2
+	NotFound                 Code = 4<<5 | 4
+	MethodNotAllowed         Code = 4<<5 | 5
+	NotAcceptable            Code = 4<<5 | 6
+	UnsupportedContentFormat Code = 4<<5 | 15
+	InternalServerError      Code = 5<<5 | 0
+	ServiceUnavailable       Code = 5<<5 | 3
+)
+
+// String Get the code in dotted notation, e.g. "2.05".
+func (c Code) String() string {
+	return string([]byte{'0' + byte(c>>5), '.', '0' + byte(c&0x1f)/10, '0' + byte(c&0x1f)%10})
+}
+
+// Option numbers, RFC 7252 section 5.10, RFC 7641 and RFC 7959.
+const (
+	optionObserve       = 6
+	optionURIPath       = 11
+	optionContentFormat = 12
+	optionAccept        = 17
+	optionBlock2        = 23
+	optionSize2         = 28
+)
+
+// Content formats, RFC 7252 section 12.3 and RFC 7049.
+const (
+	FormatJSON uint32 = 50
+	FormatCBOR uint32 = 60
+)
+
+const payloadMarker = 0xff
+
+type option struct {
+	number uint16
+	value  []byte
+}
+
+// message A CoAP message.
+type message struct {
+	typ       Type
+	code      Code
+	messageID uint16
+	token     []byte
+	options   []option
+	payload   []byte
+}
+
+var errMessage = errors.New("malformed CoAP message")
+
+// parse Decode a message from a datagram.
+func parse(data []byte) (*message, error) {
+	if len(data) < 4 || data[0]>>6 != 1 {
+		return nil, errMessage
+	}
+	tkl := int(data[0] & 0x0f)
+	if tkl > 8 || len(data) < 4+tkl {
+		return nil, errMessage
+	}
+	msg := &message{
+		typ:       Type(data[0] >> 4 & 0x03),
+		code:      Code(data[1]),
+		messageID: binary.BigEndian.Uint16(data[2:4]),
+		token:     append([]byte(nil), data[4:4+tkl]...),
+	}
+
+	data = data[4+tkl:]
+	number := 0
+	for len(data) > 0 {
+		if data[0] == payloadMarker {
+			if len(data) == 1 {
+				return nil, errMessage
+			}
+			msg.payload = append([]byte(nil), data[1:]...)
+			break
+		}
+		delta, length := int(data[0]>>4), int(data[0]&0x0f)
+		data = data[1:]
+		var err error
+		if delta, data, err = extended(delta, data); err != nil {
+			return nil, err
+		}
+		if length, data, err = extended(length, data); err != nil {
+			return nil, err
+		}
+		if len(data) < length {
+			return nil, errMessage
+		}
+		number += delta
+		msg.options = append(msg.options, option{uint16(number), append([]byte(nil), data[:length]...)})
+		data = data[length:]
+	}
+	return msg, nil
+}
+
+// extended Decode an extended option delta or length.
+func extended(v int, data []byte) (int, []byte, error) {
+	switch v {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, errMessage
+		}
+		return int(data[0]) + 13, data[1:], nil
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, errMessage
+		}
+		return int(binary.BigEndian.Uint16(data)) + 269, data[2:], nil
+	case 15:
+		return 0, nil, errMessage
+	}
+	return v, data, nil
+}
+
+// encode Encode the message into a datagram.
+func (msg *message) encode() []byte {
+	buf := []byte{1<<6 | byte(msg.typ)<<4 | byte(len(msg.token)), byte(msg.code), 0, 0}
+	binary.BigEndian.PutUint16(buf[2:], msg.messageID)
+	buf = append(buf, msg.token...)
+
+	options := append([]option(nil), msg.options...)
+	sort.SliceStable(options, func(i, j int) bool { return options[i].number < options[j].number })
+	previous := 0
+	for _, o := range options {
+		delta, length := int(o.number)-previous, len(o.value)
+		previous = int(o.number)
+		dn, dx := nibble(delta)
+		ln, lx := nibble(length)
+		buf = append(buf, dn<<4|ln)
+		buf = append(buf, dx...)
+		buf = append(buf, lx...)
+		buf = append(buf, o.value...)
+	}
+	if len(msg.payload) > 0 {
+		buf = append(buf, payloadMarker)
+		buf = append(buf, msg.payload...)
+	}
+	return buf
+}
+
+// nibble Encode an option delta or length as nibble and extended bytes.
+func nibble(v int) (byte, []byte) {
+	switch {
+	case v < 13:
+		return byte(v), nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	default:
+		return 14, []byte{byte((v - 269) >> 8), byte(v - 269)}
+	}
+}
+
+// option Get the first value of an option.
+func (msg *message) option(number uint16) ([]byte, bool) {
+	for _, o := range msg.options {
+		if o.number == number {
+			return o.value, true
+		}
+	}
+	return nil, false
+}
+
+// uintOption Get the first value of an unsigned integer option.
+func (msg *message) uintOption(number uint16) (uint32, bool) {
+	value, ok := msg.option(number)
+	if !ok || len(value) > 4 {
+		return 0, false
+	}
+	var v uint32
+	for _, b := range value {
+		v = v<<8 | uint32(b)
+	}
+	return v, true
+}
+
+// setUintOption Replace an unsigned integer option.
+func (msg *message) setUintOption(number uint16, v uint32) {
+	msg.removeOption(number)
+	var value []byte
+	for ; v > 0; v >>= 8 {
+		value = append([]byte{byte(v)}, value...)
+	}
+	msg.options = append(msg.options, option{number, value})
+}
+
+func (msg *message) removeOption(number uint16) {
+	options := msg.options[:0]
+	for _, o := range msg.options {
+		if o.number != number {
+			options = append(options, o)
+		}
+	}
+	msg.options = options
+}
+
+// path Get the request path joined from the Uri-Path options.
+func (msg *message) path() string {
+	var segments []string
+	for _, o := range msg.options {
+		if o.number == optionURIPath {
+			segments = append(segments, string(o.value))
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// block Decode a Block2 option into number, more flag and size.
+func (msg *message) block() (num uint32, more bool, size int, ok bool) {
+	v, ok := msg.uintOption(optionBlock2)
+	if !ok || v&0x07 == 7 {
+		return 0, false, 0, false
+	}
+	return v >> 4, v&0x08 != 0, 1 << (v&0x07 + 4), true
+}
+
+// setBlock Encode a Block2 option.
+func (msg *message) setBlock(num uint32, more bool, size int) {
+	szx := uint32(0)
+	for 1<<(szx+4) < size && szx < 6 {
+		szx++
+	}
+	v := num<<4 | szx
+	if more {
+		v |= 0x08
+	}
+	msg.setUintOption(optionBlock2, v)
+}
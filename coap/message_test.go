@@ -0,0 +1,103 @@
+package coap
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	messages := map[string]*message{
+		"empty": {typ: Acknowledgement, code: Empty, messageID: 7},
+		"request": {
+			typ:       Confirmable,
+			code:      GET,
+			messageID: 0xbeef,
+			token:     []byte{1, 2, 3, 4},
+			options: []option{
+				{optionObserve, nil},
+				{optionURIPath, []byte("properties")},
+				{optionURIPath, []byte("level")},
+				{optionAccept, []byte{60}},
+			},
+		},
+		"extended": {
+			typ:       NonConfirmable,
+			code:      Content,
+			messageID: 1,
+			token:     []byte("12345678"),
+			options: []option{
+				{optionURIPath, []byte(strings.Repeat("a", 20))},
+				{optionURIPath, []byte(strings.Repeat("b", 300))},
+				{2048, []byte{1}},
+			},
+			payload: []byte(`{"level":42}`),
+		},
+	}
+	for name, msg := range messages {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := parse(msg.encode())
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if parsed.typ != msg.typ || parsed.code != msg.code || parsed.messageID != msg.messageID ||
+				!bytes.Equal(parsed.token, msg.token) || !bytes.Equal(parsed.payload, msg.payload) {
+				t.Fatalf("Expected %+v, got %+v", msg, parsed)
+			}
+			if len(parsed.options) != len(msg.options) {
+				t.Fatalf("Expected %d options, got %d", len(msg.options), len(parsed.options))
+			}
+			for i, o := range msg.options {
+				if parsed.options[i].number != o.number || !bytes.Equal(parsed.options[i].value, o.value) {
+					t.Fatalf("Expected option %v, got %v", o, parsed.options[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"short":          {0x40, 0x01, 0x00},
+		"version":        {0x80, 0x01, 0x00, 0x01},
+		"token length":   {0x49, 0x01, 0x00, 0x01},
+		"missing token":  {0x42, 0x01, 0x00, 0x01, 0xaa},
+		"empty payload":  {0x40, 0x01, 0x00, 0x01, 0xff},
+		"reserved delta": {0x40, 0x01, 0x00, 0x01, 0xf0},
+		"short option":   {0x40, 0x01, 0x00, 0x01, 0xb3, 'a'},
+		"short extended": {0x40, 0x01, 0x00, 0x01, 0xd0},
+	} {
+		if _, err := parse(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	msg := &message{}
+	msg.setUintOption(optionContentFormat, FormatCBOR)
+	msg.setUintOption(optionSize2, 70000)
+	msg.setUintOption(optionSize2, 300)
+	msg.options = append(msg.options, option{optionURIPath, []byte("things")}, option{optionURIPath, []byte("lamp")})
+
+	if v, ok := msg.uintOption(optionContentFormat); !ok || v != FormatCBOR {
+		t.Fatalf("Expected Content-Format %d, got %d", FormatCBOR, v)
+	}
+	if v, ok := msg.uintOption(optionSize2); !ok || v != 300 {
+		t.Fatalf("Expected the replaced Size2 300, got %d", v)
+	}
+	if path := msg.path(); path != "things/lamp" {
+		t.Fatalf("Expected the path things/lamp, got %s", path)
+	}
+
+	for _, size := range []int{16, 64, 1024} {
+		for _, more := range []bool{false, true} {
+			msg.setBlock(5, more, size)
+			num, m, s, ok := msg.block()
+			if !ok || !reflect.DeepEqual([]interface{}{num, m, s}, []interface{}{uint32(5), more, size}) {
+				t.Fatalf("Expected block 5/%t/%d, got %d/%t/%d", more, size, num, m, s)
+			}
+		}
+	}
+}
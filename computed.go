@@ -0,0 +1,151 @@
+package webthing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ComputeFunc Compute the value of a computed property.
+//
+// @param inputs The values of the inputs, in order
+// @return The value, or nil to keep the current value.
+type ComputeFunc func(inputs []interface{}) interface{}
+
+// computed The inputs and function of a computed property.
+type computed struct {
+	property *Property
+	inputs   []*Property
+	compute  ComputeFunc
+
+	mu sync.Mutex
+}
+
+// NewComputedProperty Create a read-only property whose value is computed
+// from other properties, of the same or other things.
+//
+// @param thing    Thing this property belongs to
+// @param name     Name of the property
+// @param inputs   Properties the value is computed from
+// @param compute  Function computing the value from the inputs
+// @param metadata Property metadata, readOnly is added
+func NewComputedProperty(thing *Thing, name string, inputs []*Property, compute ComputeFunc, metadata json.RawMessage) (*Property, error) {
+	property := NewProperty(thing, name, NewValue(nil), metadata)
+	if err := property.SetCompute(inputs, compute); err != nil {
+		return nil, err
+	}
+	return property, nil
+}
+
+// SetCompute Compute the value of this property from other properties, of
+// the same or other things. The value is computed immediately and whenever
+// an input changes, and the property becomes read-only and is no longer
+// persisted. Set it before the thing is served.
+//
+// @param inputs  Properties the value is computed from
+// @param compute Function computing the value from the inputs
+// @return An error if an input is computed from this property.
+func (property *Property) SetCompute(inputs []*Property, compute ComputeFunc) error {
+	if compute == nil {
+		return errors.New("A computed property requires a function: " + property.name)
+	}
+	for _, input := range inputs {
+		if path := computePath(input, property); path != nil {
+			names := []string{property.name}
+			for _, p := range path {
+				names = append(names, p.name)
+			}
+			return errors.New("Cyclic computed property: " + strings.Join(names, " -> "))
+		}
+	}
+
+	metadata := make(map[string]interface{})
+	if len(property.metadata) > 0 {
+		if err := json.Unmarshal(property.metadata, &metadata); err != nil {
+			return err
+		}
+	}
+	if readOnly, _ := metadata["readOnly"].(bool); !readOnly {
+		metadata["readOnly"] = true
+		property.metadata, _ = json.Marshal(metadata)
+	}
+
+	c := &computed{property: property, inputs: inputs, compute: compute}
+	property.computed = c
+	property.persistent = false
+	for _, input := range inputs {
+		input.value.onUpdateContext(func(ctx context.Context, _ interface{}) {
+			if property.computed == c {
+				c.update(ctx)
+			}
+		})
+	}
+	c.update(context.Background())
+	return nil
+}
+
+// Inputs Get the properties the value of this property is computed from.
+//
+// @returns The inputs, nil if the property is not computed.
+func (property *Property) Inputs() []*Property {
+	if property.computed == nil {
+		return nil
+	}
+	return property.computed.inputs
+}
+
+// update Compute the value and notify observers if it changed.
+func (c *computed) update(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([]interface{}, len(c.inputs))
+	for i, input := range c.inputs {
+		values[i] = input.value.Get()
+	}
+
+	value, err := c.call(values)
+	if err != nil {
+		c.property.thing.log("property", c.property.name).Error("Compute property failure", "error", err)
+		return
+	}
+	if value == nil {
+		return
+	}
+	if err := c.property.validateType(value); err != nil {
+		c.property.thing.log("property", c.property.name).Error("Invalid computed value", "error", err)
+		return
+	}
+	c.property.value.NotifyOfExternalUpdateContext(ctx, value)
+}
+
+// call Call the function, recovering from a panic.
+func (c *computed) call(values []interface{}) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return c.compute(values), nil
+}
+
+// computePath Find the inputs leading from a property to a target, through
+// computed properties.
+//
+// @return The properties from property to target, nil if there is no path.
+func computePath(property, target *Property) []*Property {
+	if property == target {
+		return []*Property{property}
+	}
+	if property.computed == nil {
+		return nil
+	}
+	for _, input := range property.computed.inputs {
+		if path := computePath(input, target); path != nil {
+			return append([]*Property{property}, path...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package dashboard serves a web dashboard for Web Things.
+//
+// The dashboard is rendered in the browser from the Thing Description: it
+// shows controls for writable properties, forms for actions generated from
+// their input schemas and a live log of property changes, action statuses
+// and events received over the WebSocket of the thing.
+//
+//	server := webthing.NewWebThingServer(things, httpServer, "")
+//	dashboard.MountAll(server)
+//	server.Start()
+package dashboard
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/dravenk/webthing-go"
+)
+
+//go:embed static
+var static embed.FS
+
+var index = template.Must(template.ParseFS(static, "static/index.html"))
+
+// Handler Get a handler serving the dashboard of the thing described at
+// tdHref. The handler expects paths relative to the dashboard, see
+// http.StripPrefix.
+//
+// @param tdHref URL of the Thing Description
+func Handler(tdHref string) http.Handler {
+	assets, _ := fs.Sub(static, "static")
+	files := http.FileServer(http.FS(assets))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		if path != "" && path != "index.html" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		index.Execute(w, struct{ TDHref string }{tdHref})
+	})
+}
+
+// Mount Serve the dashboard of a thing at href and advertise it as the UI
+// of the thing.
+//
+// @param server The server of the thing
+// @param thing  The thing
+// @param href   Path of the dashboard
+func Mount(server *webthing.ThingServer, thing *webthing.Thing, href string) {
+	href = "/" + strings.Trim(href, "/") + "/"
+	server.Handle(href, http.StripPrefix(strings.TrimSuffix(href, "/"), Handler(thing.Href())))
+	thing.SetUIHref(href)
+}
+
+// MountAll Serve the dashboards of all things of a server at /ui below the
+// href of each thing.
+//
+// @param server The server
+func MountAll(server *webthing.ThingServer) {
+	for _, thing := range server.Things {
+		Mount(server, thing, strings.TrimRight(thing.Href(), "/")+"/ui")
+	}
+}
@@ -0,0 +1,267 @@
+'use strict';
+
+(function () {
+  const tdHref = document.querySelector('meta[name="thing-description"]').content;
+  const controls = {};
+
+  function el(tag, attrs, ...children) {
+    const node = document.createElement(tag);
+    Object.entries(attrs || {}).forEach(([key, value]) => {
+      if (value === undefined || value === null || value === false) {
+        return;
+      }
+      if (key === 'class') {
+        node.className = value;
+      } else {
+        node.setAttribute(key, value === true ? '' : value);
+      }
+    });
+    children.forEach((child) => {
+      node.append(child instanceof Node ? child : String(child));
+    });
+    return node;
+  }
+
+  function href(affordance, rel) {
+    const link = (affordance.links || []).find((l) => !rel || l.rel === rel);
+    if (link) {
+      return link.href;
+    }
+    const form = (affordance.forms || [])[0];
+    return form ? form.href : null;
+  }
+
+  function log(kind, text) {
+    const entry = el('li', {class: kind},
+      el('time', {}, new Date().toLocaleTimeString()), `${kind}: ${text}`);
+    const list = document.getElementById('log');
+    list.prepend(entry);
+    while (list.children.length > 200) {
+      list.lastChild.remove();
+    }
+  }
+
+  async function request(method, url, body) {
+    const response = await fetch(url, {
+      method,
+      headers: {'Content-Type': 'application/json', Accept: 'application/json'},
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (!response.ok) {
+      throw new Error(`${method} ${url}: ${response.status} ${response.statusText}`);
+    }
+    const text = await response.text();
+    return text ? JSON.parse(text) : null;
+  }
+
+  // input Create the control of a value described by a data schema.
+  function input(schema, readOnly) {
+    const type = schema.type;
+    let control;
+    if (Array.isArray(schema.enum)) {
+      control = el('select', {disabled: readOnly},
+        ...schema.enum.map((v) => el('option', {value: JSON.stringify(v)}, v)));
+      control.read = () => JSON.parse(control.value);
+      control.write = (v) => { control.value = JSON.stringify(v); };
+    } else if (type === 'boolean') {
+      control = el('input', {type: 'checkbox', disabled: readOnly});
+      control.read = () => control.checked;
+      control.write = (v) => { control.checked = !!v; };
+    } else if (type === 'number' || type === 'integer') {
+      const ranged = schema.minimum !== undefined && schema.maximum !== undefined;
+      control = el('input', {
+        type: ranged && !readOnly ? 'range' : 'number',
+        min: schema.minimum,
+        max: schema.maximum,
+        step: schema.multipleOf || (type === 'integer' ? 1 : 'any'),
+        disabled: readOnly,
+      });
+      const shown = ranged && !readOnly ? el('output', {}) : null;
+      control.read = () => (type === 'integer' ? parseInt(control.value, 10) : parseFloat(control.value));
+      control.write = (v) => {
+        control.value = v;
+        if (shown) {
+          shown.value = v;
+        }
+      };
+      if (shown) {
+        control.addEventListener('input', () => { shown.value = control.value; });
+        control.extra = shown;
+      }
+    } else if (type === 'object' || type === 'array') {
+      control = el('textarea', {rows: 3, cols: 40, disabled: readOnly});
+      control.read = () => JSON.parse(control.value);
+      control.write = (v) => { control.value = JSON.stringify(v); };
+    } else {
+      control = el('input', {type: 'text', disabled: readOnly});
+      control.read = () => control.value;
+      control.write = (v) => { control.value = v; };
+    }
+    return control;
+  }
+
+  function hint(schema) {
+    const parts = [];
+    if (schema.unit) {
+      parts.push(schema.unit);
+    }
+    if (schema.minimum !== undefined || schema.maximum !== undefined) {
+      parts.push(`${schema.minimum ?? ''}..${schema.maximum ?? ''}`);
+    }
+    if (schema.readOnly) {
+      parts.push('read-only');
+    }
+    return el('span', {class: 'hint'}, parts.join(', '));
+  }
+
+  function renderProperty(name, property) {
+    const control = input(property, property.readOnly);
+    controls[name] = control;
+    const url = href(property, 'property');
+    const item = el('div', {class: 'item'},
+      el('span', {class: 'name', title: property.description || ''}, property.title || name),
+      control, control.extra || '', ' ', hint(property));
+
+    if (!property.readOnly && url) {
+      control.addEventListener('change', async () => {
+        try {
+          const value = await request('PUT', url, {[name]: control.read()});
+          control.write(value[name]);
+        } catch (err) {
+          log('error', err.message);
+        }
+      });
+    }
+    return item;
+  }
+
+  function renderAction(name, action) {
+    const schema = action.input;
+    const fields = {};
+    const form = el('form', {class: 'item'},
+      el('span', {class: 'name', title: action.description || ''}, action.title || name));
+
+    if (schema && schema.type === 'object' && schema.properties) {
+      Object.entries(schema.properties).forEach(([field, fieldSchema]) => {
+        fields[field] = input(fieldSchema, false);
+        form.append(el('label', {}, `${fieldSchema.title || field} `,
+          fields[field], fields[field].extra || '', ' ', hint(fieldSchema)));
+      });
+    } else if (schema && schema.type) {
+      fields[''] = input(schema, false);
+      form.append(fields[''], fields[''].extra || '', ' ', hint(schema));
+    }
+    form.append(el('button', {type: 'submit'}, 'Run'));
+
+    form.addEventListener('submit', async (event) => {
+      event.preventDefault();
+      const body = {};
+      try {
+        if (fields[''] !== undefined) {
+          body.input = fields[''].read();
+        } else if (Object.keys(fields).length) {
+          body.input = {};
+          Object.entries(fields).forEach(([field, control]) => {
+            body.input[field] = control.read();
+          });
+        }
+        await request('POST', href(action, 'action'), {[name]: body});
+      } catch (err) {
+        log('error', err.message);
+      }
+    });
+    return form;
+  }
+
+  function setConnectivity(connectivity) {
+    const badge = document.getElementById('connectivity');
+    badge.className = `badge ${connectivity.state}`;
+    badge.textContent = connectivity.reason ?
+      `${connectivity.state}: ${connectivity.reason}` : connectivity.state;
+  }
+
+  function connect(td) {
+    const link = (td.links || []).find((l) => /^wss?:/.test(l.href));
+    if (!link) {
+      return;
+    }
+    const socket = new WebSocket(link.href);
+    const status = document.getElementById('socket');
+    socket.onopen = () => {
+      status.className = 'badge connected';
+      status.textContent = 'connected';
+      const events = {};
+      Object.keys(td.events || {}).forEach((name) => { events[name] = {}; });
+      if (Object.keys(events).length) {
+        socket.send(JSON.stringify({messageType: 'addEventSubscription', data: events}));
+      }
+    };
+    socket.onclose = () => {
+      status.className = 'badge disconnected';
+      status.textContent = 'disconnected';
+      setTimeout(() => connect(td), 5000);
+    };
+    socket.onmessage = (message) => {
+      const {messageType, data} = JSON.parse(message.data);
+      switch (messageType) {
+        case 'propertyStatus':
+          Object.entries(data).forEach(([name, value]) => {
+            if (controls[name] && document.activeElement !== controls[name]) {
+              controls[name].write(value);
+            }
+            log('property', `${name} = ${JSON.stringify(value)}`);
+          });
+          break;
+        case 'actionStatus':
+          Object.entries(data).forEach(([name, action]) => log('action', `${name} ${action.status}`));
+          break;
+        case 'event':
+          Object.entries(data).forEach(([name, event]) => {
+            log('event', event.data === undefined ? name : `${name} ${JSON.stringify(event.data)}`);
+          });
+          break;
+        case 'connectivityStatus':
+          setConnectivity(data);
+          log('connectivity', data.state);
+          break;
+        case 'error':
+          log('error', data.message);
+          break;
+        default:
+          break;
+      }
+    };
+  }
+
+  async function main() {
+    const td = await request('GET', tdHref);
+    document.title = td.title;
+    document.getElementById('title').textContent = td.title;
+    document.getElementById('description').textContent = td.description || '';
+    if (td.connectivity) {
+      setConnectivity(td.connectivity);
+    }
+
+    const properties = document.getElementById('properties');
+    Object.entries(td.properties || {}).forEach(([name, property]) => {
+      properties.append(renderProperty(name, property));
+    });
+    const actions = document.getElementById('actions');
+    Object.entries(td.actions || {}).forEach(([name, action]) => {
+      actions.append(renderAction(name, action));
+    });
+
+    const valuesLink = (td.links || []).find((l) => l.rel === 'properties');
+    if (valuesLink) {
+      const values = await request('GET', valuesLink.href);
+      Object.entries(values || {}).forEach(([name, value]) => {
+        if (controls[name]) {
+          controls[name].write(value);
+        }
+      });
+    }
+    connect(td);
+  }
+
+  main().catch((err) => log('error', err.message));
+}());
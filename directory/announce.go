@@ -0,0 +1,102 @@
+package directory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// DefaultTTL Lifetime of registrations made by Announce unless another is
+// given.
+const DefaultTTL = 5 * time.Minute
+
+// Announce Register the things of a server with a directory and renew the
+// registrations until ctx is done, when they are deleted. Registrations
+// expire after ttl unless renewed, so things of a server that stopped
+// disappear from the directory.
+//
+// @param ctx          Context ending the announcement
+// @param server       The server of the things
+// @param directoryURL URL of the directory, e.g. "http://dir.local:8081"
+// @param baseURL      URL the server is reached at, e.g. "http://lamp.local:8888"
+// @param ttl          Lifetime of the registrations, DefaultTTL if zero
+func Announce(ctx context.Context, server *webthing.ThingServer, directoryURL, baseURL string, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	directoryURL = strings.TrimRight(directoryURL, "/")
+	log := server.Logger()
+
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+	for {
+		for _, thing := range server.Things {
+			if err := put(ctx, directoryURL, thing, baseURL, ttl); err != nil {
+				log.Warn("Register thing description failure", "thing", thing.ID(), "directory", directoryURL, "error", err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			deleteCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for _, thing := range server.Things {
+				if err := request(deleteCtx, http.MethodDelete, thingURL(directoryURL, thing), nil); err != nil {
+					log.Warn("Delete thing description failure", "thing", thing.ID(), "directory", directoryURL, "error", err)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// put Register the description of a thing with absolute hrefs.
+func put(ctx context.Context, directoryURL string, thing *webthing.Thing, baseURL string, ttl time.Duration) error {
+	var td map[string]interface{}
+	if err := json.Unmarshal(thing.AsThingDescription(), &td); err != nil {
+		return err
+	}
+	td["base"] = strings.TrimRight(baseURL, "/") + "/"
+	if _, ok := td["securityDefinitions"]; !ok {
+		td["securityDefinitions"] = map[string]interface{}{
+			"nosec_sc": map[string]interface{}{"scheme": "nosec"},
+		}
+		td["security"] = "nosec_sc"
+	}
+	td["registration"] = map[string]interface{}{"ttl": ttl.Seconds()}
+	content, err := json.Marshal(td)
+	if err != nil {
+		return err
+	}
+	return request(ctx, http.MethodPut, thingURL(directoryURL, thing), content)
+}
+
+func thingURL(directoryURL string, thing *webthing.Thing) string {
+	return directoryURL + "/things/" + url.PathEscape(thing.ID())
+}
+
+func request(ctx context.Context, method, rawURL string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", mediaTypeTD)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", method, rawURL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+// Package directory implements the W3C WoT Thing Description Directory API,
+// a registry where Thing Descriptions of remote things are registered and
+// searched.
+//
+// The handler serves below the path it is mounted at:
+//
+//	GET    /things             list Thing Descriptions, ?offset=&limit=
+//	POST   /things             register an anonymous Thing Description
+//	GET    /things/<id>        get a Thing Description
+//	PUT    /things/<id>        create or replace a Thing Description
+//	PATCH  /things/<id>        update with a JSON merge patch (RFC 7396)
+//	DELETE /things/<id>        delete a Thing Description
+//	GET    /search             search by ?type=, ?title= and ?property=
+//
+// Registrations expire when a ttl in seconds is given in the "registration"
+// member of the Thing Description.
+//
+//	dir := directory.New()
+//	http.ListenAndServe(":8081", dir.Handler())
+package directory
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultLimit Number of Thing Descriptions listed per page unless a limit
+// is requested.
+const DefaultLimit = 100
+
+// Errors of registrations.
+var (
+	ErrInvalid  = errors.New("directory: invalid thing description")
+	ErrNotFound = errors.New("directory: thing description not found")
+)
+
+// Directory A registry of Thing Descriptions.
+type Directory struct {
+	mu      sync.RWMutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+// entry A registered Thing Description.
+type entry struct {
+	td       map[string]interface{}
+	created  time.Time
+	modified time.Time
+	ttl      time.Duration
+}
+
+// Query Criteria of a search. Empty criteria match every Thing Description.
+type Query struct {
+	// Type A semantic type the thing has in "@type".
+	Type string
+
+	// Title A case-insensitive part of the title.
+	Title string
+
+	// Properties Capabilities the thing has, each the name or a semantic type
+	// of a property.
+	Properties []string
+}
+
+// New Create an empty directory.
+func New() *Directory {
+	return &Directory{
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+// Put Create or replace the Thing Description with the given id.
+//
+// @param id The id of the thing
+// @param td The Thing Description
+// @return Whether the Thing Description was created.
+func (d *Directory) Put(id string, td []byte) (bool, error) {
+	m, err := parse(td)
+	if err != nil {
+		return false, err
+	}
+	if tdID, ok := m["id"]; ok && tdID != id {
+		return false, ErrInvalid
+	}
+	m["id"] = id
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire()
+	now := d.now()
+	e, ok := d.entries[id]
+	if !ok {
+		e = &entry{created: now}
+		d.entries[id] = e
+	}
+	e.set(m, now)
+	return !ok, nil
+}
+
+// Register Register an anonymous Thing Description under a new id.
+//
+// @param td The Thing Description without an id
+// @return The id of the thing.
+func (d *Directory) Register(td []byte) (string, error) {
+	m, err := parse(td)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := m["id"]; ok {
+		return "", ErrInvalid
+	}
+	id := "urn:uuid:" + uuid.New().String()
+	m["id"] = id
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	e := &entry{created: now}
+	e.set(m, now)
+	d.entries[id] = e
+	return id, nil
+}
+
+// Patch Update the Thing Description with the given id with a JSON merge
+// patch.
+//
+// @param id    The id of the thing
+// @param patch The merge patch
+func (d *Directory) Patch(id string, patch []byte) error {
+	var p map[string]interface{}
+	if err := json.Unmarshal(patch, &p); err != nil || p == nil {
+		return ErrInvalid
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire()
+	e, ok := d.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	merged := merge(deepCopy(e.td), p).(map[string]interface{})
+	if merged["id"] != id {
+		return ErrInvalid
+	}
+	if title, _ := merged["title"].(string); title == "" {
+		return ErrInvalid
+	}
+	ttl := e.ttl
+	e.set(merged, d.now())
+	if _, ok := p["registration"]; !ok {
+		e.ttl = ttl
+	}
+	return nil
+}
+
+// Get Get the Thing Description with the given id, with its registration
+// information.
+//
+// @param id The id of the thing
+func (d *Directory) Get(id string) (json.RawMessage, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	e, ok := d.entries[id]
+	if !ok || e.expired(d.now()) {
+		return nil, false
+	}
+	return e.description(), true
+}
+
+// Delete Delete the Thing Description with the given id.
+//
+// @param id The id of the thing
+// @return Whether it was registered.
+func (d *Directory) Delete(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire()
+	_, ok := d.entries[id]
+	delete(d.entries, id)
+	return ok
+}
+
+// List Get a page of the Thing Descriptions ordered by id.
+//
+// @param offset Number of Thing Descriptions to skip
+// @param limit  Maximum number of Thing Descriptions
+// @return The page and the total number of Thing Descriptions.
+func (d *Directory) List(offset, limit int) ([]json.RawMessage, int) {
+	return d.Search(Query{}, offset, limit)
+}
+
+// Search Get a page of the Thing Descriptions matching a query, ordered by
+// id.
+//
+// @param query  The criteria
+// @param offset Number of matches to skip, none if negative
+// @param limit  Maximum number of matches, all if negative
+// @return The page and the total number of matches.
+func (d *Directory) Search(query Query, offset, limit int) ([]json.RawMessage, int) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	now := d.now()
+
+	var ids []string
+	for id, e := range d.entries {
+		if !e.expired(now) && query.match(e.td) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	total := len(ids)
+	switch {
+	case offset < 0:
+		offset = 0
+	case offset > total:
+		offset = total
+	}
+	if limit < 0 || offset+limit > total {
+		limit = total - offset
+	}
+	page := make([]json.RawMessage, 0, limit)
+	for _, id := range ids[offset : offset+limit] {
+		page = append(page, d.entries[id].description())
+	}
+	return page, total
+}
+
+// expire Remove expired registrations. Callers hold the lock.
+func (d *Directory) expire() {
+	now := d.now()
+	for id, e := range d.entries {
+		if e.expired(now) {
+			delete(d.entries, id)
+		}
+	}
+}
+
+// set Replace the Thing Description, taking the ttl from its registration
+// information.
+func (e *entry) set(td map[string]interface{}, now time.Time) {
+	e.ttl = 0
+	if registration, ok := td["registration"].(map[string]interface{}); ok {
+		if ttl, ok := registration["ttl"].(float64); ok && ttl > 0 {
+			e.ttl = time.Duration(ttl * float64(time.Second))
+		}
+	}
+	delete(td, "registration")
+	e.td = td
+	e.modified = now
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return e.ttl > 0 && now.After(e.modified.Add(e.ttl))
+}
+
+// description Get the Thing Description with its registration information.
+func (e *entry) description() json.RawMessage {
+	registration := map[string]interface{}{
+		"created":  e.created.UTC().Format(time.RFC3339),
+		"modified": e.modified.UTC().Format(time.RFC3339),
+	}
+	if e.ttl > 0 {
+		registration["ttl"] = e.ttl.Seconds()
+		registration["expires"] = e.modified.Add(e.ttl).UTC().Format(time.RFC3339)
+	}
+	td := copyMap(e.td)
+	td["registration"] = registration
+	content, _ := json.Marshal(td)
+	return content
+}
+
+// match Check whether a Thing Description matches the query.
+func (q Query) match(td map[string]interface{}) bool {
+	if q.Type != "" && !contains(td["@type"], q.Type) {
+		return false
+	}
+	if q.Title != "" {
+		title, _ := td["title"].(string)
+		if !strings.Contains(strings.ToLower(title), strings.ToLower(q.Title)) {
+			return false
+		}
+	}
+	properties, _ := td["properties"].(map[string]interface{})
+	for _, capability := range q.Properties {
+		found := false
+		for name, property := range properties {
+			p, _ := property.(map[string]interface{})
+			if name == capability || contains(p["@type"], capability) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// contains Check whether an "@type" value, a string or a list of strings,
+// contains a type.
+func contains(types interface{}, t string) bool {
+	switch types := types.(type) {
+	case string:
+		return types == t
+	case []interface{}:
+		for _, v := range types {
+			if v == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parse Decode a Thing Description, which must be an object with a title.
+func parse(td []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(td, &m); err != nil || m == nil {
+		return nil, ErrInvalid
+	}
+	if title, _ := m["title"].(string); title == "" {
+		return nil, ErrInvalid
+	}
+	if id, ok := m["id"]; ok {
+		if s, _ := id.(string); s == "" {
+			return nil, ErrInvalid
+		}
+	}
+	return m, nil
+}
+
+// merge Apply a JSON merge patch to a value, RFC 7396.
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = merge(t[key], value)
+		}
+	}
+	return t
+}
+
+// copyMap Copy the top level of a Thing Description.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// deepCopy Copy a Thing Description so that patching it leaves the original
+// unchanged.
+func deepCopy(m map[string]interface{}) map[string]interface{} {
+	content, _ := json.Marshal(m)
+	var c map[string]interface{}
+	json.Unmarshal(content, &c)
+	return c
+}
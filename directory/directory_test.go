@@ -0,0 +1,32 @@
+package directory
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSearchPage(t *testing.T) {
+	d := New()
+	for i := 0; i < 5; i++ {
+		td := fmt.Sprintf(`{"id": "urn:dev:ops:%d", "title": "Thing %d"}`, i, i)
+		if _, err := d.Put(fmt.Sprintf("urn:dev:ops:%d", i), []byte(td)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	cases := []struct {
+		offset, limit, size int
+	}{
+		{0, 2, 2},
+		{-3, 2, 2},
+		{-3, -1, 5},
+		{4, 2, 1},
+		{9, 2, 0},
+	}
+	for _, c := range cases {
+		page, total := d.Search(Query{}, c.offset, c.limit)
+		if total != 5 || len(page) != c.size {
+			t.Fatalf("offset %d limit %d: expected %d of 5, got %d of %d", c.offset, c.limit, c.size, len(page), total)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/internal/httpapi"
+)
+
+// Media types of the directory API.
+const (
+	mediaTypeTD         = "application/td+json"
+	mediaTypeMergePatch = "application/merge-patch+json"
+)
+
+// Handler Get the handler serving the directory API at /things and
+// /search.
+func (d *Directory) Handler() http.Handler {
+	return d.handler("")
+}
+
+// Mount Serve the directory API of a thing server below a path.
+//
+// @param server The server
+// @param path   Path to serve the API below, e.g. "/directory"
+func (d *Directory) Mount(server *webthing.ThingServer, path string) {
+	prefix := strings.TrimRight(server.BasePath+path, "/")
+	h := d.handler(prefix)
+	server.Handle(prefix+"/things", h)
+	server.Handle(prefix+"/things/", h)
+	server.Handle(prefix+"/search", h)
+}
+
+func (d *Directory) handler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		path := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+
+		switch {
+		case path == "/things" || path == "/things/":
+			switch r.Method {
+			case http.MethodGet:
+				d.list(w, r, prefix+"/things", Query{})
+			case http.MethodPost:
+				d.register(w, r, prefix)
+			default:
+				httpapi.Problem(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		case strings.HasPrefix(path, "/things/"):
+			id, err := url.PathUnescape(strings.TrimPrefix(path, "/things/"))
+			if err != nil || id == "" {
+				httpapi.Problem(w, http.StatusBadRequest, "Invalid id")
+				return
+			}
+			d.thing(w, r, id)
+		case path == "/search":
+			if r.Method != http.MethodGet {
+				httpapi.Problem(w, http.StatusMethodNotAllowed, "Method not allowed")
+				return
+			}
+			query := r.URL.Query()
+			d.list(w, r, prefix+"/search", Query{
+				Type:       query.Get("type"),
+				Title:      query.Get("title"),
+				Properties: query["property"],
+			})
+		default:
+			httpapi.Problem(w, http.StatusNotFound, "Not found")
+		}
+	})
+}
+
+// list Write a page of Thing Descriptions, with a link to the next page.
+func (d *Directory) list(w http.ResponseWriter, r *http.Request, path string, query Query) {
+	params := r.URL.Query()
+	offset, limit := 0, DefaultLimit
+	var err error
+	if v := params.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			httpapi.Problem(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			httpapi.Problem(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	page, total := d.Search(query, offset, limit)
+	if offset+len(page) < total {
+		params.Set("offset", strconv.Itoa(offset+len(page)))
+		params.Set("limit", strconv.Itoa(limit))
+		w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, path, params.Encode()))
+	}
+	w.Header().Set("Content-Type", "application/ld+json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	content, _ := json.Marshal(page)
+	w.Write(content)
+}
+
+// register Register an anonymous Thing Description.
+func (d *Directory) register(w http.ResponseWriter, r *http.Request, prefix string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpapi.Problem(w, http.StatusBadRequest, "Invalid body")
+		return
+	}
+	id, err := d.Register(body)
+	if err != nil {
+		httpapi.Problem(w, http.StatusBadRequest, "Invalid Thing Description: an anonymous Thing Description with a title is required")
+		return
+	}
+	w.Header().Set("Location", prefix+"/things/"+url.PathEscape(id))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// thing Handle a request to /things/<id>.
+func (d *Directory) thing(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		td, ok := d.Get(id)
+		if !ok {
+			httpapi.Problem(w, http.StatusNotFound, "Thing Description not found")
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeTD)
+		w.Write(td)
+
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpapi.Problem(w, http.StatusBadRequest, "Invalid body")
+			return
+		}
+		created, err := d.Put(id, body)
+		if err != nil {
+			httpapi.Problem(w, http.StatusBadRequest, "Invalid Thing Description: a title and a matching id are required")
+			return
+		}
+		if created {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPatch:
+		if mediaType := r.Header.Get("Content-Type"); mediaType != "" && !strings.HasPrefix(mediaType, mediaTypeMergePatch) {
+			httpapi.Problem(w, http.StatusUnsupportedMediaType, "A merge patch is required")
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpapi.Problem(w, http.StatusBadRequest, "Invalid body")
+			return
+		}
+		switch err := d.Patch(id, body); err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case ErrNotFound:
+			httpapi.Problem(w, http.StatusNotFound, "Thing Description not found")
+		default:
+			httpapi.Problem(w, http.StatusBadRequest, "Invalid merge patch")
+		}
+
+	case http.MethodDelete:
+		if !d.Delete(id) {
+			httpapi.Problem(w, http.StatusNotFound, "Thing Description not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpapi.Problem(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
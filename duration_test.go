@@ -0,0 +1,36 @@
+package webthing
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	var policy NotifyPolicy
+	if err := json.Unmarshal([]byte(`{"minInterval": "100ms", "maxInterval": 60}`), &policy); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if policy.MinInterval != Duration(100*time.Millisecond) || policy.MaxInterval != Duration(time.Minute) {
+		t.Fatalf("Expected 100ms and 1m, got %v and %v", time.Duration(policy.MinInterval), time.Duration(policy.MaxInterval))
+	}
+
+	high := 80.0
+	content, err := json.Marshal(Alarm{Property: "temperature", High: &high, For: Duration(time.Second), Event: "overheated"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if want := `{"property":"temperature","high":80,"for":"1s","event":"overheated"}`; string(content) != want {
+		t.Fatalf("Expected %s, got %s", want, content)
+	}
+	var alarm Alarm
+	if err := json.Unmarshal(content, &alarm); err != nil || alarm.For != Duration(time.Second) {
+		t.Fatalf("Expected the duration to round-trip, got %v %v", time.Duration(alarm.For), err)
+	}
+
+	for _, invalid := range []string{`{"for": "soon"}`, `{"for": true}`} {
+		if err := json.Unmarshal([]byte(invalid), &alarm); err == nil {
+			t.Errorf("Expected %s to be invalid", invalid)
+		}
+	}
+}
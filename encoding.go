@@ -0,0 +1,256 @@
+package webthing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Media types of the supported encodings.
+const (
+	MediaTypeJSON        = "application/json"
+	MediaTypeCBOR        = "application/cbor"
+	MediaTypeMessagePack = "application/msgpack"
+)
+
+// WebSocket subprotocols selecting the encoding of messages. Messages are
+// sent in text frames with SubprotocolJSON and in binary frames otherwise.
+const (
+	SubprotocolJSON        = "webthing"
+	SubprotocolCBOR        = "webthing+cbor"
+	SubprotocolMessagePack = "webthing+msgpack"
+)
+
+// mediaTypes Supported media types by their names and aliases.
+var mediaTypes = map[string]string{
+	MediaTypeJSON:             MediaTypeJSON,
+	MediaTypeCBOR:             MediaTypeCBOR,
+	MediaTypeMessagePack:      MediaTypeMessagePack,
+	"application/x-msgpack":   MediaTypeMessagePack,
+	"application/vnd.msgpack": MediaTypeMessagePack,
+}
+
+// subprotocols Media types of the WebSocket subprotocols.
+var subprotocols = map[string]string{
+	SubprotocolJSON:        MediaTypeJSON,
+	SubprotocolCBOR:        MediaTypeCBOR,
+	SubprotocolMessagePack: MediaTypeMessagePack,
+}
+
+// cborDecMode Decode CBOR maps into map[string]interface{} so that they can
+// be encoded as JSON.
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+var errMediaType = errors.New("unsupported media type")
+
+// ToJSON Convert content of a supported media type to JSON.
+//
+// @param content   The content
+// @param mediaType Media type of the content
+func ToJSON(content []byte, mediaType string) ([]byte, error) {
+	mediaType = mediaTypes[mediaType]
+	if mediaType == MediaTypeJSON || len(content) == 0 {
+		return content, nil
+	}
+	var v interface{}
+	var err error
+	switch mediaType {
+	case MediaTypeCBOR:
+		err = cborDecMode.Unmarshal(content, &v)
+	case MediaTypeMessagePack:
+		err = msgpack.Unmarshal(content, &v)
+	default:
+		return nil, errMediaType
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// FromJSON Convert JSON content to a supported media type. Integral numbers
+// are encoded as integers.
+//
+// @param content   The JSON content
+// @param mediaType Media type to convert to
+func FromJSON(content []byte, mediaType string) ([]byte, error) {
+	mediaType = mediaTypes[mediaType]
+	if mediaType == MediaTypeJSON || len(content) == 0 {
+		return content, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	switch mediaType {
+	case MediaTypeCBOR:
+		return cbor.Marshal(integers(v))
+	case MediaTypeMessagePack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.UseCompactInts(true)
+		err := enc.Encode(integers(v))
+		return buf.Bytes(), err
+	}
+	return nil, errMediaType
+}
+
+// integers Replace the integral float64 numbers in a decoded JSON value.
+func integers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = integers(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = integers(value)
+		}
+	}
+	return v
+}
+
+// mediaTypeOf Get the supported media type of a Content-Type header, JSON
+// if it is missing.
+func mediaTypeOf(contentType string) (string, error) {
+	if contentType == "" {
+		return MediaTypeJSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", errMediaType
+	}
+	if supported, ok := mediaTypes[mediaType]; ok {
+		return supported, nil
+	}
+	return "", errMediaType
+}
+
+// negotiate Choose the media type of a response from an Accept header. JSON
+// is chosen for wildcards and when nothing else is acceptable.
+func negotiate(accept string) string {
+	chosen, best := MediaTypeJSON, 0.0
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if mediaType == "*/*" || mediaType == "application/*" {
+			mediaType = MediaTypeJSON
+		}
+		if supported, ok := mediaTypes[mediaType]; ok && q > best {
+			chosen, best = supported, q
+		}
+	}
+	return chosen
+}
+
+// decodeRequest Convert a CBOR or MessagePack request body to JSON. A body
+// of another media type is rejected with errMediaType.
+func decodeRequest(r *http.Request) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+	mediaType, err := mediaTypeOf(r.Header.Get("Content-Type"))
+	if err != nil || mediaType == MediaTypeJSON {
+		return err
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if body, err = ToJSON(body, mediaType); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Type", MediaTypeJSON)
+	return nil
+}
+
+// encodingWriter Buffer a JSON response and write it in another media type.
+type encodingWriter struct {
+	http.ResponseWriter
+	mediaType string
+	status    int
+	body      bytes.Buffer
+}
+
+func (w *encodingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *encodingWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// flush Write the converted response. Content that is not JSON is written
+// as it is.
+func (w *encodingWriter) flush() error {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	content := w.body.Bytes()
+	if converted, err := FromJSON(content, w.mediaType); err == nil && len(content) > 0 {
+		w.Header().Set("Content-Type", w.mediaType)
+		content = converted
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(content)
+	return err
+}
+
+// writeMessage Write a JSON message to a websocket in the encoding of its
+// subprotocol.
+func writeMessage(ws *websocket.Conn, content []byte) error {
+	mediaType, ok := subprotocols[ws.Subprotocol()]
+	if !ok || mediaType == MediaTypeJSON {
+		return ws.WriteMessage(websocket.TextMessage, content)
+	}
+	encoded, err := FromJSON(content, mediaType)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(websocket.BinaryMessage, encoded)
+}
+
+// readMessage Read a message from a websocket and convert it to JSON.
+func readMessage(ws *websocket.Conn) ([]byte, error) {
+	messageType, content, err := ws.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage {
+		return content, err
+	}
+	mediaType, ok := subprotocols[ws.Subprotocol()]
+	if !ok {
+		mediaType = MediaTypeJSON
+	}
+	if converted, err := ToJSON(content, mediaType); err == nil {
+		return converted, nil
+	}
+	return content, nil
+}
@@ -0,0 +1,81 @@
+package webthing
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoHandle Write the request body back.
+type echoHandle struct{}
+
+func (echoHandle) Put(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Write(body)
+}
+
+func TestRequestMediaType(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		echo        string
+	}{
+		{"missing", "", `{"on":true}`, http.StatusOK, `{"on":true}`},
+		{"json", "application/json; charset=utf-8", `{"on":true}`, http.StatusOK, `{"on":true}`},
+		{"cbor", MediaTypeCBOR, "\xa1\x62on\xf5", http.StatusOK, `{"on":true}`},
+		{"messagepack alias", "application/x-msgpack", "\x81\xa2on\xc3", http.StatusOK, `{"on":true}`},
+		{"invalid cbor", MediaTypeCBOR, "\xff", http.StatusBadRequest, ""},
+		{"unsupported", "text/plain", `{"on":true}`, http.StatusUnsupportedMediaType, ""},
+		{"form", "application/x-www-form-urlencoded", `on=true`, http.StatusUnsupportedMediaType, ""},
+		{"malformed", "application/", `{"on":true}`, http.StatusUnsupportedMediaType, ""},
+		{"no body", "text/plain", "", http.StatusOK, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/properties/on", strings.NewReader(c.body))
+			if c.contentType != "" {
+				r.Header.Set("Content-Type", c.contentType)
+			}
+			w := httptest.NewRecorder()
+			BaseHandle(echoHandle{}, w, r)
+			if w.Code != c.status {
+				t.Fatalf("Expected %d, got %d", c.status, w.Code)
+			}
+			if body := w.Body.String(); body != c.echo {
+				t.Fatalf("Expected the body %s, got %s", c.echo, body)
+			}
+		})
+	}
+}
+
+// TestFormBodyRejected A form body, as sent by curl -d without a
+// Content-Type, is rejected rather than decoded as JSON.
+func TestFormBodyRejected(t *testing.T) {
+	thing := NewThing("urn:dev:ops:form", "Form", nil, "")
+	thing.AddProperty(NewProperty(thing, "on", NewValue(false), []byte(`{"type": "boolean"}`)))
+	h := &PropertiesHandle{&ThingHandle{thing}}
+
+	put := func(contentType string) int {
+		r := httptest.NewRequest(http.MethodPut, "/properties/on", strings.NewReader(`{"on":true}`))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.Handle(w, r)
+		return w.Code
+	}
+	if code := put("application/x-www-form-urlencoded"); code != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected 415 for a form body, got %d", code)
+	}
+	if on := thing.Property("on").Get(); on != false {
+		t.Fatal("Expected the rejected body not to change the property")
+	}
+	if code := put("application/json"); code != http.StatusOK {
+		t.Fatalf("Expected 200 for a JSON body, got %d", code)
+	}
+	if on := thing.Property("on").Get(); on != true {
+		t.Fatal("Expected the JSON body to change the property")
+	}
+}
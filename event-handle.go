@@ -1,7 +1,6 @@
 package webthing
 
 import (
-	"fmt"
 	"net/http"
 )
 
@@ -23,7 +22,7 @@ func (h *EventHandle) Handle(w http.ResponseWriter, r *http.Request) {
 func (h *EventHandle) Get(w http.ResponseWriter, r *http.Request) {
 	if content := h.Thing.EventDescriptions(h.eventName); content != nil {
 		if _, err := w.Write(content); err != nil {
-			fmt.Print(err)
+			h.Thing.requestLog(r).Error("Write response failure", "error", err)
 		}
 	}
 }
@@ -1,8 +1,8 @@
 package webthing
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 )
 
 // Event An Event represents an individual event from a thing.
@@ -11,6 +11,9 @@ type Event struct {
 	name  string
 	data  json.RawMessage
 	time  string
+
+	// ctx Context carrying the span the event was traced in, if any.
+	ctx context.Context
 }
 
 // EventObject An event object describes a kind of event which may be emitted by a device.
@@ -52,7 +55,7 @@ func (event *Event) AsEventDescription() []byte {
 
 	description, err := json.Marshal(base)
 	if err != nil {
-		fmt.Println("Error:", err.Error())
+		event.thing.log("event", event.name).Error("Encode event failure", "error", err)
 	}
 
 	return description
@@ -1,7 +1,6 @@
 package webthing
 
 import (
-	"fmt"
 	"net/http"
 )
 
@@ -27,7 +26,7 @@ func (h *EventsHandle) Handle(w http.ResponseWriter, r *http.Request) {
 func (h *EventsHandle) Get(w http.ResponseWriter, r *http.Request) {
 	if content := h.Thing.EventDescriptions(""); content != nil {
 		if _, err := w.Write(content); err != nil {
-			fmt.Println(err)
+			h.Thing.requestLog(r).Error("Write response failure", "error", err)
 		}
 	}
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"math"
@@ -105,6 +104,38 @@ func MakeDimmableLight() *webthing.Thing {
             "unit": "degree celsius"
         }`))
 
+	thing.AddAvailableEvent("cooled",
+		[]byte(`{
+            "description":
+            "The lamp is back to its safe operating temperature",
+            "type": "number",
+            "unit": "degree celsius"
+        }`))
+
+	// Adding a temperature, raising overheated above 90 degrees for a second
+	// and cooled below 85 degrees.
+	thing.AddProperty(webthing.NewProperty(thing,
+		"temperature",
+		webthing.NewValue(60.0),
+		[]byte(`{
+    "@type": "TemperatureProperty",
+    "type": "number",
+    "title": "Temperature",
+    "unit": "degree celsius",
+    "readOnly": true
+  }`)))
+	high := 90.0
+	if err := thing.AddAlarm(webthing.Alarm{
+		Property:   "temperature",
+		High:       &high,
+		Hysteresis: 5,
+		For:        webthing.Duration(time.Second),
+		Event:      "overheated",
+		ClearEvent: "cooled",
+	}); err != nil {
+		log.Fatal(err)
+	}
+
 	return thing
 }
 
@@ -113,6 +144,12 @@ type FadeAction struct {
 	*webthing.Action
 }
 
+// fadeInput The input of a fade action.
+type fadeInput struct {
+	Brightness int `json:"brightness"`
+	Duration   int `json:"duration"`
+}
+
 // Generator  Action generate.
 func (fade *FadeAction) Generator(thing *webthing.Thing) *webthing.Action {
 	fade.Action = webthing.NewAction(uuid.New().String(), thing, "fade", nil, fade.PerformAction, fade.Cancel)
@@ -123,24 +160,25 @@ func (fade *FadeAction) Generator(thing *webthing.Thing) *webthing.Action {
 func (fade *FadeAction) PerformAction() *webthing.Action {
 	fmt.Println("Perform fade action…...: ", fade.Name(), " | UUID: ", fade.ID())
 	thing := fade.Thing()
-	params, _ := fade.Input().MarshalJSON()
-
-	input := make(map[string]interface{})
-	if err := json.Unmarshal(params, &input); err != nil {
-		fmt.Println("PerformAction error ",err)
+	input, err := webthing.InputOf[fadeInput](fade.Action)
+	if err != nil {
+		fmt.Println("PerformAction error ", err)
 		return nil
 	}
-	if brightness, ok := input["brightness"]; ok {
-		fmt.Println("Set brightness value: ", brightness)
-		thing.Property("brightness").Set(brightness)
-	}
-	if duration, ok := input["duration"]; ok {
-		fmt.Println("Fade duration: ", duration)
-		time.Sleep(time.Duration(int64(duration.(float64))) * time.Millisecond)
-	}
 
-	event := webthing.NewEvent(thing, "overheated", []byte(fmt.Sprintln(102)))
-	thing.AddEvent(event)
+	fmt.Println("Set brightness value: ", input.Brightness)
+	brightness, _ := webthing.PropertyOf[int](thing, "brightness")
+	brightness.Set(input.Brightness)
+	// Fading heats the lamp up to 102 degrees, which raises overheated once
+	// it lasts a second, and the lamp cools down a minute later.
+	temperature, _ := webthing.PropertyOf[float64](thing, "temperature")
+	temperature.NotifyOfExternalUpdate(102)
+	time.AfterFunc(time.Minute, func() {
+		temperature.NotifyOfExternalUpdate(20 + 0.8*float64(input.Brightness))
+	})
+
+	fmt.Println("Fade duration: ", input.Duration)
+	time.Sleep(time.Duration(input.Duration) * time.Millisecond)
 
 	fmt.Println("Fade action Done...", fade.Name())
 	return fade.Action
@@ -167,20 +205,25 @@ func FakeGpioHumiditySensor() *webthing.Thing {
         "unit": "percent",
         "readOnly": true
   }`)
-	thing.AddProperty(webthing.NewProperty(
+	property := webthing.NewProperty(
 		thing,
 		"level",
 		level,
-		levelDescription))
+		levelDescription)
+	thing.AddProperty(property)
+
+	// Keeping the readings of the last day for charts at
+	// /properties/level/history.
+	property.SetHistory(webthing.NewRingHistory(30000, 24*time.Hour))
 
-	go func(level webthing.Value) {
+	go func(level *webthing.Value) {
 		for {
 			time.Sleep(3000 * time.Millisecond)
 			newLevel := readFromGPIO()
 			fmt.Println("setting new humidity level:", newLevel)
 			level.NotifyOfExternalUpdate(newLevel)
 		}
-	}(level)
+	}(property.Value())
 
 	return thing
 }
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
 	"time"
 
@@ -55,10 +53,29 @@ func MakeThing() *webthing.Thing {
 	  "unit": "percent"
 	}`)
 
-	thing.AddProperty(webthing.NewProperty(thing,
+	// The brightness is an int, also when written as a JSON number.
+	brightness := webthing.NewTypedProperty(thing,
 		"brightness",
-		webthing.NewValue(50),
-		brightnessDescription))
+		webthing.NewTypedValue(50),
+		brightnessDescription)
+	thing.AddProperty(brightness.Property)
+
+	// Adding a property computed from the brightness.
+	isBright, err := webthing.NewComputedProperty(thing,
+		"isBright",
+		[]*webthing.Property{brightness.Property},
+		func(inputs []interface{}) interface{} {
+			return inputs[0].(int) >= 80
+		},
+		[]byte(`{
+    "type": "boolean",
+    "title": "Bright",
+    "description": "Whether the lamp is at 80% or more"
+	}`))
+	if err != nil {
+		log.Fatal(err)
+	}
+	thing.AddProperty(isBright)
 
 	//Adding a Fade action to this Lamp.
 	fadeMeta := []byte(`{
@@ -97,6 +114,38 @@ func MakeThing() *webthing.Thing {
             "unit": "degree celsius"
         }`))
 
+	thing.AddAvailableEvent("cooled",
+		[]byte(`{
+            "description":
+            "The lamp is back to its safe operating temperature",
+            "type": "number",
+            "unit": "degree celsius"
+        }`))
+
+	// Adding a temperature, raising overheated above 90 degrees for a second
+	// and cooled below 85 degrees.
+	thing.AddProperty(webthing.NewProperty(thing,
+		"temperature",
+		webthing.NewValue(60.0),
+		[]byte(`{
+    "@type": "TemperatureProperty",
+    "type": "number",
+    "title": "Temperature",
+    "unit": "degree celsius",
+    "readOnly": true
+  }`)))
+	high := 90.0
+	if err := thing.AddAlarm(webthing.Alarm{
+		Property:   "temperature",
+		High:       &high,
+		Hysteresis: 5,
+		For:        webthing.Duration(time.Second),
+		Event:      "overheated",
+		ClearEvent: "cooled",
+	}); err != nil {
+		log.Fatal(err)
+	}
+
 	toggleMeta := []byte(`{
 	  "title": "Toggle",
 	  "description": "Toggles a boolean state on and off."
@@ -112,6 +161,12 @@ type FadeAction struct {
 	*webthing.Action
 }
 
+// fadeInput The input of a fade action.
+type fadeInput struct {
+	Brightness int `json:"brightness"`
+	Duration   int `json:"duration"`
+}
+
 func (fade *FadeAction) Generator(thing *webthing.Thing) *webthing.Action {
 	fade.Action = webthing.NewAction(uuid.New().String(), thing, "fade", nil, fade.PerformAction, fade.Cancel)
 	return fade.Action
@@ -120,23 +175,25 @@ func (fade *FadeAction) Generator(thing *webthing.Thing) *webthing.Action {
 func (fade *FadeAction) PerformAction() *webthing.Action {
 	fmt.Println("Perform fade action…...: ", fade.Name(), " | UUID: ", fade.ID())
 	thing := fade.Thing()
-	params, _ := fade.Input().MarshalJSON()
-
-	input := make(map[string]interface{})
-	if err := json.Unmarshal(params, &input); err != nil {
+	input, err := webthing.InputOf[fadeInput](fade.Action)
+	if err != nil {
 		fmt.Println(err)
-	}
-	if brightness, ok := input["brightness"]; ok {
-		fmt.Println("Set brightness value: ", brightness)
-		thing.Property("brightness").Set(brightness)
-	}
-	if duration, ok := input["duration"]; ok {
-		fmt.Println("Fade duration: ", duration)
-		time.Sleep(time.Duration(int64(duration.(float64))) * time.Millisecond)
+		return fade.Action
 	}
 
-	event := webthing.NewEvent(thing, "overheated", []byte(fmt.Sprintln(102)))
-	thing.AddEvent(event)
+	fmt.Println("Set brightness value: ", input.Brightness)
+	brightness, _ := webthing.PropertyOf[int](thing, "brightness")
+	brightness.Set(input.Brightness)
+	// Fading heats the lamp up to 102 degrees, which raises overheated once
+	// it lasts a second, and the lamp cools down a minute later.
+	temperature, _ := webthing.PropertyOf[float64](thing, "temperature")
+	temperature.NotifyOfExternalUpdate(102)
+	time.AfterFunc(time.Minute, func() {
+		temperature.NotifyOfExternalUpdate(20 + 0.8*float64(input.Brightness))
+	})
+
+	fmt.Println("Fade duration: ", input.Duration)
+	time.Sleep(time.Duration(input.Duration) * time.Millisecond)
 
 	fmt.Println("Fade action Done...", fade.Name())
 	return fade.Action
@@ -160,13 +217,8 @@ func (toggle *ToggleAction) Generator(thing *webthing.Thing) *webthing.Action {
 func (toggle *ToggleAction) PerformAction() *webthing.Action {
 	fmt.Println("Perform toggle action...: ", toggle.Name(), " | UUID: ", toggle.ID())
 
-	thing := toggle.Thing()
-	property := thing.Property("on")
-	on := property.Get().(bool)
-	property.Set(!on)
-
-	event := webthing.NewEvent(thing, "overheated", []byte(fmt.Sprintln(rand.Intn(100))))
-	thing.AddEvent(event)
+	on, _ := webthing.PropertyOf[bool](toggle.Thing(), "on")
+	on.Set(!on.Get())
 
 	fmt.Println("Toggle action done...")
 	return toggle.Action
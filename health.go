@@ -0,0 +1,150 @@
+package webthing
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// ConnectivityState Whether the device behind a thing can be reached.
+type ConnectivityState string
+
+const (
+	// Online The device is reachable.
+	Online ConnectivityState = "online"
+
+	// Degraded The device is reachable but does not work fully.
+	Degraded ConnectivityState = "degraded"
+
+	// Offline The device cannot be reached.
+	Offline ConnectivityState = "offline"
+)
+
+// Connectivity The connectivity of the device behind a thing.
+type Connectivity struct {
+	State ConnectivityState `json:"state"`
+
+	// Reason Why the device is degraded or offline.
+	Reason string `json:"reason,omitempty"`
+
+	// LastSeen When the device was last known to be reachable.
+	LastSeen string `json:"lastSeen,omitempty"`
+}
+
+// Connectivity Get the connectivity of the device behind this thing. Things
+// are online unless set otherwise.
+func (thing *Thing) Connectivity() Connectivity {
+	thing.connectivityMu.RLock()
+	defer thing.connectivityMu.RUnlock()
+	if thing.connectivity.State == "" {
+		return Connectivity{State: Online, LastSeen: thing.connectivity.LastSeen}
+	}
+	return thing.connectivity
+}
+
+// SetConnectivity Set the connectivity of the device behind this thing and
+// notify subscribers if it changed. Setting it online also marks the device
+// as seen.
+//
+// @param state  The connectivity state
+// @param reason Why the device is degraded or offline, if known
+func (thing *Thing) SetConnectivity(state ConnectivityState, reason string) {
+	thing.connectivityMu.Lock()
+	previous := thing.connectivity
+	thing.connectivity.State = state
+	thing.connectivity.Reason = reason
+	if state == Online {
+		thing.connectivity.LastSeen = Timestamp()
+	}
+	current := thing.connectivity
+	thing.connectivityMu.Unlock()
+
+	if previous.State != current.State || previous.Reason != current.Reason {
+		thing.ConnectivityNotify()
+	}
+}
+
+// Seen Mark the device behind this thing as seen now, e.g. when it reports
+// a value.
+func (thing *Thing) Seen() {
+	thing.connectivityMu.Lock()
+	defer thing.connectivityMu.Unlock()
+	thing.connectivity.LastSeen = Timestamp()
+}
+
+// ConnectivityNotify Notify all subscribers of the connectivity of the
+// device.
+func (thing *Thing) ConnectivityNotify() error {
+	data, err := json.Marshal(thing.Connectivity())
+	if err != nil {
+		return err
+	}
+	return thing.notify(thing.subscribers, "connectivityStatus", data)
+}
+
+// healthThing The health of a thing in the /health response.
+type healthThing struct {
+	ID           string       `json:"id"`
+	Title        string       `json:"title"`
+	Href         string       `json:"href"`
+	Connectivity Connectivity `json:"connectivity"`
+}
+
+// HealthHandle Handle requests to /health, /health/live and /health/ready.
+type HealthHandle struct {
+	server *ThingServer
+}
+
+// Handle Handle a request to /health.
+func (h *HealthHandle) Handle(w http.ResponseWriter, r *http.Request) {
+	corsResponse(w)
+	jsonResponse(w)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/live"):
+		// The server answers, so it is alive.
+		w.Write([]byte(`{"status":"ok"}`))
+		return
+	case strings.HasSuffix(r.URL.Path, "/ready"):
+		if atomic.LoadInt32(&h.server.shuttingDown) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"shutting down"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+		return
+	}
+
+	// The server is healthy if all devices are online, degraded if any
+	// device is degraded or offline.
+	status := "ok"
+	things := []healthThing{}
+	for _, thing := range h.server.Things {
+		connectivity := thing.Connectivity()
+		if connectivity.State != Online {
+			status = "degraded"
+		}
+		things = append(things, healthThing{
+			ID:           thing.ID(),
+			Title:        thing.Title(),
+			Href:         thing.Href(),
+			Connectivity: connectivity,
+		})
+	}
+	if atomic.LoadInt32(&h.server.shuttingDown) == 1 {
+		status = "shutting down"
+	}
+
+	content, _ := json.Marshal(map[string]interface{}{
+		"status": status,
+		"things": things,
+	})
+	if _, err := w.Write(content); err != nil {
+		h.server.Logger().Error("Write response failure", "request", RequestID(r), "error", err)
+	}
+}
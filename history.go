@@ -0,0 +1,273 @@
+package webthing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sample A value of a property at a time.
+type Sample struct {
+	Time  time.Time   `json:"time"`
+	Value interface{} `json:"value"`
+}
+
+// Bucket The numeric samples of a time interval, aggregated.
+type Bucket struct {
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Count int       `json:"count"`
+}
+
+// History A time series of the values of a property.
+type History interface {
+	// Add Record a value.
+	//
+	// @param sample The value and the time it was set
+	Add(sample Sample)
+
+	// Range Get the values recorded in a time range, oldest first.
+	//
+	// @param from Start of the range, inclusive, unbounded if zero
+	// @param to   End of the range, exclusive, unbounded if zero
+	// @return The samples.
+	Range(from, to time.Time) []Sample
+}
+
+// RingHistory A history keeping the latest values in memory.
+type RingHistory struct {
+	mu      sync.Mutex
+	samples []Sample
+	start   int
+	count   int
+	maxAge  time.Duration
+}
+
+// NewRingHistory Create a history of at most size values.
+//
+// @param size   The number of values kept
+// @param maxAge How long values are kept, forever if zero
+func NewRingHistory(size int, maxAge time.Duration) *RingHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &RingHistory{samples: make([]Sample, size), maxAge: maxAge}
+}
+
+// Add Record a value, dropping the oldest one if the history is full.
+//
+// @param sample The value and the time it was set
+func (h *RingHistory) Add(sample Sample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[(h.start+h.count)%len(h.samples)] = sample
+	if h.count < len(h.samples) {
+		h.count++
+	} else {
+		h.start = (h.start + 1) % len(h.samples)
+	}
+}
+
+// Range Get the values recorded in a time range, oldest first.
+//
+// @param from Start of the range, inclusive, unbounded if zero
+// @param to   End of the range, exclusive, unbounded if zero
+func (h *RingHistory) Range(from, to time.Time) []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.maxAge > 0 {
+		if oldest := time.Now().Add(-h.maxAge); from.Before(oldest) {
+			from = oldest
+		}
+	}
+	samples := []Sample{}
+	for i := 0; i < h.count; i++ {
+		sample := h.samples[(h.start+i)%len(h.samples)]
+		if !from.IsZero() && sample.Time.Before(from) || !to.IsZero() && !sample.Time.Before(to) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Downsample Aggregate numeric samples into buckets of a duration, aligned
+// to multiples of the duration. Buckets without samples are left out.
+//
+// @param samples The samples, oldest first
+// @param size    The duration of a bucket
+// @return The buckets, or an error if a value is not a number.
+func Downsample(samples []Sample, size time.Duration) ([]Bucket, error) {
+	buckets := []Bucket{}
+	for _, sample := range samples {
+		v, ok := Number(sample.Value)
+		if !ok {
+			return nil, fmt.Errorf("Not a number: %v", sample.Value)
+		}
+		start := sample.Time.Truncate(size)
+		if n := len(buckets); n == 0 || !buckets[n-1].Time.Equal(start) {
+			buckets = append(buckets, Bucket{Time: start, Min: v, Max: v})
+		}
+		b := &buckets[len(buckets)-1]
+		if v < b.Min {
+			b.Min = v
+		}
+		if v > b.Max {
+			b.Max = v
+		}
+		b.Avg += (v - b.Avg) / float64(b.Count+1)
+		b.Count++
+	}
+	return buckets, nil
+}
+
+// SetHistory Record the values of this property in a history, starting with
+// the current value. Set it before the thing is served.
+//
+// @param history The history, nil to stop recording
+func (property *Property) SetHistory(history History) {
+	property.history = history
+	if history != nil && property.value != nil && property.value.Get() != nil {
+		history.Add(Sample{Time: time.Now(), Value: property.value.Get()})
+	}
+}
+
+// History Get the history of this property.
+//
+// @returns The history, or nil if values are not recorded.
+func (property *Property) History() History {
+	return property.history
+}
+
+// record Add the current value of a property to its history, if any.
+func (property *Property) record() {
+	if history := property.History(); history != nil {
+		history.Add(Sample{Time: time.Now(), Value: property.value.Get()})
+	}
+}
+
+// historyPath Matches the path of the history of a property.
+var historyPath = regexp.MustCompile(`properties/([a-zA-Z0-9]+)/history$`)
+
+// HistoryHandle Handle a request to /properties/<property>/history.
+//
+// The query parameters from and to limit the time range, as RFC 3339 times
+// or as durations before now, limit keeps the latest values or buckets and
+// bucket aggregates numeric values into min, max and average per duration.
+type HistoryHandle struct {
+	*PropertiesHandle
+	*Property
+}
+
+// Handle a request to /properties/<property>/history.
+func (h *HistoryHandle) Handle(w http.ResponseWriter, r *http.Request) {
+	m := historyPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	property, ok := h.findProperty(m[1])
+	if !ok || property.History() == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.Property = property
+	BaseHandle(h, w, r)
+}
+
+// Get Handle a GET request.
+//
+// @param {Object} r The request object
+// @param {Object} w The response object
+func (h *HistoryHandle) Get(w http.ResponseWriter, r *http.Request) {
+	name := h.Property.Name()
+	query := r.URL.Query()
+	now := time.Now()
+
+	from, err := historyTime(query.Get("from"), now)
+	if err != nil {
+		h.historyError(w, r, err)
+		return
+	}
+	to, err := historyTime(query.Get("to"), now)
+	if err != nil {
+		h.historyError(w, r, err)
+		return
+	}
+	limit := 0
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+			h.historyError(w, r, errors.New("Invalid limit: "+s))
+			return
+		}
+	}
+
+	samples := h.Property.History().Range(from, to)
+	var result interface{} = latest(samples, limit)
+	if s := query.Get("bucket"); s != "" {
+		size, err := time.ParseDuration(s)
+		if err != nil || size <= 0 {
+			h.historyError(w, r, errors.New("Invalid bucket: "+s))
+			return
+		}
+		buckets, err := Downsample(samples, size)
+		if err != nil {
+			h.historyError(w, r, err)
+			return
+		}
+		result = latest(buckets, limit)
+	}
+
+	content, err := json.Marshal(result)
+	if err != nil {
+		h.PropertiesHandle.Thing.requestLog(r, "property", name).Error("Encode history failure", "error", err)
+	}
+	if _, err := w.Write(content); err != nil {
+		h.PropertiesHandle.Thing.requestLog(r, "property", name).Error("Write response failure", "error", err)
+	}
+}
+
+func (h *HistoryHandle) historyError(w http.ResponseWriter, r *http.Request, err error) {
+	h.PropertiesHandle.Thing.requestLog(r, "property", h.Property.Name()).Debug("Invalid history request", "error", err)
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+// historyTime Parse an RFC 3339 time or a duration before now.
+func historyTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid time: " + s)
+	}
+	if d > 0 {
+		d = -d
+	}
+	return now.Add(d), nil
+}
+
+// latest Keep the last limit elements of a slice, all if limit is zero.
+func latest(v interface{}, limit int) interface{} {
+	switch v := v.(type) {
+	case []Sample:
+		if limit > 0 && len(v) > limit {
+			return v[len(v)-limit:]
+		}
+	case []Bucket:
+		if limit > 0 && len(v) > limit {
+			return v[len(v)-limit:]
+		}
+	}
+	return v
+}
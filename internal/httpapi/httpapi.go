@@ -0,0 +1,58 @@
+// Package httpapi Helpers shared by the JSON APIs of the rules, schedule
+// and directory packages, and by the HTTP instrumentation of the server
+// and the metrics package.
+package httpapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// WriteJSON Write a value as a JSON response.
+//
+// @param w      The response writer
+// @param status The status code
+// @param v      The value
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	content, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+// Problem Write an error as problem details, RFC 7807.
+//
+// @param w      The response writer
+// @param status The status code
+// @param detail Explanation of the error
+func Problem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	content, _ := json.Marshal(map[string]interface{}{
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	})
+	w.Write(content)
+}
+
+// Decode Decode the JSON body of a request, writing a 400 response with the
+// given detail if it is invalid.
+//
+// @param w      The response writer
+// @param r      The request
+// @param v      Pointer to the value to decode into
+// @param detail Explanation written if the body is invalid
+// @return Whether the body was decoded.
+func Decode(w http.ResponseWriter, r *http.Request, v interface{}, detail string) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		Problem(w, http.StatusBadRequest, detail)
+		return false
+	}
+	return true
+}
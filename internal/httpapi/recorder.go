@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// StatusRecorder A ResponseWriter remembering the status code of the
+// response.
+//
+// It passes Hijack and Flush through so websocket upgrades keep working.
+type StatusRecorder struct {
+	http.ResponseWriter
+
+	// Code The status code of the response, 101 once hijacked.
+	Code int
+
+	// Hijacked Whether the connection was hijacked, e.g. by a websocket.
+	Hijacked bool
+
+	wroteHeader bool
+}
+
+// NewStatusRecorder Record the status code of a response, 200 unless
+// another one is written.
+//
+// @param w The response writer
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Code: http.StatusOK}
+}
+
+func (r *StatusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.Code = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *StatusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.Hijacked = true
+		r.Code = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,497 @@
+package webthing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Registry Bind the names used by thing definitions to Go handlers.
+type Registry struct {
+	actions    map[string]Actioner
+	forwarders map[string]func(interface{})
+}
+
+// NewRegistry Initialize an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		actions:    make(map[string]Actioner),
+		forwarders: make(map[string]func(interface{})),
+	}
+}
+
+// RegisterAction Bind an action handler name to an action.
+//
+// @param name   Name used by the "handler" key of action definitions
+// @param action Instance for the action
+func (r *Registry) RegisterAction(name string, action Actioner) {
+	r.actions[name] = action
+}
+
+// RegisterForwarder Bind a value forwarder name to a method.
+//
+// @param name      Name used by the "forwarder" key of property definitions
+// @param forwarder The method that updates the actual value on the thing
+func (r *Registry) RegisterForwarder(name string, forwarder func(interface{})) {
+	r.forwarders[name] = forwarder
+}
+
+// LoadError An error in a thing definition.
+type LoadError struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *LoadError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "definition"
+	}
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", file, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", file, e.Line, e.Column, e.Msg)
+}
+
+// ThingDefinition A declarative description of a thing.
+//
+// The document format is a Thing Description whose properties may carry the
+// additional keys "value" (the initial value), "forwarder" (the name of a
+// registered value forwarder), "persist" (false to opt out of persistence),
+// "history" (the number of values recorded in a RingHistory), "notify" (a
+// NotifyPolicy) and "alarms" (a list of Alarm objects without "property"),
+// and whose actions may carry the key "handler" (the name of a registered
+// action, defaulting to the action name).
+type ThingDefinition struct {
+	ID          string
+	Title       string
+	Type        []string
+	Description string
+	Properties  map[string]*PropertyDefinition
+	Actions     map[string]*ActionDefinition
+	Events      map[string]*EventDefinition
+
+	file string
+	node *yaml.Node
+}
+
+// PropertyDefinition A declarative description of a property.
+type PropertyDefinition struct {
+	Value     interface{}
+	Forwarder string
+	Persist   bool
+	History   int
+	Notify    *NotifyPolicy
+	Alarms    []Alarm
+	Metadata  map[string]interface{}
+
+	node *yaml.Node
+}
+
+// ActionDefinition A declarative description of an action.
+type ActionDefinition struct {
+	Handler  string
+	Metadata map[string]interface{}
+
+	node *yaml.Node
+}
+
+// EventDefinition A declarative description of an event.
+type EventDefinition struct {
+	Metadata map[string]interface{}
+
+	node *yaml.Node
+}
+
+// LoadThings Build things from a JSON or YAML document.
+//
+// @param data     The document, holding a single thing or a list of things
+// @param registry Handlers referenced by the document
+// @return The things.
+func LoadThings(data []byte, registry *Registry) ([]*Thing, error) {
+	definitions, err := ParseThingDefinitions(data)
+	if err != nil {
+		return nil, err
+	}
+	return buildThings(definitions, registry)
+}
+
+// LoadThingsFile Build things from a JSON or YAML file.
+//
+// @param path     Path of the file
+// @param registry Handlers referenced by the document
+// @return The things.
+func LoadThingsFile(path string, registry *Registry) ([]*Thing, error) {
+	definitions, err := ParseThingDefinitionsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return buildThings(definitions, registry)
+}
+
+func buildThings(definitions []*ThingDefinition, registry *Registry) ([]*Thing, error) {
+	things := make([]*Thing, 0, len(definitions))
+	for _, definition := range definitions {
+		thing, err := definition.Build(registry)
+		if err != nil {
+			return nil, err
+		}
+		things = append(things, thing)
+	}
+	return things, nil
+}
+
+// ParseThingDefinitionsFile Parse the thing definitions of a JSON or YAML
+// file.
+//
+// @param path Path of the file
+// @return The definitions.
+func ParseThingDefinitionsFile(path string) ([]*ThingDefinition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := ParseThingDefinitions(data)
+	if e, ok := err.(*LoadError); ok {
+		e.File = path
+	}
+	for _, definition := range definitions {
+		definition.file = path
+	}
+	return definitions, err
+}
+
+// ParseThingDefinitions Parse the thing definitions of a JSON or YAML
+// document.
+//
+// @param data The document, holding a single thing or a list of things
+// @return The definitions.
+func ParseThingDefinitions(data []byte) ([]*ThingDefinition, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		// Report JSON syntax errors with their exact position.
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			if e, ok := err.(*json.SyntaxError); ok {
+				line, column := position(data, e.Offset)
+				return nil, &LoadError{Line: line, Column: column, Msg: e.Error()}
+			}
+			return nil, &LoadError{Msg: err.Error()}
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, &LoadError{Msg: err.Error()}
+	}
+	if len(doc.Content) == 0 {
+		return nil, &LoadError{Msg: "empty document"}
+	}
+
+	root := doc.Content[0]
+	nodes := []*yaml.Node{root}
+	if root.Kind == yaml.SequenceNode {
+		nodes = root.Content
+	}
+
+	var definitions []*ThingDefinition
+	for _, node := range nodes {
+		definition, err := parseThingDefinition(node)
+		if err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
+
+func parseThingDefinition(node *yaml.Node) (*ThingDefinition, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nodeError(node, "a thing must be an object")
+	}
+	definition := &ThingDefinition{
+		Properties: make(map[string]*PropertyDefinition),
+		Actions:    make(map[string]*ActionDefinition),
+		Events:     make(map[string]*EventDefinition),
+		node:       node,
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		var err error
+		switch key.Value {
+		case "id":
+			err = decodeNode(value, &definition.ID)
+		case "title":
+			err = decodeNode(value, &definition.Title)
+		case "description":
+			err = decodeNode(value, &definition.Description)
+		case "@type":
+			if value.Kind == yaml.ScalarNode {
+				definition.Type = []string{value.Value}
+			} else {
+				err = decodeNode(value, &definition.Type)
+			}
+		case "properties":
+			err = forEachMember(value, func(name string, member *yaml.Node, metadata map[string]interface{}) error {
+				property := &PropertyDefinition{Metadata: metadata, Persist: true, node: member}
+				property.Value = metadata["value"]
+				delete(metadata, "value")
+				if persist, ok := metadata["persist"]; ok {
+					if property.Persist, ok = persist.(bool); !ok {
+						return nodeError(memberNode(member, "persist"), "persist must be a boolean")
+					}
+					delete(metadata, "persist")
+				}
+				if forwarder, ok := metadata["forwarder"]; ok {
+					if property.Forwarder, ok = forwarder.(string); !ok {
+						return nodeError(memberNode(member, "forwarder"), "forwarder must be a string")
+					}
+					delete(metadata, "forwarder")
+				}
+				if history, ok := metadata["history"]; ok {
+					size, ok := Number(history)
+					if !ok || size < 1 || size != float64(int(size)) {
+						return nodeError(memberNode(member, "history"), "history must be a positive integer")
+					}
+					property.History = int(size)
+					delete(metadata, "history")
+				}
+				if notify, ok := metadata["notify"]; ok {
+					if err := convertValue(notify, &property.Notify); err != nil {
+						return nodeError(memberNode(member, "notify"), "invalid notify: "+err.Error())
+					}
+					delete(metadata, "notify")
+				}
+				if alarms, ok := metadata["alarms"]; ok {
+					if err := convertValue(alarms, &property.Alarms); err != nil {
+						return nodeError(memberNode(member, "alarms"), "invalid alarms: "+err.Error())
+					}
+					delete(metadata, "alarms")
+				}
+				definition.Properties[name] = property
+				return nil
+			})
+		case "actions":
+			err = forEachMember(value, func(name string, member *yaml.Node, metadata map[string]interface{}) error {
+				action := &ActionDefinition{Handler: name, Metadata: metadata, node: member}
+				if handler, ok := metadata["handler"]; ok {
+					if action.Handler, ok = handler.(string); !ok {
+						return nodeError(memberNode(member, "handler"), "handler must be a string")
+					}
+					delete(metadata, "handler")
+				}
+				definition.Actions[name] = action
+				return nil
+			})
+		case "events":
+			err = forEachMember(value, func(name string, member *yaml.Node, metadata map[string]interface{}) error {
+				definition.Events[name] = &EventDefinition{Metadata: metadata, node: member}
+				return nil
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if definition.ID == "" {
+		return nil, nodeError(node, "a thing requires an id")
+	}
+	if definition.Title == "" {
+		return nil, nodeError(node, "a thing requires a title")
+	}
+	return definition, nil
+}
+
+// Build Build the thing described by the definition.
+//
+// @param registry Handlers referenced by the definition
+// @return The thing.
+func (definition *ThingDefinition) Build(registry *Registry) (*Thing, error) {
+	if registry == nil {
+		registry = NewRegistry()
+	}
+	thing := NewThing(definition.ID, definition.Title, definition.Type, definition.Description)
+
+	for _, name := range sortedKeys(definition.Properties) {
+		property := definition.Properties[name]
+		var forwarders []func(interface{})
+		if property.Forwarder != "" {
+			forwarder, ok := registry.forwarders[property.Forwarder]
+			if !ok {
+				return nil, definition.errorAt(memberNode(property.node, "forwarder"),
+					fmt.Sprintf("property %q: unknown forwarder %q", name, property.Forwarder))
+			}
+			forwarders = append(forwarders, forwarder)
+		}
+		metadata, err := json.Marshal(property.Metadata)
+		if err != nil {
+			return nil, definition.errorAt(property.node, fmt.Sprintf("property %q: %v", name, err))
+		}
+		p := NewProperty(thing, name, NewValue(property.Value, forwarders...), metadata)
+		if property.Value != nil {
+			if err := p.validateType(property.Value); err != nil {
+				return nil, definition.errorAt(memberNode(property.node, "value"),
+					fmt.Sprintf("property %q: %v", name, err))
+			}
+		}
+		p.SetPersistent(property.Persist)
+		if property.Notify != nil {
+			p.SetNotifyPolicy(*property.Notify)
+		}
+		thing.AddProperty(p)
+		if property.History > 0 {
+			p.SetHistory(NewRingHistory(property.History, 0))
+		}
+	}
+
+	for _, name := range sortedKeys(definition.Actions) {
+		action := definition.Actions[name]
+		cls, ok := registry.actions[action.Handler]
+		if !ok {
+			node := memberNode(action.node, "handler")
+			if node == nil {
+				node = action.node
+			}
+			return nil, definition.errorAt(node, fmt.Sprintf("action %q: unknown handler %q", name, action.Handler))
+		}
+		metadata, err := json.Marshal(action.Metadata)
+		if err != nil {
+			return nil, definition.errorAt(action.node, fmt.Sprintf("action %q: %v", name, err))
+		}
+		thing.AddAvailableAction(name, metadata, cls)
+	}
+
+	for _, name := range sortedKeys(definition.Events) {
+		event := definition.Events[name]
+		metadata, err := json.Marshal(event.Metadata)
+		if err != nil {
+			return nil, definition.errorAt(event.node, fmt.Sprintf("event %q: %v", name, err))
+		}
+		thing.AddAvailableEvent(name, metadata)
+	}
+
+	for _, name := range sortedKeys(definition.Properties) {
+		property := definition.Properties[name]
+		for _, alarm := range property.Alarms {
+			alarm.Property = name
+			if err := thing.AddAlarm(alarm); err != nil {
+				return nil, definition.errorAt(memberNode(property.node, "alarms"),
+					fmt.Sprintf("property %q: %v", name, err))
+			}
+		}
+	}
+
+	return thing, nil
+}
+
+// Line Get the line the thing is defined at.
+//
+// @return The line, starting at 1.
+func (definition *ThingDefinition) Line() int {
+	return definition.node.Line
+}
+
+func (definition *ThingDefinition) errorAt(node *yaml.Node, msg string) error {
+	err := nodeError(node, msg)
+	err.File = definition.file
+	return err
+}
+
+// forEachMember Call fn with the decoded metadata of each member of an
+// object of affordances.
+func forEachMember(node *yaml.Node, fn func(name string, member *yaml.Node, metadata map[string]interface{}) error) error {
+	if node.Kind != yaml.MappingNode {
+		return nodeError(node, "expected an object")
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.MappingNode {
+			return nodeError(value, fmt.Sprintf("%q must be an object", key.Value))
+		}
+		metadata := make(map[string]interface{})
+		if err := decodeNode(value, &metadata); err != nil {
+			return err
+		}
+		// Hrefs are assigned by the server the thing is added to.
+		delete(metadata, "links")
+		delete(metadata, "forms")
+		if err := fn(key.Value, value, metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberNode Find the value node of a key in a mapping node.
+func memberNode(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// convertValue Decode a value decoded from a definition into v.
+func convertValue(value interface{}, v interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+func decodeNode(node *yaml.Node, v interface{}) error {
+	if err := node.Decode(v); err != nil {
+		return nodeError(node, err.Error())
+	}
+	return nil
+}
+
+func nodeError(node *yaml.Node, msg string) *LoadError {
+	if node == nil {
+		return &LoadError{Msg: msg}
+	}
+	return &LoadError{Line: node.Line, Column: node.Column, Msg: msg}
+}
+
+// position Convert a byte offset to a line and column.
+func position(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*PropertyDefinition:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*ActionDefinition:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*EventDefinition:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
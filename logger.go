@@ -0,0 +1,128 @@
+package webthing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Logger A leveled, structured logger.
+//
+// Messages are followed by alternating keys and values, e.g.
+// logger.Warn("Invalid property value", "thing", id, "property", name).
+// A *slog.Logger satisfies this interface.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// nopLogger A Logger discarding all messages, used unless one is set.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// fieldLogger A Logger adding fields to all messages.
+type fieldLogger struct {
+	logger Logger
+	fields []interface{}
+}
+
+// withFields Get a logger adding the given keys and values to all messages.
+func withFields(logger Logger, fields ...interface{}) Logger {
+	if _, ok := logger.(nopLogger); ok {
+		return logger
+	}
+	return &fieldLogger{logger, fields}
+}
+
+func (l *fieldLogger) args(args []interface{}) []interface{} {
+	return append(append([]interface{}{}, l.fields...), args...)
+}
+
+func (l *fieldLogger) Debug(msg string, args ...interface{}) { l.logger.Debug(msg, l.args(args)...) }
+func (l *fieldLogger) Info(msg string, args ...interface{})  { l.logger.Info(msg, l.args(args)...) }
+func (l *fieldLogger) Warn(msg string, args ...interface{})  { l.logger.Warn(msg, l.args(args)...) }
+func (l *fieldLogger) Error(msg string, args ...interface{}) { l.logger.Error(msg, l.args(args)...) }
+
+// SetLogger Set the logger of this thing. Nothing is logged unless a
+// logger is set here or on the server.
+//
+// @param logger The logger
+func (thing *Thing) SetLogger(logger Logger) {
+	thing.logger = logger
+}
+
+// Logger Get the logger of this thing.
+func (thing *Thing) Logger() Logger {
+	if thing == nil || thing.logger == nil {
+		return nopLogger{}
+	}
+	return thing.logger
+}
+
+// log Get the logger of this thing, adding the thing id and the given
+// fields to all messages.
+func (thing *Thing) log(fields ...interface{}) Logger {
+	if thing == nil {
+		return nopLogger{}
+	}
+	return withFields(thing.Logger(), append([]interface{}{"thing", thing.ID()}, fields...)...)
+}
+
+// requestLog Get the logger of this thing for messages about a request.
+func (thing *Thing) requestLog(r *http.Request, fields ...interface{}) Logger {
+	return thing.log(append([]interface{}{"request", RequestID(r)}, fields...)...)
+}
+
+// SetLogger Set the logger of this server. Things without a logger of their
+// own log to it as well.
+//
+// @param logger The logger
+func (server *ThingServer) SetLogger(logger Logger) {
+	server.logger = logger
+	for _, thing := range server.Things {
+		if thing.logger == nil {
+			thing.SetLogger(logger)
+		}
+	}
+}
+
+// Logger Get the logger of this server.
+func (server *ThingServer) Logger() Logger {
+	if server == nil || server.logger == nil {
+		return nopLogger{}
+	}
+	return server.logger
+}
+
+type requestIDKey struct{}
+
+// RequestIDHeader Header carrying the ID of a request.
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID Get the ID of a request served by a ThingServer. It is taken
+// from the X-Request-Id header or generated, and echoed in the response.
+//
+// @param r The request
+func RequestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return r.Header.Get(RequestIDHeader)
+}
+
+// withRequestID Assign an ID to a request.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = uuid.New().String()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
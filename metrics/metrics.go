@@ -0,0 +1,228 @@
+// Package metrics exposes Prometheus metrics of a Web Thing server.
+//
+//	server := webthing.NewWebThingServer(things, httpServer, "")
+//	metrics.Instrument(server, metrics.WithPropertyValues())
+//	server.Start()
+//
+// The metrics are served at /metrics of the server:
+//
+//	webthing_http_requests_total{route, method, code}
+//	webthing_http_request_duration_seconds{route, method, code}
+//	webthing_websocket_subscribers{thing}
+//	webthing_actions_total{thing, action, status}
+//	webthing_events_total{thing, event}
+//	webthing_property_value{thing, property}
+//
+// Actions are counted once they reach a terminal status, i.e. "completed",
+// "cancelled" or "failed". Property values are only exported with
+// WithPropertyValues; numeric and boolean values are reported, others are
+// skipped.
+package metrics
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/internal/httpapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "webthing"
+
+// terminalStatus Action statuses after which an action does not change any
+// more.
+var terminalStatus = map[string]bool{
+	"completed": true,
+	"cancelled": true,
+	"failed":    true,
+}
+
+// Metrics The Prometheus metrics of a thing server.
+type Metrics struct {
+	registry       *prometheus.Registry
+	path           string
+	propertyValues bool
+	things         []*webthing.Thing
+
+	requests  *prometheus.CounterVec
+	durations *prometheus.HistogramVec
+	actions   *prometheus.CounterVec
+	events    *prometheus.CounterVec
+
+	subscribersDesc *prometheus.Desc
+	propertyDesc    *prometheus.Desc
+}
+
+// Option Configure the metrics of a server.
+type Option func(*Metrics)
+
+// WithPropertyValues Export numeric and boolean property values as gauges.
+func WithPropertyValues() Option {
+	return func(m *Metrics) {
+		m.propertyValues = true
+	}
+}
+
+// WithRegistry Register the metrics with the given registry instead of a
+// new one, e.g. to serve them together with other metrics of the process.
+//
+// @param registry The registry
+func WithRegistry(registry *prometheus.Registry) Option {
+	return func(m *Metrics) {
+		m.registry = registry
+	}
+}
+
+// WithPath Serve the metrics at the given path rather than /metrics. An
+// empty path does not register a route; use Handler instead.
+//
+// @param path Path of the metrics route
+func WithPath(path string) Option {
+	return func(m *Metrics) {
+		m.path = path
+	}
+}
+
+// Instrument Collect metrics of a server and serve them at /metrics.
+//
+// @param server The server whose routes and things are instrumented
+// @param opts   Options
+func Instrument(server *webthing.ThingServer, opts ...Option) *Metrics {
+	m := &Metrics{
+		path:   "/metrics",
+		things: server.Things,
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		actions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "actions_total",
+			Help:      "Number of finished actions by thing, action and terminal status.",
+		}, []string{"thing", "action", "status"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_total",
+			Help:      "Number of emitted events by thing and event.",
+		}, []string{"thing", "event"}),
+
+		subscribersDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "websocket_subscribers"),
+			"Number of active WebSocket subscribers by thing.",
+			[]string{"thing"}, nil),
+		propertyDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "property_value"),
+			"Current value of numeric and boolean properties.",
+			[]string{"thing", "property"}, nil),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.registry == nil {
+		m.registry = prometheus.NewRegistry()
+	}
+	m.registry.MustRegister(m.requests, m.durations, m.actions, m.events, m)
+
+	for _, thing := range m.things {
+		thingID := thing.ID()
+		thing.OnActionStatus(func(action *webthing.Action) {
+			if terminalStatus[action.Status()] {
+				m.actions.WithLabelValues(thingID, action.Name(), action.Status()).Inc()
+			}
+		})
+		thing.OnEvent(func(event *webthing.Event) {
+			m.events.WithLabelValues(thingID, event.Name()).Inc()
+		})
+	}
+
+	server.Use(m.middleware)
+	if m.path != "" {
+		server.Handle(m.path, m.Handler())
+	}
+	return m
+}
+
+// Handler Get the HTTP handler serving the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Registry Get the registry of the metrics.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Describe Implement prometheus.Collector for the metrics gathered when
+// scraped.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.subscribersDesc
+	if m.propertyValues {
+		ch <- m.propertyDesc
+	}
+}
+
+// Collect Implement prometheus.Collector for the metrics gathered when
+// scraped.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, thing := range m.things {
+		ch <- prometheus.MustNewConstMetric(m.subscribersDesc, prometheus.GaugeValue,
+			float64(thing.SubscriberCount()), thing.ID())
+
+		if !m.propertyValues {
+			continue
+		}
+		for name, value := range thing.Properties() {
+			if v, ok := gaugeValue(value); ok {
+				ch <- prometheus.MustNewConstMetric(m.propertyDesc, prometheus.GaugeValue,
+					v, thing.ID(), name)
+			}
+		}
+	}
+}
+
+// middleware Count the requests of a route and observe their latency.
+func (m *Metrics) middleware(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := httpapi.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		code := strconv.Itoa(rec.Code)
+		m.requests.WithLabelValues(route, r.Method, code).Inc()
+		// The duration of a websocket connection is not a request latency.
+		if !rec.Hijacked {
+			m.durations.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+		}
+	})
+}
+
+// gaugeValue Convert a property value to a gauge value.
+func gaugeValue(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, true
+		}
+		return 0, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
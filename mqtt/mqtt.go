@@ -0,0 +1,357 @@
+// Package mqtt binds Web Things to an MQTT broker.
+//
+// A bound thing publishes to and subscribes to topics below
+// <prefix>/<thing id>:
+//
+//	properties/<name>        property values, retained
+//	properties/<name>/set    values to write, routed to Thing.SetProperty
+//	actions/<name>           action requests with the input as payload,
+//	                         routed to Thing.PerformAction
+//	actions/<name>/status    action statuses
+//	events/<name>            events
+//
+// Payloads are JSON. The matching forms are added to the Thing Description.
+//
+// A broker forgets the subscriptions of a client with a clean session when
+// it reconnects, so OnConnect subscribes again and is set as the OnConnect
+// handler of the client:
+//
+//	var binding *mqtt.Binding
+//	options := paho.NewClientOptions().AddBroker("tcp://localhost:1883").
+//		SetOnConnectHandler(func(c paho.Client) { binding.OnConnect(c) })
+//	client := paho.NewClient(options)
+//	binding = mqtt.New(client)
+//	client.Connect().Wait()
+//	binding.Bind(thing)
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// DefaultPrefix Topic prefix used unless WithPrefix is given.
+const DefaultPrefix = "things"
+
+// timeout Time to wait for the broker to acknowledge a subscription.
+const timeout = 10 * time.Second
+
+// Binding Binds things to an MQTT broker.
+type Binding struct {
+	client    paho.Client
+	prefix    string
+	qos       byte
+	brokerURL string
+
+	mu     sync.Mutex
+	bound  map[*webthing.Thing]string
+	closed bool
+}
+
+// Option Configure a binding.
+type Option func(*Binding)
+
+// WithPrefix Use a topic prefix other than DefaultPrefix.
+//
+// @param prefix The topic prefix
+func WithPrefix(prefix string) Option {
+	return func(b *Binding) {
+		b.prefix = strings.Trim(prefix, "/")
+	}
+}
+
+// WithQoS Publish and subscribe with the given quality of service.
+//
+// @param qos 0, 1 or 2
+func WithQoS(qos byte) Option {
+	return func(b *Binding) {
+		b.qos = qos
+	}
+}
+
+// WithBrokerURL Use the given broker URL in the forms of the Thing
+// Description, e.g. when clients reach the broker at another address. By
+// default the first broker of the client options is used.
+//
+// @param url URL of the broker, e.g. "mqtt://broker.example.com:1883"
+func WithBrokerURL(url string) Option {
+	return func(b *Binding) {
+		b.brokerURL = strings.TrimRight(url, "/")
+	}
+}
+
+// New Create a binding publishing through a connected client.
+//
+// @param client The MQTT client
+// @param opts   Options
+func New(client paho.Client, opts ...Option) *Binding {
+	b := &Binding{
+		client: client,
+		prefix: DefaultPrefix,
+		qos:    1,
+		bound:  make(map[*webthing.Thing]string),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.brokerURL == "" {
+		reader := client.OptionsReader()
+		if servers := reader.Servers(); len(servers) > 0 {
+			broker := *servers[0]
+			switch broker.Scheme {
+			case "tcp", "":
+				broker.Scheme = "mqtt"
+			case "ssl", "tls":
+				broker.Scheme = "mqtts"
+			}
+			b.brokerURL = strings.TrimRight(broker.String(), "/")
+		}
+	}
+	return b
+}
+
+// Topic Get the topic of a thing all its topics are below.
+//
+// @param thing The thing
+func (b *Binding) Topic(thing *webthing.Thing) string {
+	// Topic levels must not contain separators or wildcards.
+	id := strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(thing.ID())
+	if b.prefix == "" {
+		return id
+	}
+	return b.prefix + "/" + id
+}
+
+// Bind Publish the property values, action statuses and events of a thing
+// and subscribe to its set and invoke topics.
+//
+// @param thing The thing
+func (b *Binding) Bind(thing *webthing.Thing) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errors.New("binding is closed")
+	}
+	if _, ok := b.bound[thing]; ok {
+		b.mu.Unlock()
+		return nil
+	}
+	base := b.Topic(thing)
+	b.bound[thing] = base
+	b.mu.Unlock()
+
+	if err := b.subscribe(thing, base); err != nil {
+		return err
+	}
+
+	// The hooks cannot be removed from the thing, they do nothing once the
+	// binding is closed.
+	thing.OnPropertyNotify(func(property *webthing.Property) {
+		if b.isClosed() {
+			return
+		}
+		b.publishValue(thing, base, property.Name(), property.Value().Get())
+	})
+	thing.OnActionStatus(func(action *webthing.Action) {
+		if b.isClosed() {
+			return
+		}
+		b.publish(thing, base+"/actions/"+action.Name()+"/status", false, json.RawMessage(action.AsActionDescription()))
+	})
+	thing.OnEvent(func(event *webthing.Event) {
+		if b.isClosed() {
+			return
+		}
+		payload := map[string]interface{}{"timestamp": event.Time()}
+		if data := event.Data(); len(data) > 0 {
+			payload["data"] = data
+		}
+		b.publish(thing, base+"/events/"+event.Name(), false, payload)
+	})
+
+	var description struct {
+		Properties map[string]struct {
+			ReadOnly bool `json:"readOnly"`
+		} `json:"properties"`
+		Actions map[string]json.RawMessage `json:"actions"`
+		Events  map[string]json.RawMessage `json:"events"`
+	}
+	json.Unmarshal(thing.AsThingDescription(), &description)
+
+	for name, value := range thing.Properties() {
+		b.publishValue(thing, base, name, value)
+		thing.AddForm("properties", name, b.form(base+"/properties/"+name, "subscribe",
+			[]string{"readproperty", "observeproperty", "unobserveproperty"}, true))
+		if !description.Properties[name].ReadOnly {
+			thing.AddForm("properties", name, b.form(base+"/properties/"+name+"/set", "publish",
+				[]string{"writeproperty"}, false))
+		}
+	}
+	for name := range description.Actions {
+		thing.AddForm("actions", name, b.form(base+"/actions/"+name, "publish",
+			[]string{"invokeaction"}, false))
+	}
+	for name := range description.Events {
+		thing.AddForm("events", name, b.form(base+"/events/"+name, "subscribe",
+			[]string{"subscribeevent", "unsubscribeevent"}, false))
+	}
+	return nil
+}
+
+// OnConnect Subscribe again to the set and invoke topics of the bound
+// things, which a broker forgets when a client with a clean session
+// reconnects, and publish their property values, which may have changed
+// while the client was disconnected. Set it as the OnConnect handler of the
+// client.
+//
+// @param client The client that connected
+func (b *Binding) OnConnect(client paho.Client) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	bound := make(map[*webthing.Thing]string, len(b.bound))
+	for thing, base := range b.bound {
+		bound[thing] = base
+	}
+	b.mu.Unlock()
+
+	for thing, base := range bound {
+		if err := b.subscribe(thing, base); err != nil {
+			thing.Logger().Error("MQTT subscribe failure", "thing", thing.ID(), "error", err)
+			continue
+		}
+		for name, value := range thing.Properties() {
+			b.publishValue(thing, base, name, value)
+		}
+	}
+}
+
+// Close Unsubscribe from the topics of all bound things and stop
+// publishing: the hooks the binding registered on the things stay
+// registered but do nothing. The client is not disconnected.
+func (b *Binding) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	var topics []string
+	for _, base := range b.bound {
+		topics = append(topics, base+"/properties/+/set", base+"/actions/+")
+	}
+	b.mu.Unlock()
+
+	if len(topics) == 0 {
+		return nil
+	}
+	token := b.client.Unsubscribe(topics...)
+	if !token.WaitTimeout(timeout) {
+		return errors.New("unsubscribe timed out")
+	}
+	return token.Error()
+}
+
+// subscribe Subscribe to the set and invoke topics of a thing.
+func (b *Binding) subscribe(thing *webthing.Thing, base string) error {
+	filters := map[string]byte{
+		base + "/properties/+/set": b.qos,
+		base + "/actions/+":        b.qos,
+	}
+	token := b.client.SubscribeMultiple(filters, func(_ paho.Client, msg paho.Message) {
+		b.handle(thing, base, msg)
+	})
+	if !token.WaitTimeout(timeout) {
+		return errors.New("subscribe timed out")
+	}
+	return token.Error()
+}
+
+// handle Route a message on a set or invoke topic into the thing.
+func (b *Binding) handle(thing *webthing.Thing, base string, msg paho.Message) {
+	if b.isClosed() {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(msg.Topic(), base+"/"), "/")
+	log := thing.Logger()
+
+	switch {
+	case len(parts) == 3 && parts[0] == "properties" && parts[2] == "set":
+		var v interface{}
+		if err := json.Unmarshal(msg.Payload(), &v); err != nil {
+			log.Warn("Invalid MQTT property value", "thing", thing.ID(), "property", parts[1], "error", err)
+			return
+		}
+		value := webthing.NewValue(v)
+		if err := thing.SetProperty(parts[1], &value); err != nil {
+			log.Warn("Set property failure", "thing", thing.ID(), "property", parts[1], "error", err)
+		}
+	case len(parts) == 2 && parts[0] == "actions":
+		var input *json.RawMessage
+		if payload := msg.Payload(); len(payload) > 0 {
+			if !json.Valid(payload) {
+				log.Warn("Invalid MQTT action input", "thing", thing.ID(), "action", parts[1])
+				return
+			}
+			raw := json.RawMessage(payload)
+			input = &raw
+		}
+		action, err := thing.PerformAction(parts[1], input)
+		if action == nil || err != nil {
+			log.Warn("Perform action failure", "thing", thing.ID(), "action", parts[1], "error", err)
+			return
+		}
+		// Perform an Action in a goroutine.
+		go action.Start()
+	}
+}
+
+// publishValue Publish the retained value of a property.
+func (b *Binding) publishValue(thing *webthing.Thing, base, name string, value interface{}) {
+	b.publish(thing, base+"/properties/"+name, true, value)
+}
+
+// publish Publish a JSON payload without waiting for the broker.
+func (b *Binding) publish(thing *webthing.Thing, topic string, retained bool, payload interface{}) {
+	if b.isClosed() {
+		return
+	}
+	content, err := json.Marshal(payload)
+	if err != nil {
+		thing.Logger().Error("Encode MQTT payload failure", "thing", thing.ID(), "topic", topic, "error", err)
+		return
+	}
+	token := b.client.Publish(topic, b.qos, retained, content)
+	go func() {
+		if token.WaitTimeout(timeout) && token.Error() != nil {
+			thing.Logger().Error("MQTT publish failure", "thing", thing.ID(), "topic", topic, "error", token.Error())
+		}
+	}()
+}
+
+// form Get the Thing Description form of a topic.
+func (b *Binding) form(topic, controlPacket string, op []string, retain bool) webthing.Form {
+	form := webthing.Form{
+		"href":              fmt.Sprintf("%s/%s", b.brokerURL, topic),
+		"op":                op,
+		"contentType":       "application/json",
+		"mqv:controlPacket": controlPacket,
+		"mqv:qos":           fmt.Sprint(b.qos),
+	}
+	if retain {
+		form["mqv:retain"] = true
+	}
+	return form
+}
+
+func (b *Binding) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
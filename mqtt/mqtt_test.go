@@ -0,0 +1,340 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/google/uuid"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// broker A minimal in-process MQTT 3.1.1 broker. Sessions are always clean
+// and messages are delivered with QoS 0.
+type broker struct {
+	ln      net.Listener
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	sessions map[net.Conn]map[string]bool
+	retained map[string][]byte
+
+	// published Receives every message published by a client.
+	published chan *packets.PublishPacket
+	// subscribed Receives every topic filter subscribed to.
+	subscribed chan string
+}
+
+func newBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	b := &broker{
+		ln:         ln,
+		sessions:   make(map[net.Conn]map[string]bool),
+		retained:   make(map[string][]byte),
+		published:  make(chan *packets.PublishPacket, 100),
+		subscribed: make(chan string, 100),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		b.drop()
+	})
+	return b
+}
+
+func (b *broker) serve(conn net.Conn) {
+	b.mu.Lock()
+	b.sessions[conn] = make(map[string]bool)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, conn)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.write(conn, packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = make([]byte, len(p.Topics))
+			b.mu.Lock()
+			for _, filter := range p.Topics {
+				b.sessions[conn][filter] = true
+			}
+			b.mu.Unlock()
+			b.write(conn, ack)
+			for _, filter := range p.Topics {
+				b.subscribed <- filter
+			}
+		case *packets.UnsubscribePacket:
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			b.mu.Lock()
+			for _, filter := range p.Topics {
+				delete(b.sessions[conn], filter)
+			}
+			b.mu.Unlock()
+			b.write(conn, ack)
+		case *packets.PublishPacket:
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				b.write(conn, ack)
+			}
+			if p.Retain {
+				b.mu.Lock()
+				b.retained[p.TopicName] = p.Payload
+				b.mu.Unlock()
+			}
+			b.published <- p
+			b.deliver(p.TopicName, p.Payload)
+		case *packets.PingreqPacket:
+			b.write(conn, packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// deliver Send a message to all clients subscribed to its topic.
+func (b *broker) deliver(topic string, payload []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for conn, filters := range b.sessions {
+		for filter := range filters {
+			if match(filter, topic) {
+				message := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				message.TopicName = topic
+				message.Payload = payload
+				b.write(conn, message)
+				break
+			}
+		}
+	}
+}
+
+func (b *broker) write(conn net.Conn, packet packets.ControlPacket) {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	packet.Write(conn)
+}
+
+// drop Close the connections of all clients, as if the network failed.
+func (b *broker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for conn := range b.sessions {
+		conn.Close()
+	}
+}
+
+// match Report whether a topic matches a topic filter.
+func match(filter, topic string) bool {
+	filters := strings.Split(filter, "/")
+	levels := strings.Split(topic, "/")
+	for i, f := range filters {
+		if f == "#" {
+			return true
+		}
+		if i >= len(levels) || (f != "+" && f != levels[i]) {
+			return false
+		}
+	}
+	return len(filters) == len(levels)
+}
+
+// drain Forget the messages and subscriptions seen so far.
+func (b *broker) drain() {
+	for {
+		select {
+		case <-b.published:
+		case <-b.subscribed:
+		case <-time.After(100 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// next Wait for the next message published to a topic.
+func (b *broker) next(t *testing.T, topic string) []byte {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case p := <-b.published:
+			if p.TopicName == topic {
+				return p.Payload
+			}
+		case <-deadline:
+			t.Fatalf("Timed out waiting for a message on %s", topic)
+		}
+	}
+}
+
+// waitSubscribed Wait for a subscription to a topic filter.
+func (b *broker) waitSubscribed(t *testing.T, filter string) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case f := <-b.subscribed:
+			if f == filter {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("Timed out waiting for a subscription to %s", filter)
+		}
+	}
+}
+
+// countAction An action counting to its input.
+type countAction struct {
+	*webthing.Action
+}
+
+func (a *countAction) Generator(thing *webthing.Thing) *webthing.Action {
+	action := &countAction{}
+	action.Action = webthing.NewAction(uuid.New().String(), thing, "count", nil, action.PerformAction, action.Cancel)
+	return action.Action
+}
+
+func (a *countAction) PerformAction() *webthing.Action {
+	return a.Action
+}
+
+func (a *countAction) Cancel() {}
+
+// bind Bind a new thing through a client connected to the broker.
+func bind(t *testing.T, b *broker) (*webthing.Thing, *Binding) {
+	thing := webthing.NewThing("urn:dev:ops:mqtt", "MQTT", nil, "")
+	thing.AddProperty(webthing.NewProperty(thing, "level", webthing.NewValue(1.0),
+		json.RawMessage(`{"type": "number"}`)))
+	thing.AddAvailableAction("count", json.RawMessage(`{"input": {"type": "integer"}}`), &countAction{})
+	thing.AddAvailableEvent("overheated", json.RawMessage(`{"type": "number"}`))
+
+	var binding *Binding
+	connected := make(chan struct{}, 10)
+	options := paho.NewClientOptions().
+		AddBroker("tcp://" + b.ln.Addr().String()).
+		SetClientID("webthing").
+		SetMaxReconnectInterval(100 * time.Millisecond).
+		SetOnConnectHandler(func(c paho.Client) {
+			binding.OnConnect(c)
+			connected <- struct{}{}
+		})
+	client := paho.NewClient(options)
+	binding = New(client)
+	if token := client.Connect(); !token.WaitTimeout(timeout) || token.Error() != nil {
+		t.Fatalf("Connect: %v", token.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(0) })
+	// The handler runs in a goroutine, bind once it ran.
+	<-connected
+
+	if err := binding.Bind(thing); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	return thing, binding
+}
+
+func TestBind(t *testing.T) {
+	b := newBroker(t)
+	thing, binding := bind(t, b)
+	base := binding.Topic(thing)
+
+	if payload := b.next(t, base+"/properties/level"); string(payload) != "1" {
+		t.Fatalf("Expected the level to be published, got %s", payload)
+	}
+	if !strings.Contains(string(thing.AsThingDescription()), `"mqtt://`+b.ln.Addr().String()+"/"+base+`/properties/level"`) {
+		t.Fatal("Missing the MQTT form of the property")
+	}
+
+	b.deliver(base+"/properties/level/set", []byte("42"))
+	if payload := b.next(t, base+"/properties/level"); string(payload) != "42" {
+		t.Fatalf("Expected the written level to be published, got %s", payload)
+	}
+	if level := thing.Property("level").Get(); level != 42.0 {
+		t.Fatalf("Expected level 42, got %v", level)
+	}
+
+	b.deliver(base+"/actions/count", []byte("3"))
+	for {
+		var description map[string]map[string]interface{}
+		if err := json.Unmarshal(b.next(t, base+"/actions/count/status"), &description); err != nil {
+			t.Fatalf("Invalid action status: %v", err)
+		}
+		if description["count"]["status"] == "completed" {
+			break
+		}
+	}
+
+	thing.AddEvent(webthing.NewEvent(thing, "overheated", json.RawMessage(`102`)))
+	if payload := b.next(t, base+"/events/overheated"); !strings.Contains(string(payload), "102") {
+		t.Fatalf("Expected the event to be published, got %s", payload)
+	}
+}
+
+func TestResubscribeOnReconnect(t *testing.T) {
+	b := newBroker(t)
+	thing, binding := bind(t, b)
+	base := binding.Topic(thing)
+	b.drain()
+
+	// The broker forgets the subscriptions of the clean session.
+	b.drop()
+	b.waitSubscribed(t, base+"/properties/+/set")
+
+	b.deliver(base+"/properties/level/set", []byte("7"))
+	deadline := time.Now().Add(5 * time.Second)
+	for thing.Property("level").Get() != 7.0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the level to be written after reconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := newBroker(t)
+	thing, binding := bind(t, b)
+	if err := binding.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	b.drain()
+	value := webthing.NewValue(5.0)
+	if err := thing.SetProperty("level", &value); err != nil {
+		t.Fatalf("SetProperty: %v", err)
+	}
+	thing.AddEvent(webthing.NewEvent(thing, "overheated", json.RawMessage(`102`)))
+	select {
+	case p := <-b.published:
+		t.Fatalf("Expected nothing published after Close, got %s", p.TopicName)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,172 @@
+package webthing
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// NotifyPolicy How changes of a noisy property are notified to WebSocket
+// subscribers and protocol bindings. Property change hooks, histories,
+// alarms and persistence still see every value.
+type NotifyPolicy struct {
+	// MinInterval The minimum time between two notifications. Changes in
+	// between are dropped, or coalesced if Coalesce is set.
+	MinInterval Duration `json:"minInterval,omitempty"`
+
+	// MaxInterval The maximum time without a notification. The current value
+	// is notified again when it elapses, as a heartbeat.
+	MaxInterval Duration `json:"maxInterval,omitempty"`
+
+	// Deadband, DeadbandPercent How much a numeric value must differ from the
+	// last value notified, in the unit of the property and in percent of the
+	// last value. A change must exceed both to be notified.
+	Deadband        float64 `json:"deadband,omitempty"`
+	DeadbandPercent float64 `json:"deadbandPercent,omitempty"`
+
+	// Coalesce Notify the latest of the changes made within MinInterval once
+	// it elapses, instead of dropping them.
+	Coalesce bool `json:"coalesce,omitempty"`
+}
+
+// notifier The notification state of a property with a policy.
+type notifier struct {
+	NotifyPolicy
+	property *Property
+
+	mu        sync.Mutex
+	notified  bool
+	last      time.Time
+	lastValue interface{}
+	ctx       context.Context
+	pending   *time.Timer
+	heartbeat *time.Timer
+}
+
+// SetNotifyPolicy Throttle the notifications of the changes of this
+// property. Set it before the thing is served.
+//
+// @param policy The policy
+func (property *Property) SetNotifyPolicy(policy NotifyPolicy) {
+	if property.notifier != nil {
+		property.notifier.stop()
+	}
+	property.notifier = &notifier{NotifyPolicy: policy, property: property}
+	property.notifier.mu.Lock()
+	property.notifier.schedule()
+	property.notifier.mu.Unlock()
+}
+
+// NotifyPolicy Get the notification policy of this property.
+//
+// @returns The policy, the zero policy notifying every change if none is set.
+func (property *Property) NotifyPolicy() NotifyPolicy {
+	if property.notifier == nil {
+		return NotifyPolicy{}
+	}
+	return property.notifier.NotifyPolicy
+}
+
+// OnPropertyNotify Call a function whenever a property change is notified,
+// according to the notification policy of the property, e.g. to publish it
+// in a protocol binding.
+//
+// @param hook Function called with the property
+func (thing *Thing) OnPropertyNotify(hook func(property *Property)) {
+	thing.hooksMu.Lock()
+	defer thing.hooksMu.Unlock()
+	thing.hooks.notify = append(thing.hooks.notify, hook)
+}
+
+// changed Notify a change of the property now, later or not at all.
+func (n *notifier) changed(ctx context.Context) {
+	n.mu.Lock()
+	if n.pending != nil {
+		n.ctx = ctx
+		n.mu.Unlock()
+		return
+	}
+	if n.notified && n.withinDeadband() {
+		n.mu.Unlock()
+		return
+	}
+	if wait := time.Duration(n.MinInterval) - time.Since(n.last); n.notified && wait > 0 {
+		if n.Coalesce {
+			n.ctx = ctx
+			n.pending = time.AfterFunc(wait, n.flush)
+		}
+		n.mu.Unlock()
+		return
+	}
+	n.send(ctx)
+}
+
+// flush Notify the latest value coalesced.
+func (n *notifier) flush() {
+	n.mu.Lock()
+	n.pending = nil
+	if n.withinDeadband() {
+		n.mu.Unlock()
+		return
+	}
+	n.send(n.ctx)
+}
+
+// beat Notify the current value again.
+func (n *notifier) beat() {
+	n.mu.Lock()
+	if n.pending != nil {
+		n.mu.Unlock()
+		return
+	}
+	n.send(context.Background())
+}
+
+// send Notify the current value. Called with the lock held, which it
+// releases.
+func (n *notifier) send(ctx context.Context) {
+	n.notified = true
+	n.last = time.Now()
+	n.lastValue = n.property.value.Get()
+	n.schedule()
+	n.mu.Unlock()
+	n.property.thing.notifyProperty(ctx, n.property)
+}
+
+// schedule Restart the heartbeat. Callers hold the lock.
+func (n *notifier) schedule() {
+	if n.MaxInterval <= 0 {
+		return
+	}
+	if n.heartbeat != nil {
+		n.heartbeat.Stop()
+	}
+	n.heartbeat = time.AfterFunc(time.Duration(n.MaxInterval), n.beat)
+}
+
+// stop Stop the timers.
+func (n *notifier) stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, timer := range []*time.Timer{n.pending, n.heartbeat} {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// withinDeadband Whether the current value is too close to the last value
+// notified. Callers hold the lock.
+func (n *notifier) withinDeadband() bool {
+	if n.Deadband <= 0 && n.DeadbandPercent <= 0 {
+		return false
+	}
+	v, ok := Number(n.property.value.Get())
+	last, lastOK := Number(n.lastValue)
+	if !ok || !lastOK {
+		return false
+	}
+	diff := math.Abs(v - last)
+	return diff < n.Deadband || diff < math.Abs(last)*n.DeadbandPercent/100
+}
@@ -0,0 +1,358 @@
+package webthing
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIPath Path of the OpenAPI document below the base path of a server.
+const OpenAPIPath = "/openapi.json"
+
+// schemaKeywords Metadata keys that are part of the data schema of an
+// affordance.
+var schemaKeywords = []string{
+	"type", "title", "description", "enum", "const", "default", "format",
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf",
+	"minLength", "maxLength", "pattern", "items", "minItems", "maxItems",
+	"properties", "required", "readOnly", "writeOnly", "oneOf",
+}
+
+// OpenAPI Get the OpenAPI 3.1 document describing the HTTP API of the
+// things of this server. It reflects the things as they are when called.
+func (server *ThingServer) OpenAPI() []byte {
+	paths := make(map[string]interface{})
+	for idx, thing := range server.Things {
+		prefix := strings.TrimRight(thing.hrefPrefix, "/")
+		opPrefix := ""
+		if len(server.Things) > 1 {
+			opPrefix = "thing" + strconv.Itoa(idx) + "_"
+		}
+		thing.openAPIPaths(paths, prefix, opPrefix)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   server.Name,
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"ThingDescription": map[string]interface{}{
+					"type":        "object",
+					"description": "A W3C Web of Things Thing Description.",
+				},
+				"ActionStatus": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"href", "status", "timeRequested"},
+					"properties": map[string]interface{}{
+						"input":         map[string]interface{}{},
+						"href":          map[string]interface{}{"type": "string"},
+						"status":        map[string]interface{}{"type": "string", "enum": []string{"created", "pending", "completed", "cancelled", "failed"}},
+						"timeRequested": map[string]interface{}{"type": "string", "format": "date-time"},
+						"timeCompleted": map[string]interface{}{"type": "string", "format": "date-time"},
+					},
+				},
+			},
+		},
+	}
+	content, _ := json.MarshalIndent(doc, "", "  ")
+	return content
+}
+
+// openAPIPaths Add the paths of this thing to an OpenAPI document.
+func (thing *Thing) openAPIPaths(paths map[string]interface{}, prefix, opPrefix string) {
+	tags := []string{thing.Title()}
+	thingPath := prefix
+	if thingPath == "" {
+		thingPath = "/"
+	}
+
+	paths[thingPath] = map[string]interface{}{
+		"get": apiOperation(opPrefix+"getThingDescription", "Get the Thing Description of "+thing.Title(), tags, nil,
+			apiResponse("200", "The Thing Description", schemaRef("ThingDescription"))),
+	}
+
+	// Properties
+	values := make(map[string]interface{})
+	for _, name := range thing.propertyNames() {
+		property, ok := thing.FindProperty(name)
+		if !ok {
+			continue
+		}
+		schema := dataSchema(property.Metadata())
+		values[name] = schema
+		body := objectSchema(name, schema)
+
+		item := map[string]interface{}{
+			"get": apiOperation(opPrefix+"readProperty_"+name, "Read the property "+name, tags, nil,
+				apiResponse("200", "The value of the property", body)),
+		}
+		if readOnly, _ := schema["readOnly"].(bool); !readOnly {
+			item["put"] = apiOperation(opPrefix+"writeProperty_"+name, "Write the property "+name, tags,
+				apiRequestBody(body),
+				apiResponse("200", "The new value of the property", body),
+				apiResponse("400", "Invalid or read-only value", nil))
+		}
+		paths[prefix+"/properties/"+name] = item
+
+		if property.History() != nil {
+			paths[prefix+"/properties/"+name+"/history"] = map[string]interface{}{
+				"parameters": []interface{}{
+					queryParameter("from", "Start of the range, an RFC 3339 time or a duration before now"),
+					queryParameter("to", "End of the range, an RFC 3339 time or a duration before now"),
+					queryParameter("limit", "Number of latest values or buckets"),
+					queryParameter("bucket", "Duration of the buckets aggregating numeric values"),
+				},
+				"get": apiOperation(opPrefix+"readPropertyHistory_"+name, "Read the recorded values of the property "+name, tags, nil,
+					apiResponse("200", "The values, or the buckets if bucket is given", arraySchema(map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"time":  map[string]interface{}{"type": "string", "format": "date-time"},
+							"value": schema,
+							"min":   map[string]interface{}{"type": "number"},
+							"max":   map[string]interface{}{"type": "number"},
+							"avg":   map[string]interface{}{"type": "number"},
+							"count": map[string]interface{}{"type": "integer"},
+						},
+					})),
+					apiResponse("400", "Invalid query", nil)),
+			}
+		}
+	}
+	paths[prefix+"/properties"] = map[string]interface{}{
+		"get": apiOperation(opPrefix+"readAllProperties", "Read all properties", tags, nil,
+			apiResponse("200", "The values of all properties", map[string]interface{}{
+				"type":       "object",
+				"properties": values,
+			})),
+	}
+
+	// Actions
+	actionStatus := schemaRef("ActionStatus")
+	var requests []interface{}
+	for _, name := range thing.actionNames() {
+		var metadata map[string]interface{}
+		json.Unmarshal(thing.availableActions[name].Metadata(), &metadata)
+		request := map[string]interface{}{}
+		if input, ok := metadata["input"]; ok {
+			content, _ := json.Marshal(input)
+			request = objectSchema("input", dataSchema(content))
+		}
+		body := objectSchema(name, request)
+		requests = append(requests, body)
+
+		paths[prefix+"/actions/"+name] = map[string]interface{}{
+			"get": apiOperation(opPrefix+"queryActions_"+name, "List the requests of the action "+name, tags, nil,
+				apiResponse("200", "The action requests", arraySchema(objectSchema(name, actionStatus)))),
+			"post": apiOperation(opPrefix+"invokeAction_"+name, describe("Invoke the action "+name, metadata), tags,
+				apiRequestBody(body),
+				apiResponse("201", "The action request", objectSchema(name, actionStatus)),
+				apiResponse("400", "Invalid action input", nil)),
+		}
+		paths[prefix+"/actions/"+name+"/{actionId}"] = map[string]interface{}{
+			"parameters": []interface{}{map[string]interface{}{
+				"name":     "actionId",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			}},
+			"get": apiOperation(opPrefix+"queryAction_"+name, "Get a request of the action "+name, tags, nil,
+				apiResponse("200", "The action request", objectSchema(name, actionStatus)),
+				apiResponse("400", "Action request not found", nil)),
+			"delete": apiOperation(opPrefix+"cancelAction_"+name, "Cancel and remove a request of the action "+name, tags, nil,
+				apiResponse("204", "The action request was removed", nil),
+				apiResponse("400", "Action request not found", nil)),
+		}
+	}
+	actionsItem := map[string]interface{}{
+		"get": apiOperation(opPrefix+"queryAllActions", "List the requests of all actions", tags, nil,
+			apiResponse("200", "The action requests", arraySchema(map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": actionStatus,
+			}))),
+	}
+	if len(requests) > 0 {
+		actionsItem["post"] = apiOperation(opPrefix+"invokeActions", "Invoke an action", tags,
+			apiRequestBody(map[string]interface{}{"oneOf": requests}),
+			apiResponse("201", "The action request", map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": actionStatus,
+			}),
+			apiResponse("400", "Invalid action input", nil))
+	}
+	paths[prefix+"/actions"] = actionsItem
+
+	// Events
+	var events []interface{}
+	for _, name := range thing.eventNames() {
+		var metadata map[string]interface{}
+		json.Unmarshal(thing.availableEvents[name].Metadata(), &metadata)
+		event := map[string]interface{}{
+			"type":     "object",
+			"required": []string{"timestamp"},
+			"properties": map[string]interface{}{
+				"timestamp": map[string]interface{}{"type": "string", "format": "date-time"},
+				"data":      dataSchema(thing.availableEvents[name].Metadata()),
+			},
+		}
+		events = append(events, objectSchema(name, event))
+
+		paths[prefix+"/events/"+name] = map[string]interface{}{
+			"get": apiOperation(opPrefix+"readEvents_"+name, describe("List the emitted events "+name, metadata), tags, nil,
+				apiResponse("200", "The emitted events", arraySchema(objectSchema(name, event)))),
+		}
+	}
+	eventSchema := map[string]interface{}{"type": "object"}
+	if len(events) > 0 {
+		eventSchema = map[string]interface{}{"oneOf": events}
+	}
+	paths[prefix+"/events"] = map[string]interface{}{
+		"get": apiOperation(opPrefix+"readAllEvents", "List all emitted events", tags, nil,
+			apiResponse("200", "The emitted events", arraySchema(eventSchema))),
+	}
+}
+
+// OpenAPIHandle Handle a request to the OpenAPI document.
+type OpenAPIHandle struct {
+	server *ThingServer
+}
+
+// Handle Serve the OpenAPI document.
+func (h *OpenAPIHandle) Handle(w http.ResponseWriter, r *http.Request) {
+	corsResponse(w)
+	jsonResponse(w)
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := w.Write(h.server.OpenAPI()); err != nil {
+		h.server.Logger().Error("Write response failure", "request", RequestID(r), "error", err)
+	}
+}
+
+// dataSchema Get the JSON schema of a value from the metadata of an
+// affordance.
+func dataSchema(metadata []byte) map[string]interface{} {
+	var m map[string]interface{}
+	json.Unmarshal(metadata, &m)
+	schema := make(map[string]interface{})
+	for _, key := range schemaKeywords {
+		if v, ok := m[key]; ok {
+			schema[key] = v
+		}
+	}
+	// The Web Thing API uses "null" for values without a type.
+	if schema["type"] == "null" {
+		delete(schema, "type")
+	}
+	return schema
+}
+
+func (thing *Thing) propertyNames() []string {
+	var names []string
+	for _, property := range thing.propertyList() {
+		names = append(names, property.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (thing *Thing) actionNames() []string {
+	var names []string
+	for name := range thing.availableActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (thing *Thing) eventNames() []string {
+	var names []string
+	for name := range thing.availableEvents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apiOperation Build an OpenAPI operation.
+func apiOperation(id, summary string, tags []string, body map[string]interface{}, responses ...map[string]interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": id,
+		"summary":     summary,
+		"tags":        tags,
+	}
+	if body != nil {
+		op["requestBody"] = body
+	}
+	all := make(map[string]interface{})
+	for _, r := range responses {
+		for code, response := range r {
+			all[code] = response
+		}
+	}
+	op["responses"] = all
+	return op
+}
+
+// apiResponse Build an OpenAPI response, with a JSON body if schema is set.
+func apiResponse(code, description string, schema interface{}) map[string]interface{} {
+	r := map[string]interface{}{"description": description}
+	if schema != nil {
+		r["content"] = jsonContent(schema)
+	}
+	return map[string]interface{}{code: r}
+}
+
+func apiRequestBody(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"required": true,
+		"content":  jsonContent(schema),
+	}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// objectSchema Get the schema of an object with a single required member.
+func objectSchema(name string, schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"required":   []string{name},
+		"properties": map[string]interface{}{name: schema},
+	}
+}
+
+// queryParameter Build an optional string query parameter.
+func queryParameter(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
+
+func arraySchema(items interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// describe Use the description in the metadata of an affordance, if any.
+func describe(summary string, metadata map[string]interface{}) string {
+	if description, ok := metadata["description"].(string); ok && description != "" {
+		return summary + ": " + description
+	}
+	return summary
+}
@@ -0,0 +1,264 @@
+package webthing
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// persistDelay Time changes are collected before the state of a thing is
+// saved.
+const persistDelay = time.Second
+
+// Store A persistence backend for the state of things.
+type Store interface {
+	// Load Load the saved state of a thing.
+	//
+	// @param thingID ID of the thing
+	// @return The state, or nil if none was saved.
+	Load(thingID string) (*ThingState, error)
+
+	// Save Save the state of a thing.
+	//
+	// @param thingID ID of the thing
+	// @param state   The state to save
+	Save(thingID string, state *ThingState) error
+}
+
+// ThingState A snapshot of the property values and the history of a thing.
+type ThingState struct {
+	Properties map[string]json.RawMessage `json:"properties"`
+	Actions    []ActionState              `json:"actions,omitempty"`
+	Events     []EventState               `json:"events,omitempty"`
+}
+
+// ActionState A finished action in a snapshot.
+type ActionState struct {
+	ID            string           `json:"id"`
+	Name          string           `json:"name"`
+	Input         *json.RawMessage `json:"input,omitempty"`
+	Status        string           `json:"status"`
+	TimeRequested string           `json:"timeRequested"`
+	TimeCompleted string           `json:"timeCompleted,omitempty"`
+}
+
+// EventState An event in a snapshot.
+type EventState struct {
+	Name string          `json:"name"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Time string          `json:"time"`
+}
+
+// SetStore Persist the state of this thing in a store.
+//
+// The saved state is restored immediately: property values are set, which
+// calls their value forwarders, and finished actions and events are added
+// to the history. Properties added later are restored by AddProperty.
+//
+// @param store The persistence backend
+func (thing *Thing) SetStore(store Store) error {
+	state, err := store.Load(thing.id)
+	if err != nil {
+		return err
+	}
+
+	thing.persistMu.Lock()
+	thing.store = store
+	thing.state = state
+	thing.persistMu.Unlock()
+
+	if state == nil {
+		return nil
+	}
+
+	for _, property := range thing.propertyList() {
+		thing.restoreProperty(property)
+	}
+
+	thing.historyMu.Lock()
+	for _, a := range state.Actions {
+		if _, ok := thing.availableActions[a.Name]; !ok {
+			continue
+		}
+		action := NewAction(a.ID, thing, a.Name, a.Input, nil, func() {})
+		action.status = a.Status
+		action.timeRequested = a.TimeRequested
+		action.timeCompleted = a.TimeCompleted
+		action.SetHrefPrefix(thing.hrefPrefix)
+		thing.actions[a.Name] = append(thing.actions[a.Name], action)
+	}
+	events := state.Events
+	if len(events) > maxEvents {
+		events = events[len(events)-maxEvents:]
+	}
+	for _, e := range events {
+		event := NewEvent(thing, e.Name, e.Data)
+		event.time = e.Time
+		thing.events = append(thing.events, event)
+	}
+	thing.events = latestEvents(thing.events)
+	thing.historyMu.Unlock()
+
+	return nil
+}
+
+// SaveState Save the state of this thing to its store now.
+func (thing *Thing) SaveState() error {
+	thing.persistMu.Lock()
+	store := thing.store
+	if thing.persistTimer != nil {
+		thing.persistTimer.Stop()
+		thing.persistTimer = nil
+	}
+	thing.persistMu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+	return store.Save(thing.id, thing.snapshot())
+}
+
+// persist Schedule saving the state of this thing.
+func (thing *Thing) persist() {
+	thing.persistMu.Lock()
+	defer thing.persistMu.Unlock()
+
+	if thing.store == nil || thing.persistTimer != nil {
+		return
+	}
+	thing.persistTimer = time.AfterFunc(persistDelay, func() {
+		if err := thing.SaveState(); err != nil {
+			thing.log().Error("Save thing state failure", "error", err)
+		}
+	})
+}
+
+// snapshot Get the current state of this thing.
+func (thing *Thing) snapshot() *ThingState {
+	state := &ThingState{Properties: make(map[string]json.RawMessage)}
+	for _, property := range thing.propertyList() {
+		if !property.Persistent() {
+			continue
+		}
+		if value, err := json.Marshal(property.Value().Get()); err == nil {
+			state.Properties[property.Name()] = value
+		}
+	}
+
+	thing.historyMu.RLock()
+	defer thing.historyMu.RUnlock()
+	for name, actions := range thing.actions {
+		for _, action := range actions {
+			// Unfinished actions cannot be resumed after a restart.
+			if action == nil || action.Status() == "created" || action.Status() == "pending" {
+				continue
+			}
+			state.Actions = append(state.Actions, ActionState{
+				ID:            action.ID(),
+				Name:          name,
+				Input:         action.Input(),
+				Status:        action.Status(),
+				TimeRequested: action.TimeRequested(),
+				TimeCompleted: action.TimeCompleted(),
+			})
+		}
+	}
+	for _, event := range latestEvents(thing.events) {
+		state.Events = append(state.Events, EventState{
+			Name: event.Name(),
+			Data: event.Data(),
+			Time: event.Time(),
+		})
+	}
+	return state
+}
+
+// restoreProperty Set the saved value of a property, if any.
+func (thing *Thing) restoreProperty(property *Property) {
+	thing.persistMu.Lock()
+	state := thing.state
+	thing.persistMu.Unlock()
+
+	if state == nil || !property.Persistent() {
+		return
+	}
+	raw, ok := state.Properties[property.Name()]
+	if !ok {
+		return
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil || value == nil {
+		return
+	}
+	property.Value().Set(value)
+}
+
+// FileStore A Store keeping one JSON file per thing in a directory.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore Initialize the store, creating the directory if necessary.
+//
+// @param dir Directory of the files
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Load Load the saved state of a thing.
+func (s *FileStore) Load(thingID string) (*ThingState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := ioutil.ReadFile(s.path(thingID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &ThingState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save Save the state of a thing.
+func (s *FileStore) Save(thingID string, state *ThingState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Replace the file atomically so a crash never leaves a partial state.
+	tmp, err := ioutil.TempFile(s.dir, ".state-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(thingID))
+}
+
+func (s *FileStore) path(thingID string) string {
+	return filepath.Join(s.dir, url.QueryEscape(thingID)+".json")
+}
@@ -0,0 +1,101 @@
+package webthing
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// memoryStore A Store keeping states in memory.
+type memoryStore struct {
+	mu     sync.Mutex
+	states map[string]*ThingState
+}
+
+func (s *memoryStore) Load(thingID string) (*ThingState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[thingID], nil
+}
+
+func (s *memoryStore) Save(thingID string, state *ThingState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[thingID] = state
+	return nil
+}
+
+func TestSnapshotEventLimit(t *testing.T) {
+	thing := NewThing("urn:dev:ops:events", "Events", nil, "")
+	thing.AddAvailableEvent("tick", json.RawMessage(`{"type": "integer"}`))
+	for i := 0; i < maxEvents+10; i++ {
+		thing.AddEvent(NewEvent(thing, "tick", json.RawMessage(strconv.Itoa(i))))
+	}
+
+	state := thing.snapshot()
+	if len(state.Events) != maxEvents {
+		t.Fatalf("Expected %d events, got %d", maxEvents, len(state.Events))
+	}
+	if last := string(state.Events[maxEvents-1].Data); last != strconv.Itoa(maxEvents+9) {
+		t.Fatalf("Expected the latest event last, got %s", last)
+	}
+
+	for i := 0; i < maxEvents; i++ {
+		state.Events = append(state.Events, EventState{Name: "tick", Data: json.RawMessage(`0`)})
+	}
+	restored := NewThing("urn:dev:ops:events", "Events", nil, "")
+	restored.AddAvailableEvent("tick", json.RawMessage(`{"type": "integer"}`))
+	store := &memoryStore{states: map[string]*ThingState{restored.ID(): state}}
+	if err := restored.SetStore(store); err != nil {
+		t.Fatalf("SetStore: %v", err)
+	}
+	if len(restored.events) != maxEvents {
+		t.Fatalf("Expected %d restored events, got %d", maxEvents, len(restored.events))
+	}
+}
+
+func TestSnapshotConcurrentProperties(t *testing.T) {
+	thing := NewThing("urn:dev:ops:properties", "Properties", nil, "")
+	thing.AddProperty(NewProperty(thing, "level", NewValue(1.0), json.RawMessage(`{"type": "number"}`)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			property := NewProperty(thing, "p"+strconv.Itoa(i%10), NewValue(i), json.RawMessage(`{"type": "integer"}`))
+			thing.AddProperty(property)
+			thing.RemoveProperty(*property)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if state := thing.snapshot(); string(state.Properties["level"]) != "1" {
+			t.Fatalf("Unexpected state: %v", state.Properties)
+		}
+	}
+	<-done
+}
+
+func TestSnapshotConcurrentValues(t *testing.T) {
+	thing := NewThing("urn:dev:ops:values", "Values", nil, "")
+	thing.AddProperty(NewProperty(thing, "level", NewValue(0), json.RawMessage(`{"type": "integer"}`)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 1000; i++ {
+			value := NewValue(i)
+			if err := thing.SetProperty("level", &value); err != nil {
+				t.Errorf("SetProperty: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		thing.snapshot()
+	}
+	<-done
+	if state := thing.snapshot(); string(state.Properties["level"]) != "1000" {
+		t.Fatalf("Unexpected state: %v", state.Properties)
+	}
+}
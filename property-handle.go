@@ -2,7 +2,6 @@ package webthing
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 )
@@ -20,7 +19,12 @@ func (h *PropertyHandle) Handle(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	h.Property = h.properties[name]
+	property, ok := h.findProperty(name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.Property = property
 	BaseHandle(h, w, r)
 }
 
@@ -37,10 +41,10 @@ func (h *PropertyHandle) Get(w http.ResponseWriter, r *http.Request) {
 
 	content, err := json.Marshal(description)
 	if err != nil {
-		fmt.Println(err)
+		h.PropertiesHandle.Thing.requestLog(r, "property", name).Error("Encode property failure", "error", err)
 	}
 	if _, err := w.Write(content); err != nil {
-		fmt.Println(err)
+		h.PropertiesHandle.Thing.requestLog(r, "property", name).Error("Write response failure", "error", err)
 	}
 }
 
@@ -55,20 +59,25 @@ func (h *PropertyHandle) Put(w http.ResponseWriter, r *http.Request) {
 	var obj map[string]interface{}
 	err := json.Unmarshal(body, &obj)
 	if err != nil {
-		fmt.Println(err)
+		h.PropertiesHandle.Thing.requestLog(r, "property", h.Property.Name()).Debug("Invalid property request", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	name := h.Property.Name()
-	h.Property.Value().Set(obj[name])
+	value := NewValue(obj[name])
+	if err := h.PropertiesHandle.Thing.SetPropertyContext(r.Context(), name, &value); err != nil {
+		h.PropertiesHandle.Thing.requestLog(r, "property", name).Warn("Set property failure", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
 	description := make(map[string]interface{})
 	description[name] = h.Property.Value().Get()
 	content, _ := json.Marshal(description)
 
 	if _, err = w.Write(content); err != nil {
-		fmt.Println(err)
+		h.PropertiesHandle.Thing.requestLog(r, "property", name).Error("Write response failure", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 	}
 }
@@ -1,10 +1,13 @@
 package webthing
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"go/types"
+	"reflect"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Property Initialize the object.
@@ -21,6 +24,10 @@ type Property struct {
 	hrefPrefix string
 	href       string
 	metadata   json.RawMessage
+	persistent bool
+	history    History
+	notifier   *notifier
+	computed   *computed
 }
 
 // PropertyObject A property object describes an attribute of a Thing and is indexed by a property id.
@@ -45,19 +52,29 @@ type PropertyObject struct {
 // @param {Object} metadata Property metadata, i.e. type, description, unit,
 //                          etc., as an object.
 func NewProperty(thing *Thing, name string, value Value, metadata json.RawMessage) *Property {
+	return newProperty(thing, name, &value, metadata)
+}
+
+// newProperty Initialize the object, holding the value pointed to.
+func newProperty(thing *Thing, name string, value *Value, metadata json.RawMessage) *Property {
 	property := &Property{
 		thing:      thing,
 		name:       name,
-		value:      &value,
+		value:      value,
 		hrefPrefix: "",
 		href:       `/properties/` + name,
 		metadata:   metadata,
+		persistent: true,
 	}
 
 	// Add the property change observer to notify the Thing about a property
 	// change.
-	//property.Value.on("update", () => property.thing.PropertyNotify(*property));
-	thing.PropertyNotify(*property)
+	property.value.onUpdateContext(func(ctx context.Context, _ interface{}) {
+		property.thing.propertyChanged(ctx, property)
+	})
+	property.value.log = func() Logger {
+		return property.thing.log("property", property.name)
+	}
 
 	return property
 }
@@ -78,7 +95,19 @@ func (property *Property) ValidateValue(value interface{}) error {
 	if prop.ReadOnly {
 		return errors.New(" Read-only property. ")
 	}
-	if !validate(prop.Type, value) {
+
+	return property.validateType(value)
+}
+
+// validateType Validate the type of a value against the property metadata.
+//
+// @param {*} value - Value to validate
+func (property *Property) validateType(value interface{}) error {
+	prop := &PropertyObject{}
+	if err := json.Unmarshal(property.Metadata(), prop); err != nil {
+		return err
+	}
+	if prop.Type != "" && !validate(prop.Type, value) {
 		return errors.New(" Invalid property value. ")
 	}
 
@@ -95,14 +124,25 @@ func (property *Property) AsPropertyDescription() []byte {
 		Href: property.hrefPrefix + property.href,
 	}
 	base := &PropertyObject{Links: []Link{link}}
+	if property.History() != nil {
+		base.Links = append(base.Links, Link{
+			Rel:  "history",
+			Href: link.Href + "/history",
+		})
+	}
 
 	meta, _ := property.Metadata().MarshalJSON()
 	if err := json.Unmarshal(meta, base); err != nil {
-		fmt.Println("Error: ", err.Error())
+		property.thing.log("property", property.name).Error("Invalid property metadata", "error", err)
 		return []byte(err.Error())
 	}
 
-	propertyBase, _ := json.Marshal(base)
+	// Keep the metadata PropertyObject has no field for, e.g. enum.
+	description := make(map[string]interface{})
+	json.Unmarshal(meta, &description)
+	description["links"] = base.Links
+
+	propertyBase, _ := json.Marshal(description)
 
 	return propertyBase
 }
@@ -132,14 +172,51 @@ func (property *Property) Value() *Value {
 //
 // @param {*} value The value to set
 func (property *Property) SetValue(value *Value) error {
+	return property.setValue(context.Background(), value.Get())
+}
+
+// setValue Validate a value, forward it to the thing and notify observers.
+// Each value forwarder runs in a span of its own.
+func (property *Property) setValue(ctx context.Context, value interface{}) error {
 	if err := property.ValidateValue(value); err != nil {
-		fmt.Print("Ser property value failure. Err: ", err)
+		property.thing.log("property", property.name).Debug("Invalid property value", "error", err)
 		return err
 	}
-	property.value = value
+	if property.value.convert != nil {
+		converted, err := property.value.convert(value)
+		if err != nil {
+			property.thing.log("property", property.name).Debug("Invalid property value", "error", err)
+			return errors.New(" Invalid property value. ")
+		}
+		value = converted
+	}
+	for _, valueForwarder := range property.value.valueForwarder {
+		_, span := property.thing.tracer().Start(ctx, "ValueForwarder "+property.name,
+			trace.WithAttributes(attribute.String("webthing.property", property.name)))
+		valueForwarder(value)
+		span.End()
+	}
+	property.value.NotifyOfExternalUpdateContext(ctx, value)
 	return nil
 }
 
+// Persistent Whether the value of this property is saved to the store of
+// its thing.
+//
+// @returns {Boolean} The persistence flag.
+func (property *Property) Persistent() bool {
+	return property.persistent
+}
+
+// SetPersistent Opt this property in or out of persistence. Properties are
+// persisted by default; opt out before adding the property to its thing to
+// also skip restoring the saved value.
+//
+// @param {Boolean} persistent Whether to persist the value
+func (property *Property) SetPersistent(persistent bool) {
+	property.persistent = persistent
+}
+
 // Name Get the name of this property.
 //
 // @returns {String} The property name.
@@ -180,11 +257,19 @@ func (property *Property) Metadata() json.RawMessage {
 // 	string  A JSON string.
 //
 func validate(primitive string, v interface{}) bool {
-	switch v.(type) {
-	case types.Array:
+	switch v := v.(type) {
+	case nil:
+		if primitive == "null" {
+			return true
+		}
+	case []interface{}:
 		if primitive == "array" {
 			return true
 		}
+	case map[string]interface{}:
+		if primitive == "object" {
+			return true
+		}
 	case bool:
 		if primitive == "boolean" {
 			return true
@@ -193,14 +278,27 @@ func validate(primitive string, v interface{}) bool {
 		if primitive == "string" {
 			return true
 		}
-	case int, int8, int16, int32, int64:
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 		if primitive == "integer" || primitive == "number" {
 			return true
 		}
-	case float32, float64:
-		if primitive == "number" {
+	case float32:
+		if primitive == "number" || primitive == "integer" && v == float32(int64(v)) {
 			return true
 		}
+	case float64:
+		// JSON numbers are always decoded as float64.
+		if primitive == "number" || primitive == "integer" && v == float64(int64(v)) {
+			return true
+		}
+	default:
+		// Typed slices, maps and structs.
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Slice, reflect.Array:
+			return primitive == "array"
+		case reflect.Map, reflect.Struct:
+			return primitive == "object"
+		}
 	}
 
 	return false
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/client"
+	"github.com/google/uuid"
+)
+
+// errRemoteAction The remote action finished with the status "failed".
+var errRemoteAction = errors.New("proxy: remote action failed")
+
+// action An action forwarded to the remote thing. It finishes when the
+// remote action does.
+type action struct {
+	*webthing.Action
+	proxy  *Thing
+	name   string
+	cancel chan struct{}
+}
+
+// Generator Create a new forwarded action.
+func (a *action) Generator(thing *webthing.Thing) *webthing.Action {
+	forwarded := &action{proxy: a.proxy, name: a.name, cancel: make(chan struct{})}
+	forwarded.Action = webthing.NewAction(uuid.New().String(), thing, a.name, nil, forwarded.PerformAction, forwarded.Cancel)
+	return forwarded.Action
+}
+
+// PerformAction Request the action on the remote thing and wait until it
+// finishes. The action fails if it cannot be requested or if the remote
+// action fails.
+func (a *action) PerformAction() *webthing.Action {
+	p := a.proxy
+	var input interface{}
+	if in := a.Input(); in != nil && len(*in) > 0 {
+		input = json.RawMessage(*in)
+	}
+	status, err := p.remote.InvokeAction(p.ctx, a.name, input)
+	if err != nil {
+		a.Fail(err)
+		return a.Action
+	}
+	if status.Href == "" {
+		return a.Action
+	}
+
+	ch := make(chan *client.ActionStatus, 1)
+	p.mu.Lock()
+	p.waiting[status.Href] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.waiting, status.Href)
+		p.mu.Unlock()
+	}()
+
+	// The status may have changed before the action was waiting for it.
+	if current, err := p.remote.QueryAction(p.ctx, status); err == nil {
+		status = current
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for !finished(status.Status) {
+		select {
+		case status = <-ch:
+		case <-ticker.C:
+			current, err := p.remote.QueryAction(p.ctx, status)
+			if errors.Is(err, client.ErrNotFound) {
+				return a.Action
+			}
+			if err == nil {
+				status = current
+			}
+		case <-a.cancel:
+			if err := p.remote.CancelAction(p.ctx, status); err != nil && !errors.Is(err, client.ErrNotFound) {
+				p.Logger().Warn("Cancel remote action failure", "thing", p.ID(), "action", a.name, "error", err)
+			}
+			return a.Action
+		case <-p.ctx.Done():
+			return a.Action
+		}
+	}
+	if status.Status == "failed" {
+		a.Fail(errRemoteAction)
+	}
+	return a.Action
+}
+
+// Cancel Cancel the remote action.
+func (a *action) Cancel() {
+	close(a.cancel)
+}
@@ -0,0 +1,294 @@
+// Package proxy Re-expose things served by other Web Thing servers, in any
+// language, as local things.
+//
+// A proxy is a webthing.Thing built from the description of a remote thing.
+// Property values are mirrored through the websocket of the remote thing,
+// writes and action requests are forwarded to it and its events are emitted
+// again, so that the proxy can be served by a ThingServer like any local
+// thing:
+//
+//	proxies, err := proxy.FetchAll(ctx, client.New(), "http://lamp.local:8888")
+//	var things []*webthing.Thing
+//	for _, p := range proxies {
+//		things = append(things, p.Thing)
+//	}
+//	server := webthing.NewWebThingServer(webthing.NewMultipleThings(things, "Gateway"),
+//		&http.Server{Addr: ":8888"}, "")
+//	server.Start()
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/client"
+)
+
+const (
+	// minReconnectDelay, maxReconnectDelay Delays between attempts to
+	// reconnect to a remote thing.
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+
+	// pollInterval Interval at which the status of a forwarded action is
+	// queried in case its notification is missed.
+	pollInterval = 5 * time.Second
+)
+
+// Thing A local thing mirroring a remote thing.
+type Thing struct {
+	*webthing.Thing
+	remote *client.Thing
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu            sync.Mutex
+	subscriptions []*client.Subscription
+	reconnecting  bool
+
+	// waiting Channels of forwarded actions by the href of the remote action.
+	waiting map[string]chan *client.ActionStatus
+}
+
+// FetchAll Fetch the things served at a URL and create a proxy of each.
+//
+// @param ctx    Context of the requests
+// @param c      The client
+// @param rawURL URL of the remote server or thing
+// @return The proxies.
+func FetchAll(ctx context.Context, c *client.Client, rawURL string) ([]*Thing, error) {
+	remotes, err := c.FetchAll(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	proxies := make([]*Thing, 0, len(remotes))
+	for _, remote := range remotes {
+		p, err := New(ctx, remote)
+		if err != nil {
+			for _, p := range proxies {
+				p.Close()
+			}
+			return nil, err
+		}
+		proxies = append(proxies, p)
+	}
+	return proxies, nil
+}
+
+// New Create a proxy of a remote thing. The proxy reads the current property
+// values and observes the remote thing until it is closed, reconnecting when
+// the connection is lost.
+//
+// @param ctx    Context of the initial requests
+// @param remote The remote thing
+func New(ctx context.Context, remote *client.Thing) (*Thing, error) {
+	td := remote.Description()
+	id := td.ID
+	if id == "" {
+		id = td.Title
+	}
+
+	p := &Thing{
+		Thing:   webthing.NewThing(id, td.Title, []string(td.Type), td.Description),
+		remote:  remote,
+		waiting: make(map[string]chan *client.ActionStatus),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	values, err := remote.ReadAllProperties(ctx)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	for name, affordance := range td.Properties {
+		name := name
+		value := webthing.NewValue(values[name], func(v interface{}) {
+			p.writeProperty(name, v)
+		})
+		p.AddProperty(webthing.NewProperty(p.Thing, name, value, metadata(affordance)))
+	}
+	for name, affordance := range td.Actions {
+		p.AddAvailableAction(name, metadata(affordance), &action{proxy: p, name: name})
+	}
+	for name, affordance := range td.Events {
+		p.AddAvailableEvent(name, metadata(affordance))
+	}
+
+	remote.ErrorHandler = p.handleError
+	if err := p.subscribe(ctx); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Remote Get the remote thing.
+func (p *Thing) Remote() *client.Thing {
+	return p.remote
+}
+
+// Close Stop mirroring the remote thing and close its connection.
+func (p *Thing) Close() error {
+	p.cancel()
+	p.mu.Lock()
+	p.unsubscribe()
+	p.mu.Unlock()
+	return p.remote.Close()
+}
+
+// subscribe Observe the properties, actions and events of the remote thing.
+func (p *Thing) subscribe(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	td := p.remote.Description()
+	for name := range td.Properties {
+		value := p.Property(name)
+		s, err := p.remote.ObserveProperty(ctx, name, value.NotifyOfExternalUpdate)
+		if err != nil {
+			return err
+		}
+		p.subscriptions = append(p.subscriptions, s)
+	}
+	for name := range td.Events {
+		name := name
+		s, err := p.remote.SubscribeEvent(ctx, name, func(e *client.Event) {
+			p.AddEvent(webthing.NewEvent(p.Thing, name, e.Data))
+		})
+		if err != nil {
+			return err
+		}
+		p.subscriptions = append(p.subscriptions, s)
+	}
+	s, err := p.remote.ObserveActions(ctx, p.actionStatus)
+	if err != nil {
+		return err
+	}
+	p.subscriptions = append(p.subscriptions, s)
+	return nil
+}
+
+// unsubscribe Remove the observers of the remote thing. Callers hold the
+// lock.
+func (p *Thing) unsubscribe() {
+	for _, s := range p.subscriptions {
+		s.Unsubscribe()
+	}
+	p.subscriptions = nil
+}
+
+// handleError Log errors of the remote thing and reconnect when the
+// connection is lost.
+func (p *Thing) handleError(err error) {
+	var protocolError *client.ProtocolError
+	if errors.As(err, &protocolError) {
+		p.Logger().Warn("Remote thing error", "thing", p.ID(), "error", err)
+		return
+	}
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	reconnecting := p.reconnecting
+	p.reconnecting = true
+	p.mu.Unlock()
+	if reconnecting {
+		return
+	}
+	p.Logger().Warn("Remote thing connection lost", "thing", p.ID(), "error", err)
+	p.SetConnectivity(webthing.Offline, err.Error())
+	go p.reconnect()
+}
+
+// reconnect Reconnect to the remote thing with an increasing delay, then
+// read the property values that changed in the meantime.
+func (p *Thing) reconnect() {
+	defer func() {
+		p.mu.Lock()
+		p.reconnecting = false
+		p.mu.Unlock()
+	}()
+
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-p.ctx.Done():
+			return
+		}
+		if err := p.resync(); err == nil {
+			p.SetConnectivity(webthing.Online, "")
+			return
+		} else if p.ctx.Err() == nil {
+			p.Logger().Debug("Reconnect remote thing failure", "thing", p.ID(), "error", err)
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// resync Open a new connection to the remote thing, which keeps the
+// observers, and update the property values.
+func (p *Thing) resync() error {
+	if err := p.remote.Connect(p.ctx); err != nil {
+		return err
+	}
+	values, err := p.remote.ReadAllProperties(p.ctx)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		if p.HasProperty(name) {
+			p.Property(name).NotifyOfExternalUpdate(value)
+		}
+	}
+	return nil
+}
+
+// writeProperty Forward a new property value to the remote thing. The value
+// is corrected by the next notification of the remote thing if the write
+// fails.
+func (p *Thing) writeProperty(name string, value interface{}) {
+	if err := p.remote.WriteProperty(p.ctx, name, value); err != nil {
+		p.Logger().Warn("Write remote property failure", "thing", p.ID(), "property", name, "error", err)
+	}
+}
+
+// actionStatus Pass the final status of a remote action to the forwarded
+// action waiting for it.
+func (p *Thing) actionStatus(status *client.ActionStatus) {
+	if !finished(status.Status) {
+		return
+	}
+	p.mu.Lock()
+	ch, ok := p.waiting[status.Href]
+	p.mu.Unlock()
+	if ok {
+		select {
+		case ch <- status:
+		default:
+		}
+	}
+}
+
+// metadata Get the metadata of a remote affordance without its forms and
+// links, which the local thing describes itself.
+func metadata(affordance *client.Affordance) json.RawMessage {
+	m := map[string]interface{}{}
+	json.Unmarshal(affordance.Metadata, &m)
+	delete(m, "forms")
+	delete(m, "links")
+	content, _ := json.Marshal(m)
+	return content
+}
+
+func finished(status string) bool {
+	return status == "completed" || status == "cancelled" || status == "failed"
+}
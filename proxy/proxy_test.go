@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/client"
+	"github.com/google/uuid"
+)
+
+var (
+	lampOnce   sync.Once
+	lampThing  *webthing.Thing
+	lampServer *httptest.Server
+)
+
+// toggleAction Toggle the on property of the lamp, or fail if broken.
+type toggleAction struct {
+	*webthing.Action
+	name string
+}
+
+func (toggle *toggleAction) Generator(thing *webthing.Thing) *webthing.Action {
+	action := &toggleAction{name: toggle.name}
+	action.Action = webthing.NewAction(uuid.New().String(), thing, toggle.name, nil, action.PerformAction, action.Cancel)
+	return action.Action
+}
+
+func (toggle *toggleAction) PerformAction() *webthing.Action {
+	if toggle.name == "break" {
+		toggle.Fail(errors.New("broken"))
+		return toggle.Action
+	}
+	on := toggle.Thing().Property("on")
+	on.Set(!on.Get().(bool))
+	return toggle.Action
+}
+
+func (toggle *toggleAction) Cancel() {}
+
+// serveLamp Serve a lamp from a ThingServer, which registers its routes on
+// the default mux and is therefore shared by the tests.
+func serveLamp() (*webthing.Thing, string) {
+	lampOnce.Do(func() {
+		lampThing = webthing.NewThing("urn:dev:ops:proxy-lamp", "Lamp", []string{"OnOffSwitch"}, "A remote lamp")
+		lampThing.AddProperty(webthing.NewProperty(lampThing, "on", webthing.NewValue(false),
+			json.RawMessage(`{"type": "boolean", "title": "On/Off"}`)))
+		lampThing.AddProperty(webthing.NewProperty(lampThing, "level", webthing.NewValue(50.0),
+			json.RawMessage(`{"type": "number", "minimum": 0, "maximum": 100}`)))
+		lampThing.AddAvailableAction("toggle", json.RawMessage(`{"title": "Toggle"}`), &toggleAction{name: "toggle"})
+		lampThing.AddAvailableAction("break", json.RawMessage(`{"title": "Break"}`), &toggleAction{name: "break"})
+		lampThing.AddAvailableEvent("ping", json.RawMessage(`{"type": "string"}`))
+
+		webthing.NewWebThingServer(webthing.NewSingleThing(lampThing), &http.Server{}, "")
+		lampServer = httptest.NewServer(http.DefaultServeMux)
+	})
+	return lampThing, lampServer.URL
+}
+
+// newProxy Create a proxy of the lamp.
+func newProxy(t *testing.T) (*webthing.Thing, *Thing) {
+	lamp, url := serveLamp()
+	proxies, err := FetchAll(context.Background(), client.New(), url)
+	if err != nil {
+		t.Fatalf("FetchAll: %v", err)
+	}
+	if len(proxies) != 1 {
+		t.Fatalf("Expected 1 proxy, got %d", len(proxies))
+	}
+	t.Cleanup(func() { proxies[0].Close() })
+	return lamp, proxies[0]
+}
+
+// eventually Wait for a condition met asynchronously.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNew(t *testing.T) {
+	lamp, p := newProxy(t)
+	if p.ID() != lamp.ID() || p.Title() != "Lamp" || p.Description() != "A remote lamp" {
+		t.Fatalf("Expected the description of the lamp, got %s %s %s", p.ID(), p.Title(), p.Description())
+	}
+	if on := p.Property("on").Get(); on != lamp.Property("on").Get() {
+		t.Fatalf("Expected the current value of on, got %v", on)
+	}
+
+	var td struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+		Actions    map[string]json.RawMessage        `json:"actions"`
+		Events     map[string]json.RawMessage        `json:"events"`
+	}
+	if err := json.Unmarshal(p.AsThingDescription(), &td); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if level := td.Properties["level"]; level["maximum"] != 100.0 || level["type"] != "number" {
+		t.Fatalf("Expected the metadata of level, got %v", level)
+	}
+	if _, ok := td.Actions["toggle"]; !ok {
+		t.Fatal("Expected the toggle action")
+	}
+	if _, ok := td.Events["ping"]; !ok {
+		t.Fatal("Expected the ping event")
+	}
+}
+
+func TestMirrorProperty(t *testing.T) {
+	lamp, p := newProxy(t)
+	lamp.Property("level").NotifyOfExternalUpdate(33.0)
+	eventually(t, "the mirrored level", func() bool { return p.Property("level").Get() == 33.0 })
+}
+
+func TestWriteProperty(t *testing.T) {
+	lamp, p := newProxy(t)
+	value := webthing.NewValue(70.0)
+	if err := p.SetProperty("level", &value); err != nil {
+		t.Fatalf("SetProperty: %v", err)
+	}
+	eventually(t, "the written level", func() bool { return lamp.Property("level").Get() == 70.0 })
+}
+
+func TestEvents(t *testing.T) {
+	lamp, p := newProxy(t)
+	events := make(chan *webthing.Event, 10)
+	p.OnEvent(func(event *webthing.Event) { events <- event })
+
+	// The subscription of the proxy is sent asynchronously, emit until it
+	// is received.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		lamp.AddEvent(webthing.NewEvent(lamp, "ping", json.RawMessage(`"hello"`)))
+		select {
+		case event := <-events:
+			if event.Name() != "ping" || string(event.Data()) != `"hello"` {
+				t.Fatalf("Unexpected event %s %s", event.Name(), event.Data())
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	t.Fatal("Timed out waiting for the event")
+}
+
+func TestPerformAction(t *testing.T) {
+	lamp, p := newProxy(t)
+	before := lamp.Property("on").Get().(bool)
+
+	action, err := p.PerformAction("toggle", nil)
+	if err != nil {
+		t.Fatalf("PerformAction: %v", err)
+	}
+	if action.Start(); action.Status() != "completed" {
+		t.Fatalf("Expected the action to complete, got %s", action.Status())
+	}
+	if lamp.Property("on").Get().(bool) == before {
+		t.Fatal("Expected the remote action to be performed")
+	}
+
+	action, err = p.PerformAction("break", nil)
+	if err != nil {
+		t.Fatalf("PerformAction: %v", err)
+	}
+	if action.Start(); action.Status() != "failed" {
+		t.Fatalf("Expected the failure of the remote action, got %s", action.Status())
+	}
+}
+
+func TestPerformActionClosed(t *testing.T) {
+	_, p := newProxy(t)
+	p.Close()
+
+	action, err := p.PerformAction("toggle", nil)
+	if err != nil {
+		t.Fatalf("PerformAction: %v", err)
+	}
+	if action.Start(); action.Status() != "failed" {
+		t.Fatalf("Expected the action of a closed proxy to fail, got %s", action.Status())
+	}
+}
+
+func TestClose(t *testing.T) {
+	lamp, p := newProxy(t)
+	lamp.Property("level").NotifyOfExternalUpdate(20.0)
+	eventually(t, "the mirrored level", func() bool { return p.Property("level").Get() == 20.0 })
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	lamp.Property("level").NotifyOfExternalUpdate(21.0)
+	time.Sleep(100 * time.Millisecond)
+	if level := p.Property("level").Get(); level != 20.0 {
+		t.Fatalf("Expected the closed proxy to stop mirroring, got %v", level)
+	}
+}
+
+// brokenServer Serve a thing whose properties fail with the given status and
+// whose websocket cannot be opened, counting the attempts to open it.
+func brokenServer(t *testing.T, status int, dials *int32) *client.Thing {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/properties", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"level": 1}`))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(dials, 1)
+		w.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	var td client.ThingDescription
+	json.Unmarshal([]byte(`{
+		"id": "urn:dev:ops:broken",
+		"title": "Broken",
+		"properties": {"level": {"type": "number"}},
+		"links": [{"rel": "properties", "href": "/properties"}]
+	}`), &td)
+	remote, err := client.New().Consume(&td, server.URL)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	return remote
+}
+
+func TestNewFailure(t *testing.T) {
+	var dials int32
+	remote := brokenServer(t, http.StatusInternalServerError, &dials)
+	if _, err := New(context.Background(), remote); err == nil {
+		t.Fatal("Expected reading the properties to fail")
+	}
+	if n := atomic.LoadInt32(&dials); n != 0 {
+		t.Fatalf("Expected no websocket after the failure, got %d attempts", n)
+	}
+
+	remote = brokenServer(t, http.StatusOK, &dials)
+	if _, err := New(context.Background(), remote); err == nil {
+		t.Fatal("Expected opening the websocket to fail")
+	}
+	// The failed proxy does not try to reconnect.
+	n := atomic.LoadInt32(&dials)
+	time.Sleep(minReconnectDelay + 100*time.Millisecond)
+	if m := atomic.LoadInt32(&dials); m != n {
+		t.Fatalf("Expected no reconnection of a failed proxy, got %d attempts", m-n)
+	}
+}
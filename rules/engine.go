@@ -0,0 +1,537 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/schedule"
+	"github.com/google/uuid"
+)
+
+// Engine Runs rules on a set of things.
+type Engine struct {
+	things []*webthing.Thing
+	byID   map[string]*webthing.Thing
+	logger webthing.Logger
+	clock  schedule.Clock
+
+	mu     sync.Mutex
+	rules  map[string]*state
+	closed bool
+}
+
+// state A rule with the state of its trigger.
+type state struct {
+	rule Rule
+
+	// active Whether the comparison of a property trigger holds.
+	active bool
+
+	// timer Timer of a property trigger with a duration or of a schedule.
+	timer schedule.Timer
+}
+
+// Option Configure an engine.
+type Option func(*Engine)
+
+// WithLogger Log fired rules and failed effects with the given logger
+// rather than the logger of the first thing.
+//
+// @param logger The logger
+func WithLogger(logger webthing.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// WithClock Use a clock other than the one of the time package, e.g. a fake
+// clock in tests.
+//
+// @param clock The clock
+func WithClock(clock schedule.Clock) Option {
+	return func(e *Engine) {
+		e.clock = clock
+	}
+}
+
+// New Create an engine running rules on things. Things are referred to by
+// their id in rules.
+//
+// @param things The things
+func New(things []*webthing.Thing, opts ...Option) *Engine {
+	e := &Engine{
+		things: things,
+		byID:   make(map[string]*webthing.Thing),
+		rules:  make(map[string]*state),
+		clock:  schedule.SystemClock,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.logger == nil {
+		var first *webthing.Thing
+		if len(things) > 0 {
+			first = things[0]
+		}
+		e.logger = first.Logger()
+	}
+
+	for _, thing := range things {
+		thing := thing
+		e.byID[thing.ID()] = thing
+		thing.OnPropertyChange(func(property *webthing.Property) {
+			e.propertyChanged(thing, property.Name(), property.Value().Get())
+		})
+		thing.OnEvent(func(event *webthing.Event) {
+			e.eventAdded(thing, event.Name())
+		})
+	}
+	return e
+}
+
+// Add Add a rule. A rule without id is given a new one.
+//
+// @param rule The rule
+// @return The added rule.
+func (e *Engine) Add(rule Rule) (Rule, error) {
+	if rule.ID == "" {
+		rule.ID = uuid.New().String()
+	}
+	if err := e.validate(&rule); err != nil {
+		return rule, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.rules[rule.ID]; ok {
+		return rule, ErrExists
+	}
+	if err := e.checkLoop(rule); err != nil {
+		return rule, err
+	}
+	e.start(rule)
+	return rule, nil
+}
+
+// Put Create or replace the rule with the id of the given rule.
+//
+// @param rule The rule
+// @return Whether the rule was created.
+func (e *Engine) Put(rule Rule) (bool, error) {
+	if err := e.validate(&rule); err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.checkLoop(rule); err != nil {
+		return false, err
+	}
+	old, ok := e.rules[rule.ID]
+	if ok {
+		old.stop()
+	}
+	e.start(rule)
+	return !ok, nil
+}
+
+// Get Get the rule with the given id.
+//
+// @param id The id of the rule
+func (e *Engine) Get(id string) (Rule, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.rules[id]
+	if !ok {
+		return Rule{}, false
+	}
+	return s.rule, true
+}
+
+// Delete Delete the rule with the given id.
+//
+// @param id The id of the rule
+// @return Whether the rule existed.
+func (e *Engine) Delete(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.rules[id]
+	if ok {
+		s.stop()
+		delete(e.rules, id)
+	}
+	return ok
+}
+
+// Rules Get all rules ordered by id.
+func (e *Engine) Rules() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := make([]Rule, 0, len(e.rules))
+	for _, s := range e.rules {
+		rules = append(rules, s.rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// Load Create or replace the rules of a JSON array.
+//
+// @param data The JSON array of rules
+func (e *Engine) Load(data []byte) error {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	for i := range rules {
+		if rules[i].ID == "" {
+			rules[i].ID = uuid.New().String()
+		}
+		if err := e.validate(&rules[i]); err != nil {
+			return fmt.Errorf("rule %q: %w", rules[i].ID, err)
+		}
+	}
+	for _, rule := range rules {
+		if _, err := e.Put(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFile Create or replace the rules of a JSON file.
+//
+// @param path Path of the file
+func (e *Engine) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return e.Load(data)
+}
+
+// Close Stop all rules.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for _, s := range e.rules {
+		s.stop()
+	}
+	return nil
+}
+
+// start Add a rule and start its trigger. Callers hold the lock.
+func (e *Engine) start(rule Rule) {
+	s := &state{rule: rule}
+	e.rules[rule.ID] = s
+	if !rule.Enabled || e.closed {
+		return
+	}
+
+	t := &rule.Trigger
+	switch t.Type {
+	case TriggerProperty:
+		if t.Op == "" {
+			return
+		}
+		value := e.thing(t.Thing).Property(t.Property).Get()
+		if s.active = compare(value, t.Op, t.Value); s.active && t.For > 0 {
+			e.hold(s)
+		}
+	case TriggerSchedule:
+		e.schedule(s)
+	}
+}
+
+// stop Stop the timer of a rule.
+func (s *state) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.active = false
+}
+
+// hold Fire a property trigger with a duration once it held that long.
+// Callers hold the lock.
+func (e *Engine) hold(s *state) {
+	var timer schedule.Timer
+	timer = e.clock.AfterFunc(time.Duration(s.rule.Trigger.For), func() {
+		e.mu.Lock()
+		fire := s.timer == timer && s.active && e.rules[s.rule.ID] == s
+		e.mu.Unlock()
+		if fire {
+			e.fire(s.rule)
+		}
+	})
+	s.timer = timer
+}
+
+// schedule Fire a schedule trigger at its next time and schedule it again.
+// Callers hold the lock.
+func (e *Engine) schedule(s *state) {
+	var timer schedule.Timer
+	now := e.clock.Now()
+	timer = e.clock.AfterFunc(s.rule.Trigger.next(now).Sub(now), func() {
+		e.mu.Lock()
+		fire := s.timer == timer && e.rules[s.rule.ID] == s && !e.closed
+		if fire {
+			e.schedule(s)
+		}
+		e.mu.Unlock()
+		if fire {
+			e.fire(s.rule)
+		}
+	})
+	s.timer = timer
+}
+
+// propertyChanged Fire the property triggers of a changed property.
+func (e *Engine) propertyChanged(thing *webthing.Thing, name string, value interface{}) {
+	var fired []Rule
+	e.mu.Lock()
+	for _, s := range e.rules {
+		t := &s.rule.Trigger
+		if !s.rule.Enabled || e.closed || t.Type != TriggerProperty || t.Property != name || e.thing(t.Thing) != thing {
+			continue
+		}
+		if t.Op == "" {
+			fired = append(fired, s.rule)
+			continue
+		}
+		match := compare(value, t.Op, t.Value)
+		switch {
+		case match && !s.active:
+			s.active = true
+			if t.For > 0 {
+				e.hold(s)
+			} else {
+				fired = append(fired, s.rule)
+			}
+		case !match && s.active:
+			s.stop()
+		}
+	}
+	e.mu.Unlock()
+
+	// Effects run apart from the hook, as they may change properties of the
+	// same thing.
+	for _, rule := range fired {
+		go e.fire(rule)
+	}
+}
+
+// eventAdded Fire the event triggers of an event.
+func (e *Engine) eventAdded(thing *webthing.Thing, name string) {
+	var fired []Rule
+	e.mu.Lock()
+	for _, s := range e.rules {
+		t := &s.rule.Trigger
+		if s.rule.Enabled && !e.closed && t.Type == TriggerEvent && t.Event == name && e.thing(t.Thing) == thing {
+			fired = append(fired, s.rule)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, rule := range fired {
+		go e.fire(rule)
+	}
+}
+
+// fire Apply the effects of a triggered rule if its conditions hold.
+func (e *Engine) fire(rule Rule) {
+	for _, c := range rule.Conditions {
+		value := e.thing(c.Thing).Property(c.Property).Get()
+		if !compare(value, c.Op, c.Value) {
+			e.logger.Debug("Rule condition not met", "rule", rule.ID, "thing", c.Thing, "property", c.Property)
+			return
+		}
+	}
+
+	e.logger.Info("Rule fired", "rule", rule.ID)
+	for _, effect := range rule.Effects {
+		if err := e.apply(effect); err != nil {
+			e.logger.Warn("Rule effect failure", "rule", rule.ID, "effect", effect.Type, "error", err)
+		}
+	}
+}
+
+// apply Apply an effect.
+func (e *Engine) apply(effect Effect) error {
+	thing := e.thing(effect.Thing)
+	switch effect.Type {
+	case EffectSetProperty:
+		value := webthing.NewValue(effect.Value)
+		return thing.SetProperty(effect.Property, &value)
+	case EffectPerformAction:
+		var input *json.RawMessage
+		if len(effect.Input) > 0 {
+			input = &effect.Input
+		}
+		action, err := thing.PerformAction(effect.Action, input)
+		if err != nil {
+			return err
+		}
+		go action.Start()
+	case EffectEmitEvent:
+		thing.AddEvent(webthing.NewEvent(thing, effect.Event, effect.Data))
+	}
+	return nil
+}
+
+// event An event of a thing.
+type event struct {
+	thing *webthing.Thing
+	name  string
+}
+
+// checkLoop Check that the events emitted by a rule with an event trigger
+// do not trigger it again, directly or through other rules, which would
+// fire the rules forever. Callers hold the lock.
+func (e *Engine) checkLoop(rule Rule) error {
+	if !rule.Enabled || rule.Trigger.Type != TriggerEvent {
+		return nil
+	}
+	trigger := event{e.thing(rule.Trigger.Thing), rule.Trigger.Event}
+
+	// Rules triggered by each event, with the rule in place of the one it
+	// replaces.
+	triggered := map[event][]Rule{trigger: {rule}}
+	for id, s := range e.rules {
+		t := &s.rule.Trigger
+		if id != rule.ID && s.rule.Enabled && t.Type == TriggerEvent {
+			key := event{e.thing(t.Thing), t.Event}
+			triggered[key] = append(triggered[key], s.rule)
+		}
+	}
+
+	seen := make(map[event]bool)
+	pending := []event{trigger}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, r := range triggered[current] {
+			for _, effect := range r.Effects {
+				if effect.Type != EffectEmitEvent {
+					continue
+				}
+				emitted := event{e.thing(effect.Thing), effect.Event}
+				if emitted == trigger {
+					return fmt.Errorf("%w: the event %q triggers the rule again", ErrInvalid, trigger.name)
+				}
+				if !seen[emitted] {
+					seen[emitted] = true
+					pending = append(pending, emitted)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// thing Get a thing by id, or the only thing if id is empty.
+func (e *Engine) thing(id string) *webthing.Thing {
+	if id == "" && len(e.things) == 1 {
+		return e.things[0]
+	}
+	return e.byID[id]
+}
+
+// validate Check that a rule refers to existing things and affordances.
+func (e *Engine) validate(rule *Rule) error {
+	if rule.ID == "" {
+		return fmt.Errorf("%w: an id is required", ErrInvalid)
+	}
+	t := &rule.Trigger
+	switch t.Type {
+	case TriggerProperty:
+		if err := e.validateProperty(t.Thing, t.Property); err != nil {
+			return err
+		}
+		if t.Op != "" && !ops[t.Op] {
+			return fmt.Errorf("%w: invalid op %q", ErrInvalid, t.Op)
+		}
+	case TriggerEvent:
+		if err := e.validateAffordance(t.Thing, "events", t.Event); err != nil {
+			return err
+		}
+	case TriggerSchedule:
+		if err := t.validSchedule(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: invalid trigger type %q", ErrInvalid, t.Type)
+	}
+
+	for i := range rule.Conditions {
+		c := &rule.Conditions[i]
+		if c.Op == "" {
+			c.Op = "=="
+		}
+		if !ops[c.Op] {
+			return fmt.Errorf("%w: invalid op %q", ErrInvalid, c.Op)
+		}
+		if err := e.validateProperty(c.Thing, c.Property); err != nil {
+			return err
+		}
+	}
+
+	if len(rule.Effects) == 0 {
+		return fmt.Errorf("%w: an effect is required", ErrInvalid)
+	}
+	for _, effect := range rule.Effects {
+		var err error
+		switch effect.Type {
+		case EffectSetProperty:
+			err = e.validateProperty(effect.Thing, effect.Property)
+		case EffectPerformAction:
+			err = e.validateAffordance(effect.Thing, "actions", effect.Action)
+		case EffectEmitEvent:
+			err = e.validateAffordance(effect.Thing, "events", effect.Event)
+		default:
+			err = fmt.Errorf("%w: invalid effect type %q", ErrInvalid, effect.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Engine) validateProperty(id, name string) error {
+	thing := e.thing(id)
+	if thing == nil {
+		return fmt.Errorf("%w: unknown thing %q", ErrInvalid, id)
+	}
+	if !thing.HasProperty(name) {
+		return fmt.Errorf("%w: unknown property %q", ErrInvalid, name)
+	}
+	return nil
+}
+
+// validateAffordance Check that a thing describes an action or event.
+func (e *Engine) validateAffordance(id, kind, name string) error {
+	thing := e.thing(id)
+	if thing == nil {
+		return fmt.Errorf("%w: unknown thing %q", ErrInvalid, id)
+	}
+	var description struct {
+		Actions map[string]json.RawMessage `json:"actions"`
+		Events  map[string]json.RawMessage `json:"events"`
+	}
+	json.Unmarshal(thing.AsThingDescription(), &description)
+	affordances := description.Events
+	if kind == "actions" {
+		affordances = description.Actions
+	}
+	if _, ok := affordances[name]; !ok {
+		return fmt.Errorf("%w: unknown %s %q", ErrInvalid, kind[:len(kind)-1], name)
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/schedule"
+	"github.com/google/uuid"
+)
+
+// fakeClock A Clock whose time only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) schedule.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
+
+// Advance Move the time forward, firing the timers due in order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		var due *fakeTimer
+		if len(c.timers) > 0 && !c.timers[0].at.After(end) {
+			due = c.timers[0]
+			c.timers = c.timers[1:]
+		}
+		if due == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		if due.at.After(c.now) {
+			c.now = due.at
+		}
+		stopped := due.stopped
+		due.stopped = true
+		c.mu.Unlock()
+		if !stopped {
+			due.f()
+		}
+	}
+}
+
+func newClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)}
+}
+
+// resetAction Record the inputs of the actions performed.
+type resetAction struct {
+	*webthing.Action
+	performed chan json.RawMessage
+}
+
+func (a *resetAction) Generator(thing *webthing.Thing) *webthing.Action {
+	action := &resetAction{performed: a.performed}
+	action.Action = webthing.NewAction(uuid.New().String(), thing, "reset", nil, action.PerformAction, action.Cancel)
+	return action.Action
+}
+
+func (a *resetAction) PerformAction() *webthing.Action {
+	var input json.RawMessage
+	if in := a.Input(); in != nil {
+		input = *in
+	}
+	a.performed <- input
+	return a.Action
+}
+
+func (a *resetAction) Cancel() {}
+
+// fixture A lamp and a sensor with an engine running rules on them.
+type fixture struct {
+	lamp, sensor *webthing.Thing
+	clock        *fakeClock
+	engine       *Engine
+
+	// events Events of the lamp, performed Inputs of the reset actions.
+	events    chan *webthing.Event
+	performed chan json.RawMessage
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{
+		clock:     newClock(),
+		events:    make(chan *webthing.Event, 10),
+		performed: make(chan json.RawMessage, 10),
+	}
+	f.lamp = webthing.NewThing("urn:dev:ops:lamp", "Lamp", nil, "")
+	f.lamp.AddProperty(webthing.NewProperty(f.lamp, "on", webthing.NewValue(false),
+		json.RawMessage(`{"type": "boolean"}`)))
+	f.lamp.AddProperty(webthing.NewProperty(f.lamp, "brightness", webthing.NewValue(0.0),
+		json.RawMessage(`{"type": "number"}`)))
+	f.lamp.AddAvailableEvent("overheated", json.RawMessage(`{"type": "number"}`))
+	f.lamp.AddAvailableEvent("wasted", json.RawMessage(`{"type": "number"}`))
+	f.lamp.AddAvailableAction("reset", json.RawMessage(`{"input": {"type": "integer"}}`),
+		&resetAction{performed: f.performed})
+	f.lamp.OnEvent(func(event *webthing.Event) { f.events <- event })
+
+	f.sensor = webthing.NewThing("urn:dev:ops:sensor", "Sensor", nil, "")
+	f.sensor.AddProperty(webthing.NewProperty(f.sensor, "occupied", webthing.NewValue(false),
+		json.RawMessage(`{"type": "boolean"}`)))
+
+	f.engine = New([]*webthing.Thing{f.lamp, f.sensor}, WithClock(f.clock))
+	t.Cleanup(func() { f.engine.Close() })
+	return f
+}
+
+func (f *fixture) add(t *testing.T, rule string) {
+	t.Helper()
+	var r Rule
+	if err := json.Unmarshal([]byte(rule), &r); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if _, err := f.engine.Add(r); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+}
+
+func set(t *testing.T, thing *webthing.Thing, name string, v interface{}) {
+	t.Helper()
+	value := webthing.NewValue(v)
+	if err := thing.SetProperty(name, &value); err != nil {
+		t.Fatalf("SetProperty: %v", err)
+	}
+}
+
+// eventually Wait for a condition applied by effects running apart.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectEvent Wait for the next event of the lamp.
+func (f *fixture) expectEvent(t *testing.T, name string) *webthing.Event {
+	t.Helper()
+	select {
+	case event := <-f.events:
+		if event.Name() != name {
+			t.Fatalf("Expected the event %s, got %s", name, event.Name())
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the event %s", name)
+	}
+	return nil
+}
+
+// expectNoEvent Check that the lamp raised no event for a while.
+func (f *fixture) expectNoEvent(t *testing.T) {
+	t.Helper()
+	select {
+	case event := <-f.events:
+		t.Fatalf("Unexpected event %s", event.Name())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPropertyTrigger(t *testing.T) {
+	f := newFixture(t)
+	f.add(t, `{
+		"id": "light",
+		"trigger": {"type": "property", "thing": "urn:dev:ops:sensor", "property": "occupied"},
+		"effects": [{"type": "setProperty", "thing": "urn:dev:ops:lamp", "property": "brightness", "value": 60}]
+	}`)
+
+	set(t, f.sensor, "occupied", true)
+	eventually(t, "the brightness", func() bool { return f.lamp.Property("brightness").Get() == 60.0 })
+}
+
+func TestThresholdTrigger(t *testing.T) {
+	f := newFixture(t)
+	f.add(t, `{
+		"id": "bright",
+		"trigger": {"type": "property", "thing": "urn:dev:ops:lamp", "property": "brightness", "op": ">", "value": 80},
+		"effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted", "data": 80}]
+	}`)
+
+	set(t, f.lamp, "brightness", 90.0)
+	if event := f.expectEvent(t, "wasted"); string(event.Data()) != "80" {
+		t.Fatalf("Expected the data of the effect, got %s", event.Data())
+	}
+
+	// The trigger fires when the comparison becomes true, not while it
+	// stays true.
+	set(t, f.lamp, "brightness", 95.0)
+	f.expectNoEvent(t)
+
+	set(t, f.lamp, "brightness", 50.0)
+	set(t, f.lamp, "brightness", 85.0)
+	f.expectEvent(t, "wasted")
+}
+
+func TestForDuration(t *testing.T) {
+	f := newFixture(t)
+	f.add(t, `{
+		"id": "bright",
+		"trigger": {"type": "property", "thing": "urn:dev:ops:lamp", "property": "brightness", "op": ">", "value": 80, "for": "5m"},
+		"effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]
+	}`)
+
+	set(t, f.lamp, "brightness", 90.0)
+	f.clock.Advance(4 * time.Minute)
+	f.expectNoEvent(t)
+
+	// Falling below the threshold stops the duration.
+	set(t, f.lamp, "brightness", 50.0)
+	f.clock.Advance(time.Hour)
+	f.expectNoEvent(t)
+
+	set(t, f.lamp, "brightness", 90.0)
+	f.clock.Advance(5 * time.Minute)
+	f.expectEvent(t, "wasted")
+	f.clock.Advance(time.Hour)
+	f.expectNoEvent(t)
+}
+
+func TestScheduleTrigger(t *testing.T) {
+	f := newFixture(t)
+	f.add(t, `{
+		"id": "hourly",
+		"trigger": {"type": "schedule", "every": "1h"},
+		"effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]
+	}`)
+	f.add(t, `{
+		"id": "morning",
+		"trigger": {"type": "schedule", "at": "07:30", "days": ["thu"]},
+		"effects": [{"type": "setProperty", "thing": "urn:dev:ops:lamp", "property": "on", "value": true}]
+	}`)
+
+	f.clock.Advance(59 * time.Minute)
+	f.expectNoEvent(t)
+	f.clock.Advance(time.Minute)
+	f.expectEvent(t, "wasted")
+	f.clock.Advance(time.Hour)
+	f.expectEvent(t, "wasted")
+
+	// 2024-05-01 is a Wednesday, the morning rule fires on Thursday.
+	if on := f.lamp.Property("on").Get(); on != false {
+		t.Fatal("Expected the lamp to stay off before the morning")
+	}
+	f.engine.Delete("hourly")
+	f.clock.Advance(9*time.Hour + 30*time.Minute)
+	if on := f.lamp.Property("on").Get(); on != true {
+		t.Fatal("Expected the lamp to be on Thursday at 07:30")
+	}
+}
+
+func TestEventTrigger(t *testing.T) {
+	f := newFixture(t)
+	f.add(t, `{
+		"id": "overheat",
+		"trigger": {"type": "event", "thing": "urn:dev:ops:lamp", "event": "overheated"},
+		"effects": [
+			{"type": "setProperty", "thing": "urn:dev:ops:lamp", "property": "on", "value": false},
+			{"type": "performAction", "thing": "urn:dev:ops:lamp", "action": "reset", "input": 3}
+		]
+	}`)
+	set(t, f.lamp, "on", true)
+
+	f.lamp.AddEvent(webthing.NewEvent(f.lamp, "overheated", json.RawMessage(`102`)))
+	f.expectEvent(t, "overheated")
+	select {
+	case input := <-f.performed:
+		if string(input) != "3" {
+			t.Fatalf("Expected the input of the effect, got %s", input)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the action")
+	}
+	if on := f.lamp.Property("on").Get(); on != false {
+		t.Fatal("Expected the lamp to be turned off")
+	}
+}
+
+func TestConditions(t *testing.T) {
+	f := newFixture(t)
+	f.add(t, `{
+		"id": "wasted",
+		"trigger": {"type": "property", "thing": "urn:dev:ops:lamp", "property": "on", "op": "==", "value": true},
+		"conditions": [{"thing": "urn:dev:ops:sensor", "property": "occupied", "value": false}],
+		"effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]
+	}`)
+
+	set(t, f.sensor, "occupied", true)
+	set(t, f.lamp, "on", true)
+	f.expectNoEvent(t)
+
+	set(t, f.lamp, "on", false)
+	set(t, f.sensor, "occupied", false)
+	set(t, f.lamp, "on", true)
+	f.expectEvent(t, "wasted")
+}
+
+func TestDisabled(t *testing.T) {
+	f := newFixture(t)
+	f.add(t, `{
+		"id": "bright",
+		"enabled": false,
+		"trigger": {"type": "property", "thing": "urn:dev:ops:lamp", "property": "brightness"},
+		"effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]
+	}`)
+	set(t, f.lamp, "brightness", 90.0)
+	f.expectNoEvent(t)
+}
+
+func TestInvalid(t *testing.T) {
+	f := newFixture(t)
+	for name, rule := range map[string]string{
+		"trigger type":    `{"id": "r", "trigger": {"type": "sunset"}, "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`,
+		"unknown thing":   `{"id": "r", "trigger": {"type": "property", "thing": "urn:dev:ops:fan", "property": "on"}, "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`,
+		"unknown event":   `{"id": "r", "trigger": {"type": "event", "thing": "urn:dev:ops:lamp", "event": "melted"}, "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`,
+		"op":              `{"id": "r", "trigger": {"type": "property", "thing": "urn:dev:ops:lamp", "property": "on", "op": "~"}, "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`,
+		"schedule":        `{"id": "r", "trigger": {"type": "schedule", "at": "25:00"}, "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`,
+		"no effect":       `{"id": "r", "trigger": {"type": "schedule", "every": "1h"}, "effects": []}`,
+		"unknown action":  `{"id": "r", "trigger": {"type": "schedule", "every": "1h"}, "effects": [{"type": "performAction", "thing": "urn:dev:ops:lamp", "action": "explode"}]}`,
+		"condition thing": `{"id": "r", "trigger": {"type": "schedule", "every": "1h"}, "conditions": [{"thing": "urn:dev:ops:fan", "property": "on", "value": true}], "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`,
+	} {
+		var r Rule
+		if err := json.Unmarshal([]byte(rule), &r); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", name, err)
+		}
+		if _, err := f.engine.Add(r); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestEventLoop(t *testing.T) {
+	f := newFixture(t)
+	self := Rule{
+		ID:      "self",
+		Enabled: true,
+		Trigger: Trigger{Type: TriggerEvent, Thing: "urn:dev:ops:lamp", Event: "overheated"},
+		Effects: []Effect{{Type: EffectEmitEvent, Thing: "urn:dev:ops:lamp", Event: "overheated"}},
+	}
+	if _, err := f.engine.Add(self); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected a rule emitting its own trigger to be invalid, got %v", err)
+	}
+
+	// A loop through two rules is found whichever is added last.
+	forth := Rule{
+		ID:      "forth",
+		Enabled: true,
+		Trigger: Trigger{Type: TriggerEvent, Thing: "urn:dev:ops:lamp", Event: "overheated"},
+		Effects: []Effect{{Type: EffectEmitEvent, Thing: "urn:dev:ops:lamp", Event: "wasted"}},
+	}
+	back := Rule{
+		ID:      "back",
+		Enabled: true,
+		Trigger: Trigger{Type: TriggerEvent, Thing: "urn:dev:ops:lamp", Event: "wasted"},
+		Effects: []Effect{{Type: EffectEmitEvent, Thing: "urn:dev:ops:lamp", Event: "overheated"}},
+	}
+	if _, err := f.engine.Add(forth); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := f.engine.Add(back); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected a loop through two rules to be invalid, got %v", err)
+	}
+	if _, err := f.engine.Put(back); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected Put to reject the loop too, got %v", err)
+	}
+
+	// Replacing a rule breaks the loop it was part of.
+	forth.Effects = []Effect{{Type: EffectSetProperty, Thing: "urn:dev:ops:lamp", Property: "on", Value: false}}
+	if _, err := f.engine.Put(forth); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := f.engine.Add(back); err != nil {
+		t.Fatalf("Expected the rule to be valid without the loop, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f := newFixture(t)
+	err := f.engine.Load([]byte(`[
+		{"id": "b", "trigger": {"type": "schedule", "every": "1h"}, "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]},
+		{"id": "a", "enabled": false, "trigger": {"type": "schedule", "every": "1h"}, "effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}
+	]`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	rules := f.engine.Rules()
+	if len(rules) != 2 || rules[0].ID != "a" || rules[1].ID != "b" {
+		t.Fatalf("Expected the rules a and b, got %+v", rules)
+	}
+	if rules[0].Enabled || !rules[1].Enabled {
+		t.Fatal("Expected rules to be enabled unless disabled")
+	}
+
+	if err := f.engine.Load([]byte(`[{"id": "c", "trigger": {"type": "event"}, "effects": []}]`)); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected an invalid rule to fail the load, got %v", err)
+	}
+	if _, ok := f.engine.Get("c"); ok {
+		t.Fatal("Expected no rule of an invalid load")
+	}
+}
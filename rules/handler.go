@@ -0,0 +1,127 @@
+package rules
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/internal/httpapi"
+)
+
+// Path Path the rules are served at.
+const Path = "/rules"
+
+// Handler Get the handler serving the rules API:
+//
+//	GET    /rules       list the rules
+//	POST   /rules       add a rule
+//	GET    /rules/<id>  get a rule
+//	PUT    /rules/<id>  create or replace a rule
+//	DELETE /rules/<id>  delete a rule
+func (e *Engine) Handler() http.Handler {
+	return e.handler("")
+}
+
+// Mount Serve the rules API with the routes of a thing server.
+//
+// @param server The server
+func (e *Engine) Mount(server *webthing.ThingServer) {
+	prefix := strings.TrimRight(server.BasePath, "/")
+	h := e.handler(prefix)
+	server.Handle(prefix+Path, h)
+	server.Handle(prefix+Path+"/", h)
+}
+
+func (e *Engine) handler(prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		path := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+
+		switch {
+		case path == Path || path == Path+"/":
+			switch r.Method {
+			case http.MethodGet:
+				httpapi.WriteJSON(w, http.StatusOK, e.Rules())
+			case http.MethodPost:
+				e.add(w, r, prefix)
+			default:
+				httpapi.Problem(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		case strings.HasPrefix(path, Path+"/"):
+			id, err := url.PathUnescape(strings.TrimPrefix(path, Path+"/"))
+			if err != nil || id == "" {
+				httpapi.Problem(w, http.StatusBadRequest, "Invalid id")
+				return
+			}
+			e.rule(w, r, id)
+		default:
+			httpapi.Problem(w, http.StatusNotFound, "Not found")
+		}
+	})
+}
+
+// add Add a rule posted to /rules.
+func (e *Engine) add(w http.ResponseWriter, r *http.Request, prefix string) {
+	var rule Rule
+	if !httpapi.Decode(w, r, &rule, "Invalid rule") {
+		return
+	}
+	rule, err := e.Add(rule)
+	switch {
+	case errors.Is(err, ErrExists):
+		httpapi.Problem(w, http.StatusConflict, "Rule already exists")
+		return
+	case err != nil:
+		httpapi.Problem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Location", prefix+Path+"/"+url.PathEscape(rule.ID))
+	httpapi.WriteJSON(w, http.StatusCreated, rule)
+}
+
+// rule Handle a request to /rules/<id>.
+func (e *Engine) rule(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		rule, ok := e.Get(id)
+		if !ok {
+			httpapi.Problem(w, http.StatusNotFound, "Rule not found")
+			return
+		}
+		httpapi.WriteJSON(w, http.StatusOK, rule)
+
+	case http.MethodPut:
+		var rule Rule
+		if !httpapi.Decode(w, r, &rule, "Invalid rule") {
+			return
+		}
+		if rule.ID != "" && rule.ID != id {
+			httpapi.Problem(w, http.StatusBadRequest, "The id of the rule does not match")
+			return
+		}
+		rule.ID = id
+		created, err := e.Put(rule)
+		if err != nil {
+			httpapi.Problem(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if created {
+			rule, _ = e.Get(id)
+			httpapi.WriteJSON(w, http.StatusCreated, rule)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if !e.Delete(id) {
+			httpapi.Problem(w, http.StatusNotFound, "Rule not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpapi.Problem(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,104 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// do Send a request to the handler of an engine.
+func do(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	f := newFixture(t)
+	h := f.engine.Handler()
+	const rule = `{"title": "Hourly", "trigger": {"type": "schedule", "every": "1h"},
+		"effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`
+
+	w := do(t, h, http.MethodPost, "/rules", rule)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d %s", w.Code, w.Body)
+	}
+	var created Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("Expected the rule with a new id, got %s", w.Body)
+	}
+	if location := w.Header().Get("Location"); location != "/rules/"+created.ID {
+		t.Fatalf("Expected the location of the rule, got %s", location)
+	}
+
+	w = do(t, h, http.MethodGet, "/rules/"+created.ID, "")
+	var got Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil || got.Title != "Hourly" {
+		t.Fatalf("Expected the rule, got %d %s", w.Code, w.Body)
+	}
+
+	w = do(t, h, http.MethodPost, "/rules", `{"id": "`+created.ID+`", "trigger": {"type": "schedule", "every": "1h"},
+		"effects": [{"type": "emitEvent", "thing": "urn:dev:ops:lamp", "event": "wasted"}]}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for an existing id, got %d", w.Code)
+	}
+
+	if w := do(t, h, http.MethodPut, "/rules/night", rule); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a rule, got %d %s", w.Code, w.Body)
+	}
+	if w := do(t, h, http.MethodPut, "/rules/night", strings.Replace(rule, "Hourly", "Nightly", 1)); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 replacing a rule, got %d %s", w.Code, w.Body)
+	}
+	if r, _ := f.engine.Get("night"); r.Title != "Nightly" {
+		t.Fatalf("Expected the replaced rule, got %+v", r)
+	}
+	if w := do(t, h, http.MethodPut, "/rules/night", `{"id": "day", "trigger": {"type": "schedule", "every": "1h"}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a mismatched id, got %d", w.Code)
+	}
+
+	w = do(t, h, http.MethodGet, "/rules", "")
+	var rules []Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &rules); w.Code != http.StatusOK || err != nil || len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d %s", w.Code, w.Body)
+	}
+
+	if w := do(t, h, http.MethodDelete, "/rules/night", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 deleting a rule, got %d", w.Code)
+	}
+	if w := do(t, h, http.MethodDelete, "/rules/night", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 deleting a missing rule, got %d", w.Code)
+	}
+	if w := do(t, h, http.MethodGet, "/rules/night", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a missing rule, got %d", w.Code)
+	}
+}
+
+func TestHandlerInvalid(t *testing.T) {
+	f := newFixture(t)
+	h := f.engine.Handler()
+	cases := []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"malformed", http.MethodPost, "/rules", `{"trigger":`, http.StatusBadRequest},
+		{"invalid rule", http.MethodPost, "/rules", `{"trigger": {"type": "sunset"}, "effects": []}`, http.StatusBadRequest},
+		{"invalid put", http.MethodPut, "/rules/r", `{"trigger": {"type": "sunset"}, "effects": []}`, http.StatusBadRequest},
+		{"method", http.MethodPatch, "/rules", "", http.StatusMethodNotAllowed},
+		{"rule method", http.MethodPost, "/rules/r", "", http.StatusMethodNotAllowed},
+		{"path", http.MethodGet, "/other", "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if w := do(t, h, c.method, c.path, c.body); w.Code != c.status {
+				t.Fatalf("Expected %d, got %d %s", c.status, w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Package rules Automate things with rules reacting to property changes,
+// events and schedules, configured as JSON and managed over HTTP.
+//
+// A rule has a trigger, conditions that must all hold when it is triggered
+// and effects that are then applied in order:
+//
+//	{
+//	  "id": "overheat",
+//	  "trigger": {"type": "event", "thing": "urn:dev:lamp", "event": "overheated"},
+//	  "effects": [{"type": "setProperty", "thing": "urn:dev:lamp", "property": "on", "value": false}]
+//	}
+//
+//	{
+//	  "id": "bright",
+//	  "trigger": {"type": "property", "thing": "urn:dev:lamp", "property": "brightness", "op": ">", "value": 80, "for": "5m"},
+//	  "conditions": [{"thing": "urn:dev:sensor", "property": "occupied", "op": "==", "value": false}],
+//	  "effects": [{"type": "emitEvent", "thing": "urn:dev:lamp", "event": "wasted", "data": {"brightness": 80}}]
+//	}
+//
+// Property triggers without an op fire on every change. With an op they
+// fire when the comparison becomes true, and with "for" when it has stayed
+// true that long. Schedule triggers fire "every" interval or daily "at" a
+// local time such as "07:30", optionally only on some "days". The "thing"
+// may be left out when the engine has a single thing. Rules emitting an
+// event that triggers them again, directly or through other rules, are
+// rejected.
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// Trigger types.
+const (
+	TriggerProperty = "property"
+	TriggerEvent    = "event"
+	TriggerSchedule = "schedule"
+)
+
+// Effect types.
+const (
+	EffectSetProperty   = "setProperty"
+	EffectPerformAction = "performAction"
+	EffectEmitEvent     = "emitEvent"
+)
+
+// Errors of rules.
+var (
+	ErrInvalid  = errors.New("rules: invalid rule")
+	ErrExists   = errors.New("rules: rule already exists")
+	ErrNotFound = errors.New("rules: rule not found")
+)
+
+// Rule An automation applying effects when it is triggered and its
+// conditions hold.
+type Rule struct {
+	ID         string      `json:"id"`
+	Title      string      `json:"title,omitempty"`
+	Enabled    bool        `json:"enabled"`
+	Trigger    Trigger     `json:"trigger"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	Effects    []Effect    `json:"effects"`
+}
+
+// Trigger What starts a rule.
+type Trigger struct {
+	// Type One of "property", "event" and "schedule".
+	Type  string `json:"type"`
+	Thing string `json:"thing,omitempty"`
+
+	// Property The property of a property trigger, compared with Value by
+	// Op if given, for at least For.
+	Property string            `json:"property,omitempty"`
+	Op       string            `json:"op,omitempty"`
+	Value    interface{}       `json:"value,omitempty"`
+	For      webthing.Duration `json:"for,omitempty"`
+
+	// Event The event of an event trigger.
+	Event string `json:"event,omitempty"`
+
+	// Every, At, Days When a schedule trigger fires: at an interval, or
+	// daily at a local time "15:04" on the given days, e.g. "mon", or on
+	// every day.
+	Every webthing.Duration `json:"every,omitempty"`
+	At    string            `json:"at,omitempty"`
+	Days  []string          `json:"days,omitempty"`
+}
+
+// Condition A comparison of a property value that must hold for a rule to
+// apply its effects.
+type Condition struct {
+	Thing    string      `json:"thing,omitempty"`
+	Property string      `json:"property"`
+	Op       string      `json:"op,omitempty"`
+	Value    interface{} `json:"value"`
+}
+
+// Effect What a rule does.
+type Effect struct {
+	// Type One of "setProperty", "performAction" and "emitEvent".
+	Type  string `json:"type"`
+	Thing string `json:"thing,omitempty"`
+
+	Property string      `json:"property,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+
+	Action string          `json:"action,omitempty"`
+	Input  json.RawMessage `json:"input,omitempty"`
+
+	Event string          `json:"event,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// UnmarshalJSON Decode a rule, which is enabled unless "enabled" is false.
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type rule Rule
+	v := rule{Enabled: true}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = Rule(v)
+	return nil
+}
+
+// weekdays Days of schedule triggers by their names.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// next Get the time a schedule trigger fires next after now.
+func (t *Trigger) next(now time.Time) time.Time {
+	if t.Every > 0 {
+		return now.Add(time.Duration(t.Every))
+	}
+	at, _ := time.Parse("15:04", t.At)
+	day := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	for i := 0; i < 8; i++ {
+		next := day.AddDate(0, 0, i)
+		if next.After(now) && t.onDay(next.Weekday()) {
+			return next
+		}
+	}
+	return now.AddDate(0, 0, 7)
+}
+
+func (t *Trigger) onDay(day time.Weekday) bool {
+	if len(t.Days) == 0 {
+		return true
+	}
+	for _, name := range t.Days {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// validSchedule Check the schedule of a trigger.
+func (t *Trigger) validSchedule() error {
+	if (t.Every > 0) == (t.At != "") {
+		return fmt.Errorf("%w: a schedule needs either every or at", ErrInvalid)
+	}
+	if t.At != "" {
+		if _, err := time.Parse("15:04", t.At); err != nil {
+			return fmt.Errorf("%w: invalid time %q", ErrInvalid, t.At)
+		}
+	}
+	for _, day := range t.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("%w: invalid day %q", ErrInvalid, day)
+		}
+	}
+	return nil
+}
+
+// ops Supported comparison operators.
+var ops = map[string]bool{"==": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true}
+
+// compare Compare a property value with the value of a trigger or
+// condition. Numbers of any type compare by value, and ordering operators
+// only hold for numbers.
+func compare(value interface{}, op string, operand interface{}) bool {
+	a, aNumber := webthing.Number(value)
+	b, bNumber := webthing.Number(operand)
+	if aNumber && bNumber {
+		switch op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		}
+		return false
+	}
+	switch op {
+	case "==":
+		return reflect.DeepEqual(value, operand)
+	case "!=":
+		return !reflect.DeepEqual(value, operand)
+	}
+	return false
+}
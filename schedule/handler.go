@@ -0,0 +1,123 @@
+package schedule
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/dravenk/webthing-go/internal/httpapi"
+)
+
+// Handler Get the handler serving the schedules at a path:
+//
+//	GET    <path>       list the schedules
+//	POST   <path>       add a schedule
+//	GET    <path>/<id>  get a schedule
+//	PUT    <path>/<id>  create or replace a schedule
+//	DELETE <path>/<id>  delete a schedule
+//
+// @param path The path, e.g. "/schedules"
+func (s *Scheduler) Handler(path string) http.Handler {
+	path = strings.TrimRight(path, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		rest := strings.TrimPrefix(r.URL.EscapedPath(), path)
+
+		switch {
+		case rest == "" || rest == "/":
+			switch r.Method {
+			case http.MethodGet:
+				httpapi.WriteJSON(w, http.StatusOK, s.Schedules())
+			case http.MethodPost:
+				s.add(w, r, path)
+			default:
+				httpapi.Problem(w, http.StatusMethodNotAllowed, "Method not allowed")
+			}
+		case strings.HasPrefix(rest, "/"):
+			id, err := url.PathUnescape(strings.TrimPrefix(rest, "/"))
+			if err != nil || id == "" {
+				httpapi.Problem(w, http.StatusBadRequest, "Invalid id")
+				return
+			}
+			s.schedule(w, r, id)
+		default:
+			httpapi.Problem(w, http.StatusNotFound, "Not found")
+		}
+	})
+}
+
+// Mount Serve the schedules at /schedules below the href of the thing.
+//
+// @param server The server of the thing
+func (s *Scheduler) Mount(server *webthing.ThingServer) {
+	path := strings.TrimRight(s.thing.Href(), "/") + "/schedules"
+	h := s.Handler(path)
+	server.Handle(path, h)
+	server.Handle(path+"/", h)
+}
+
+// add Add a schedule posted to the collection.
+func (s *Scheduler) add(w http.ResponseWriter, r *http.Request, path string) {
+	var schedule Schedule
+	if !httpapi.Decode(w, r, &schedule, "Invalid schedule") {
+		return
+	}
+	schedule, err := s.Add(schedule)
+	switch {
+	case errors.Is(err, ErrExists):
+		httpapi.Problem(w, http.StatusConflict, "Schedule already exists")
+		return
+	case err != nil:
+		httpapi.Problem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Location", path+"/"+url.PathEscape(schedule.ID))
+	httpapi.WriteJSON(w, http.StatusCreated, schedule)
+}
+
+// schedule Handle a request to a schedule.
+func (s *Scheduler) schedule(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		schedule, ok := s.Get(id)
+		if !ok {
+			httpapi.Problem(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		httpapi.WriteJSON(w, http.StatusOK, schedule)
+
+	case http.MethodPut:
+		var schedule Schedule
+		if !httpapi.Decode(w, r, &schedule, "Invalid schedule") {
+			return
+		}
+		if schedule.ID != "" && schedule.ID != id {
+			httpapi.Problem(w, http.StatusBadRequest, "The id of the schedule does not match")
+			return
+		}
+		schedule.ID = id
+		created, err := s.Put(schedule)
+		if err != nil {
+			httpapi.Problem(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		schedule, _ = s.Get(id)
+		if created {
+			httpapi.WriteJSON(w, http.StatusCreated, schedule)
+			return
+		}
+		httpapi.WriteJSON(w, http.StatusOK, schedule)
+
+	case http.MethodDelete:
+		if !s.Delete(id) {
+			httpapi.Problem(w, http.StatusNotFound, "Schedule not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpapi.Problem(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
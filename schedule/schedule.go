@@ -0,0 +1,155 @@
+// Package schedule Schedule property writes and actions of a thing, once at
+// a time, after a delay or repeatedly by a cron expression.
+//
+// Each thing has its own scheduler, managed at /schedules below the href of
+// the thing:
+//
+//	{"at": "2024-05-01T23:00:00+02:00", "property": "on", "value": false}
+//	{"in": "10m", "action": "fade", "input": {"level": 0}}
+//	{"cron": "0 23 * * *", "property": "on", "value": false}
+//
+// Cron expressions have the fields minute, hour, day of month, month and day
+// of week and are evaluated in the location of the clock. One-off schedules
+// are removed once they ran; those missed while the scheduler was stopped
+// run when it starts.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// Errors of schedules.
+var (
+	ErrInvalid  = errors.New("schedule: invalid schedule")
+	ErrExists   = errors.New("schedule: schedule already exists")
+	ErrNotFound = errors.New("schedule: schedule not found")
+)
+
+// Schedule A property write or action request planned for later.
+type Schedule struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+
+	// At, In, Cron When the schedule runs: once at a time, once after a
+	// delay from its creation, which is stored as At, or whenever the cron
+	// expression matches.
+	At   *time.Time        `json:"at,omitempty"`
+	In   webthing.Duration `json:"in,omitempty"`
+	Cron string            `json:"cron,omitempty"`
+
+	// Property, Value The property write of the schedule.
+	Property string      `json:"property,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+
+	// Action, Input The action request of the schedule.
+	Action string          `json:"action,omitempty"`
+	Input  json.RawMessage `json:"input,omitempty"`
+
+	// Next When the schedule runs next. It is set by the scheduler.
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// Clock The source of time of a scheduler, replaced by a fake clock in
+// tests.
+type Clock interface {
+	// Now Get the current time.
+	Now() time.Time
+
+	// AfterFunc Call f in its own goroutine after the duration elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer A timer created by a Clock.
+type Timer interface {
+	// Stop Prevent the timer from firing.
+	Stop() bool
+}
+
+// SystemClock The clock of the time package, used unless another one is
+// given.
+var SystemClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// Store A persistence backend for the schedules of things.
+type Store interface {
+	// Load Load the saved schedules of a thing.
+	//
+	// @param thingID ID of the thing
+	Load(thingID string) ([]Schedule, error)
+
+	// Save Save the schedules of a thing.
+	//
+	// @param thingID   ID of the thing
+	// @param schedules The schedules
+	Save(thingID string, schedules []Schedule) error
+}
+
+// FileStore A Store saving the schedules of each thing in a JSON file of a
+// directory.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore Initialize the store, creating the directory if necessary.
+//
+// @param dir The directory of the files
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Load Load the saved schedules of a thing.
+func (s *FileStore) Load(thingID string) ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := ioutil.ReadFile(s.path(thingID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schedules []Schedule
+	if err := json.Unmarshal(content, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// Save Save the schedules of a thing, replacing the file atomically.
+func (s *FileStore) Save(thingID string, schedules []Schedule) error {
+	content, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := s.path(thingID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(thingID))
+}
+
+func (s *FileStore) path(thingID string) string {
+	return filepath.Join(s.dir, url.QueryEscape(thingID)+".schedules.json")
+}
@@ -0,0 +1,345 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+	"github.com/google/uuid"
+)
+
+// Scheduler Runs the schedules of a thing.
+type Scheduler struct {
+	thing *webthing.Thing
+	clock Clock
+	store Store
+
+	mu        sync.Mutex
+	schedules map[string]*entry
+	closed    bool
+}
+
+// entry A schedule with its timer.
+type entry struct {
+	schedule Schedule
+	cron     *cron
+	next     time.Time
+	timer    Timer
+}
+
+// Option Configure a scheduler.
+type Option func(*Scheduler)
+
+// WithClock Use a clock other than the one of the time package, e.g. a fake
+// clock in tests.
+//
+// @param clock The clock
+func WithClock(clock Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithStore Persist the schedules in a store. The saved schedules are
+// restored by New.
+//
+// @param store The persistence backend
+func WithStore(store Store) Option {
+	return func(s *Scheduler) {
+		s.store = store
+	}
+}
+
+// New Create the scheduler of a thing.
+//
+// @param thing The thing
+func New(thing *webthing.Thing, opts ...Option) (*Scheduler, error) {
+	s := &Scheduler{
+		thing:     thing,
+		clock:     SystemClock,
+		schedules: make(map[string]*entry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.store == nil {
+		return s, nil
+	}
+	saved, err := s.store.Load(thing.ID())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, schedule := range saved {
+		e, err := s.prepare(schedule)
+		if err != nil {
+			s.thing.Logger().Warn("Invalid saved schedule", "thing", thing.ID(), "schedule", schedule.ID, "error", err)
+			continue
+		}
+		s.start(e)
+	}
+	return s, nil
+}
+
+// Thing Get the thing of the scheduler.
+func (s *Scheduler) Thing() *webthing.Thing {
+	return s.thing
+}
+
+// Add Add a schedule. A schedule without id is given a new one.
+//
+// @param schedule The schedule
+// @return The added schedule.
+func (s *Scheduler) Add(schedule Schedule) (Schedule, error) {
+	if schedule.ID == "" {
+		schedule.ID = uuid.New().String()
+	}
+	e, err := s.prepare(schedule)
+	if err != nil {
+		return schedule, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schedules[e.schedule.ID]; ok {
+		return schedule, ErrExists
+	}
+	s.start(e)
+	s.save()
+	return e.view(), nil
+}
+
+// Put Create or replace the schedule with the id of the given schedule.
+//
+// @param schedule The schedule
+// @return Whether the schedule was created.
+func (s *Scheduler) Put(schedule Schedule) (bool, error) {
+	e, err := s.prepare(schedule)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.schedules[e.schedule.ID]
+	if ok {
+		old.stop()
+	}
+	s.start(e)
+	s.save()
+	return !ok, nil
+}
+
+// Get Get the schedule with the given id.
+//
+// @param id The id of the schedule
+func (s *Scheduler) Get(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, false
+	}
+	return e.view(), true
+}
+
+// Delete Delete the schedule with the given id.
+//
+// @param id The id of the schedule
+// @return Whether the schedule existed.
+func (s *Scheduler) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.schedules[id]
+	if ok {
+		e.stop()
+		delete(s.schedules, id)
+		s.save()
+	}
+	return ok
+}
+
+// Schedules Get all schedules ordered by the time they run next.
+func (s *Scheduler) Schedules() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(true)
+}
+
+// Close Stop running the schedules. They are kept in the store.
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, e := range s.schedules {
+		e.stop()
+	}
+	return nil
+}
+
+// prepare Validate a schedule and compute when it runs next.
+func (s *Scheduler) prepare(schedule Schedule) (*entry, error) {
+	if schedule.ID == "" {
+		return nil, fmt.Errorf("%w: an id is required", ErrInvalid)
+	}
+	schedule.Next = nil
+	now := s.clock.Now()
+	e := &entry{}
+
+	when := 0
+	if schedule.At != nil {
+		when++
+	}
+	if schedule.In > 0 {
+		when++
+		at := now.Add(time.Duration(schedule.In))
+		schedule.At, schedule.In = &at, 0
+	}
+	if schedule.Cron != "" {
+		when++
+		c, err := parseCron(schedule.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		e.cron = c
+	}
+	if when != 1 {
+		return nil, fmt.Errorf("%w: one of at, in and cron is required", ErrInvalid)
+	}
+
+	switch {
+	case schedule.Property != "" && schedule.Action == "":
+		if !s.thing.HasProperty(schedule.Property) {
+			return nil, fmt.Errorf("%w: unknown property %q", ErrInvalid, schedule.Property)
+		}
+	case schedule.Action != "" && schedule.Property == "":
+		var description struct {
+			Actions map[string]json.RawMessage `json:"actions"`
+		}
+		json.Unmarshal(s.thing.AsThingDescription(), &description)
+		if _, ok := description.Actions[schedule.Action]; !ok {
+			return nil, fmt.Errorf("%w: unknown action %q", ErrInvalid, schedule.Action)
+		}
+	default:
+		return nil, fmt.Errorf("%w: either a property or an action is required", ErrInvalid)
+	}
+
+	e.schedule = schedule
+	if e.cron != nil {
+		if e.next = e.cron.next(now); e.next.IsZero() {
+			return nil, fmt.Errorf("%w: the cron expression never matches", ErrInvalid)
+		}
+	} else {
+		e.next = *schedule.At
+	}
+	return e, nil
+}
+
+// start Add a schedule and start its timer. Callers hold the lock.
+func (s *Scheduler) start(e *entry) {
+	s.schedules[e.schedule.ID] = e
+	if s.closed {
+		return
+	}
+	var timer Timer
+	timer = s.clock.AfterFunc(e.next.Sub(s.clock.Now()), func() {
+		s.mu.Lock()
+		current := e.timer == timer && s.schedules[e.schedule.ID] == e && !s.closed
+		if current {
+			if e.cron != nil {
+				next := *e
+				next.next = e.cron.next(s.clock.Now())
+				s.start(&next)
+			} else {
+				delete(s.schedules, e.schedule.ID)
+				s.save()
+			}
+		}
+		s.mu.Unlock()
+		if current {
+			s.run(e.schedule)
+		}
+	})
+	e.timer = timer
+}
+
+// stop Stop the timer of a schedule.
+func (e *entry) stop() {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+}
+
+// view Get the schedule with the time it runs next.
+func (e *entry) view() Schedule {
+	schedule := e.schedule
+	next := e.next
+	schedule.Next = &next
+	return schedule
+}
+
+// run Write the property or request the action of a schedule.
+func (s *Scheduler) run(schedule Schedule) {
+	log := s.thing.Logger()
+	if schedule.Property != "" {
+		value := webthing.NewValue(schedule.Value)
+		if err := s.thing.SetProperty(schedule.Property, &value); err != nil {
+			log.Warn("Scheduled property write failure", "thing", s.thing.ID(), "schedule", schedule.ID, "property", schedule.Property, "error", err)
+			return
+		}
+		log.Info("Scheduled property write", "thing", s.thing.ID(), "schedule", schedule.ID, "property", schedule.Property)
+		return
+	}
+
+	var input *json.RawMessage
+	if len(schedule.Input) > 0 {
+		input = &schedule.Input
+	}
+	action, err := s.thing.PerformAction(schedule.Action, input)
+	if err != nil {
+		log.Warn("Scheduled action failure", "thing", s.thing.ID(), "schedule", schedule.ID, "action", schedule.Action, "error", err)
+		return
+	}
+	log.Info("Scheduled action", "thing", s.thing.ID(), "schedule", schedule.ID, "action", schedule.Action)
+	go action.Start()
+}
+
+// list Get the schedules ordered by the time they run next. Callers hold the
+// lock.
+func (s *Scheduler) list(next bool) []Schedule {
+	entries := make([]*entry, 0, len(s.schedules))
+	for _, e := range s.schedules {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].next.Equal(entries[j].next) {
+			return entries[i].next.Before(entries[j].next)
+		}
+		return entries[i].schedule.ID < entries[j].schedule.ID
+	})
+	schedules := make([]Schedule, 0, len(entries))
+	for _, e := range entries {
+		if next {
+			schedules = append(schedules, e.view())
+		} else {
+			schedules = append(schedules, e.schedule)
+		}
+	}
+	return schedules
+}
+
+// save Save the schedules in the store, if any. Callers hold the lock.
+func (s *Scheduler) save() {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Save(s.thing.ID(), s.list(false)); err != nil {
+		s.thing.Logger().Warn("Save schedules failure", "thing", s.thing.ID(), "error", err)
+	}
+}
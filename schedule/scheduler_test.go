@@ -0,0 +1,243 @@
+package schedule
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dravenk/webthing-go"
+)
+
+// fakeClock A Clock whose time only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
+
+// Advance Move the time forward, firing the timers due in order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		var due *fakeTimer
+		for i, t := range c.timers {
+			if !t.at.After(end) {
+				due = t
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			}
+			break
+		}
+		if due == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		if due.at.After(c.now) {
+			c.now = due.at
+		}
+		stopped := due.stopped
+		due.stopped = true
+		c.mu.Unlock()
+		if !stopped {
+			due.f()
+		}
+	}
+}
+
+func newThing() *webthing.Thing {
+	thing := webthing.NewThing("urn:dev:ops:schedule", "Schedule", nil, "")
+	thing.AddProperty(webthing.NewProperty(thing, "level", webthing.NewValue(0.0),
+		json.RawMessage(`{"type": "number"}`)))
+	return thing
+}
+
+func newClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)}
+}
+
+func level(thing *webthing.Thing) interface{} {
+	return thing.Property("level").Get()
+}
+
+func setLevel(t *testing.T, thing *webthing.Thing, v float64) {
+	value := webthing.NewValue(v)
+	if err := thing.SetProperty("level", &value); err != nil {
+		t.Fatalf("SetProperty: %v", err)
+	}
+}
+
+func TestAt(t *testing.T) {
+	clock := newClock()
+	thing := newThing()
+	s, err := New(thing, WithClock(clock))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	at := clock.Now().Add(time.Hour)
+	if _, err := s.Add(Schedule{ID: "at", At: &at, Property: "level", Value: 5.0}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if v := level(thing); v != 0.0 {
+		t.Fatalf("Expected the schedule not to run yet, level is %v", v)
+	}
+	clock.Advance(time.Minute)
+	if v := level(thing); v != 5.0 {
+		t.Fatalf("Expected level 5, got %v", v)
+	}
+	if _, ok := s.Get("at"); ok {
+		t.Fatal("Expected the one-off schedule to be removed once it ran")
+	}
+}
+
+func TestIn(t *testing.T) {
+	clock := newClock()
+	thing := newThing()
+	s, err := New(thing, WithClock(clock))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	schedule, err := s.Add(Schedule{In: webthing.Duration(10 * time.Minute), Property: "level", Value: 3.0})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if schedule.ID == "" {
+		t.Fatal("Expected the schedule to be given an id")
+	}
+	if want := clock.Now().Add(10 * time.Minute); schedule.At == nil || !schedule.At.Equal(want) || !schedule.Next.Equal(want) {
+		t.Fatalf("Expected the schedule to run at %v, got at %v next %v", want, schedule.At, schedule.Next)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if v := level(thing); v != 3.0 {
+		t.Fatalf("Expected level 3, got %v", v)
+	}
+}
+
+func TestCron(t *testing.T) {
+	clock := newClock()
+	thing := newThing()
+	s, err := New(thing, WithClock(clock))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := s.Add(Schedule{ID: "nightly", Cron: "0 23 * * *", Property: "level", Value: 1.0}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for day := 1; day <= 2; day++ {
+		setLevel(t, thing, 0)
+		clock.Advance(time.Hour)
+		if v := level(thing); v != 1.0 {
+			t.Fatalf("Expected the schedule to run on day %d, level is %v", day, v)
+		}
+		schedule, ok := s.Get("nightly")
+		if !ok {
+			t.Fatal("Expected the cron schedule to be kept")
+		}
+		if want := time.Date(2024, 5, day+1, 23, 0, 0, 0, time.UTC); !schedule.Next.Equal(want) {
+			t.Fatalf("Expected the next run at %v, got %v", want, schedule.Next)
+		}
+		clock.Advance(23 * time.Hour)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	clock := newClock()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	s, err := New(newThing(), WithClock(clock), WithStore(store))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	at := clock.Now().Add(time.Hour)
+	if _, err := s.Add(Schedule{ID: "once", At: &at, Property: "level", Value: 2.0}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := s.Add(Schedule{ID: "nightly", Cron: "0 23 * * *", Property: "level", Value: 1.0}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	s.Close()
+
+	// The one-off schedule is missed while no scheduler runs.
+	clock.Advance(2 * time.Hour)
+	thing := newThing()
+	s, err = New(thing, WithClock(clock), WithStore(store))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if n := len(s.Schedules()); n != 2 {
+		t.Fatalf("Expected 2 restored schedules, got %d", n)
+	}
+	clock.Advance(0)
+	if v := level(thing); v != 2.0 {
+		t.Fatalf("Expected the missed schedule to run, level is %v", v)
+	}
+
+	saved, err := store.Load(thing.ID())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(saved) != 1 || saved[0].ID != "nightly" {
+		t.Fatalf("Expected only the cron schedule to be saved, got %v", saved)
+	}
+	schedule, _ := s.Get("nightly")
+	if want := time.Date(2024, 5, 2, 23, 0, 0, 0, time.UTC); !schedule.Next.Equal(want) {
+		t.Fatalf("Expected the next run at %v, got %v", want, schedule.Next)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	s, err := New(newThing(), WithClock(newClock()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, schedule := range []Schedule{
+		{Property: "level", Value: 1.0},
+		{Cron: "0 25 * * *", Property: "level", Value: 1.0},
+		{Cron: "0 23 * * *", Property: "missing", Value: 1.0},
+		{Cron: "0 23 * * *", Action: "missing"},
+	} {
+		if _, err := s.Add(schedule); err == nil {
+			t.Fatalf("Expected %+v to be invalid", schedule)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package webthing
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ThingServer Web Thing Server.
@@ -15,19 +20,61 @@ type ThingServer struct {
 	Things   []*Thing
 	Name     string
 	BasePath string
+
+	// ActionPolicy What Shutdown does with running actions.
+	ActionPolicy ActionPolicy
+
+	// CheckOrigin Whether to accept a WebSocket connection from the Origin of
+	// a request. If nil, only requests without an Origin header or from the
+	// host of the request are accepted.
+	CheckOrigin func(r *http.Request) bool
+
+	middlewares    []Middleware
+	middlewaresMu  sync.RWMutex
+	logger         Logger
+	tracerProvider trace.TracerProvider
+	shutdownHooks  []func(context.Context) error
+	shutdownMu     sync.Mutex
+	shuttingDown   int32
 }
 
+// serverKey Key of the server serving a request in its context.
+type serverKey struct{}
+
+// Middleware Wrap the handler of a route.
+//
+// @param route   Pattern the handler is registered for
+// @param handler Handler of the route
+// @return The handler to use instead.
+type Middleware func(route string, handler http.Handler) http.Handler
+
 // NewWebThingServer Initialize the WebThingServer.
 //
 // @param thingType        List of Things managed by this server
 // @param basePath         Base URL path to use, rather than '/'
-//
 func NewWebThingServer(thingType ThingsType, httpServer *http.Server, basePath string) *ThingServer {
-	server := &ThingServer{httpServer, thingType.Things(), thingType.Name(), basePath}
+	server := &ThingServer{
+		Server:   httpServer,
+		Things:   thingType.Things(),
+		Name:     thingType.Name(),
+		BasePath: basePath,
+	}
 	thingsNum := len(server.Things)
 
-	thingsHandle := &ThingsHandle{server.Things, basePath}
-	http.HandleFunc("/", thingsHandle.Handle)
+	thingsHandle := &ThingsHandle{Things: server.Things, basePath: basePath, server: server}
+	server.HandleFunc("/", thingsHandle.Handle)
+
+	healthHandle := &HealthHandle{server}
+	healthPath := strings.TrimRight(basePath, "/") + "/health"
+	server.HandleFunc(healthPath, healthHandle.Handle)
+	server.HandleFunc(healthPath+"/live", healthHandle.Handle)
+	server.HandleFunc(healthPath+"/ready", healthHandle.Handle)
+
+	openAPIHandle := &OpenAPIHandle{server}
+	server.HandleFunc(strings.TrimRight(basePath, "/")+OpenAPIPath, openAPIHandle.Handle)
+
+	asyncAPIHandle := &AsyncAPIHandle{server}
+	server.HandleFunc(strings.TrimRight(basePath, "/")+AsyncAPIPath, asyncAPIHandle.Handle)
 
 	if thingsNum == 1 {
 		thing := server.Things[0]
@@ -39,7 +86,7 @@ func NewWebThingServer(thingType ThingsType, httpServer *http.Server, basePath s
 		actionsHandle := &ActionsHandle{thingHandle}
 		eventsHandle := &EventsHandle{thingHandle}
 
-		handlerfuncs(prePath, preIdx, thingHandle, propertiesHandle, actionsHandle, eventsHandle)
+		server.handlerfuncs(prePath, preIdx, thingHandle, propertiesHandle, actionsHandle, eventsHandle)
 		return server
 	}
 
@@ -52,39 +99,77 @@ func NewWebThingServer(thingType ThingsType, httpServer *http.Server, basePath s
 		actionsHandle := &ActionsHandle{thingHandle}
 		eventsHandle := &EventsHandle{thingHandle}
 
-		handlerfuncs(prePath, preIdx, thingHandle, propertiesHandle, actionsHandle, eventsHandle)
+		server.handlerfuncs(prePath, preIdx, thingHandle, propertiesHandle, actionsHandle, eventsHandle)
 	}
 
 	return server
 }
 
-func handlerfuncs(prePath, preIdx string,
+func (server *ThingServer) handlerfuncs(prePath, preIdx string,
 	thingHandle *ThingHandle,
 	propertiesHandle *PropertiesHandle,
 	actionsHandle *ActionsHandle,
 	eventsHandle *EventsHandle,
 ) {
 
-	http.HandleFunc(prePath, thingHandle.Handle)
-	http.HandleFunc(prePath+"/properties", propertiesHandle.Handle)
-	http.HandleFunc(prePath+"/properties/", propertiesHandle.Handle)
-	http.HandleFunc(prePath+"/actions", actionsHandle.Handle)
-	http.HandleFunc(prePath+"/actions/", actionsHandle.Handle)
-	http.HandleFunc(prePath+"/events", eventsHandle.Handle)
-	http.HandleFunc(prePath+"/events/", eventsHandle.Handle)
-
-	http.HandleFunc(preIdx+"/properties", propertiesHandle.Handle)
-	http.HandleFunc(preIdx+"/properties/", propertiesHandle.Handle)
-	http.HandleFunc(preIdx+"/actions", actionsHandle.Handle)
-	http.HandleFunc(preIdx+"/actions/", actionsHandle.Handle)
-	http.HandleFunc(preIdx+"/events", eventsHandle.Handle)
-	http.HandleFunc(preIdx+"/events/", eventsHandle.Handle)
+	server.HandleFunc(prePath, thingHandle.Handle)
+	server.HandleFunc(prePath+"/properties", propertiesHandle.Handle)
+	server.HandleFunc(prePath+"/properties/", propertiesHandle.Handle)
+	server.HandleFunc(prePath+"/actions", actionsHandle.Handle)
+	server.HandleFunc(prePath+"/actions/", actionsHandle.Handle)
+	server.HandleFunc(prePath+"/events", eventsHandle.Handle)
+	server.HandleFunc(prePath+"/events/", eventsHandle.Handle)
+
+	server.HandleFunc(preIdx+"/properties", propertiesHandle.Handle)
+	server.HandleFunc(preIdx+"/properties/", propertiesHandle.Handle)
+	server.HandleFunc(preIdx+"/actions", actionsHandle.Handle)
+	server.HandleFunc(preIdx+"/actions/", actionsHandle.Handle)
+	server.HandleFunc(preIdx+"/events", eventsHandle.Handle)
+	server.HandleFunc(preIdx+"/events/", eventsHandle.Handle)
 
 	if preIdx != "" {
-		http.HandleFunc(preIdx, thingHandle.Handle)
+		server.HandleFunc(preIdx, thingHandle.Handle)
 	}
 }
 
+// Use Add a middleware wrapping the handlers of all routes of this server.
+//
+// Middlewares added later wrap the ones added before.
+//
+// @param middleware The middleware
+func (server *ThingServer) Use(middleware Middleware) {
+	server.middlewaresMu.Lock()
+	defer server.middlewaresMu.Unlock()
+	server.middlewares = append(server.middlewares, middleware)
+}
+
+// Handle Register the handler for a route of this server.
+//
+// @param pattern Pattern of the route
+// @param handler Handler of the route
+func (server *ThingServer) Handle(pattern string, handler http.Handler) {
+	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		r = r.WithContext(context.WithValue(r.Context(), serverKey{}, server))
+
+		server.middlewaresMu.RLock()
+		h := handler
+		for _, middleware := range server.middlewares {
+			h = middleware(pattern, h)
+		}
+		server.middlewaresMu.RUnlock()
+		server.traceRequest(pattern, h, w, r)
+	})
+}
+
+// HandleFunc Register the handler function for a route of this server.
+//
+// @param pattern Pattern of the route
+// @param handler Handler of the route
+func (server *ThingServer) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	server.Handle(pattern, http.HandlerFunc(handler))
+}
+
 // Start Start listening for incoming connections.
 //
 // @return Error on failure to listen on port
@@ -92,7 +177,8 @@ func (server *ThingServer) Start() error {
 	return server.ListenAndServe()
 }
 
-// Stop Stop listening.
+// Stop Stop listening immediately, dropping active requests. See Shutdown
+// for a graceful stop.
 func (server *ThingServer) Stop() error {
 	return server.Close()
 }
@@ -208,10 +294,27 @@ type DeleteInterface interface {
 }
 
 // BaseHandle Base handler that is initialized with a list of things.
+// Request bodies in CBOR or MessagePack are converted to JSON, and responses
+// are converted to the media type negotiated from the Accept header.
 // func BaseHandle(h BaseHandler, w http.ResponseWriter, r *http.Request) {
 func BaseHandle(h interface{}, w http.ResponseWriter, r *http.Request) {
 	corsResponse(w)
 	jsonResponse(w)
+	w.Header().Add("Vary", "Accept")
+	switch err := decodeRequest(r); {
+	case errors.Is(err, errMediaType):
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if mediaType := negotiate(r.Header.Get("Accept")); mediaType != MediaTypeJSON {
+		ew := &encodingWriter{ResponseWriter: w, mediaType: mediaType}
+		defer ew.flush()
+		w = ew
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		if base, ok := h.(GetInterface); ok {
@@ -248,6 +351,7 @@ func BaseHandle(h interface{}, w http.ResponseWriter, r *http.Request) {
 type ThingsHandle struct {
 	Things   []*Thing
 	basePath string
+	server   *ThingServer
 }
 
 // Handle handle request.
@@ -274,7 +378,7 @@ func (h *ThingsHandle) Get(w http.ResponseWriter, r *http.Request) {
 	content, _ := json.Marshal(things)
 
 	if _, err := w.Write(content); err != nil {
-		fmt.Println(err)
+		h.server.Logger().Error("Write response failure", "request", RequestID(r), "error", err)
 	}
 }
 
@@ -285,6 +389,11 @@ type ThingHandle struct {
 
 // Handle a request to /thing.
 func (h *ThingHandle) Handle(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		wsHandle := &WebSocketThingHandle{ThingHandle: h}
+		wsHandle.Handle(w, r)
+		return
+	}
 	BaseHandle(h, w, r)
 }
 
@@ -305,11 +414,11 @@ func (h *ThingHandle) Get(w http.ResponseWriter, r *http.Request) {
 	wsHref := fmt.Sprintf("%s://%s%s", scheme, r.Host, h.Href())
 	ls["links"] = append(ls["links"], Link{
 		Rel:  "alternate",
-		Href: filepath.Clean(strings.TrimRight(wsHref+"/"+h.Href(), "/")),
+		Href: strings.TrimRight(wsHref, "/"),
 	})
 	var desc map[string]interface{}
 	if err := json.Unmarshal(base, &desc); err != nil {
-		fmt.Print(err)
+		h.Thing.requestLog(r).Error("Decode thing description failure", "error", err)
 	}
 	desc["links"] = ls["links"]
 
@@ -325,7 +434,7 @@ func (h *ThingHandle) Get(w http.ResponseWriter, r *http.Request) {
 
 	re, _ := json.Marshal(desc)
 	if _, err := w.Write(re); err != nil {
-		fmt.Println(err)
+		h.Thing.requestLog(r).Error("Write response failure", "error", err)
 	}
 }
 
@@ -336,8 +445,14 @@ type PropertiesHandle struct {
 
 // Handle Handle a request to /properties.
 func (h *PropertiesHandle) Handle(w http.ResponseWriter, r *http.Request) {
+	if historyPath.MatchString(r.URL.Path) {
+		historyHandle := &HistoryHandle{PropertiesHandle: h}
+		historyHandle.Handle(w, r)
+		return
+	}
 	if name, err := resource(trimSlash(r.RequestURI)); err == nil {
-		propertyHandle := &PropertyHandle{h, h.properties[name]}
+		property, _ := h.FindProperty(name)
+		propertyHandle := &PropertyHandle{h, property}
 		propertyHandle.Handle(w, r)
 		return
 	}
@@ -352,9 +467,9 @@ func (h *PropertiesHandle) Handle(w http.ResponseWriter, r *http.Request) {
 func (h *PropertiesHandle) Get(w http.ResponseWriter, r *http.Request) {
 	content, err := json.Marshal(h.Thing.Properties())
 	if err != nil {
-		fmt.Println(err)
+		h.Thing.requestLog(r).Error("Encode properties failure", "error", err)
 	}
 	if _, err := w.Write(content); err != nil {
-		fmt.Println(err)
+		h.Thing.requestLog(r).Error("Write response failure", "error", err)
 	}
 }
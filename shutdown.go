@@ -0,0 +1,164 @@
+package webthing
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ActionPolicy What Shutdown does with actions that are still running.
+type ActionPolicy int
+
+const (
+	// WaitForActions Wait for running actions to finish. Actions still
+	// running when the shutdown context is done are cancelled.
+	WaitForActions ActionPolicy = iota
+
+	// CancelActions Cancel running actions immediately.
+	CancelActions
+)
+
+// closeTimeout Time allowed for writing the close frame to a subscriber.
+const closeTimeout = time.Second
+
+// OnShutdown Register a function called first when the server shuts down,
+// e.g. to withdraw the mDNS advertisement of the things.
+//
+// @param hook Function called with the context of the shutdown
+func (server *ThingServer) OnShutdown(hook func(ctx context.Context) error) {
+	server.shutdownMu.Lock()
+	defer server.shutdownMu.Unlock()
+	server.shutdownHooks = append(server.shutdownHooks, hook)
+}
+
+// Shutdown Shut the server down gracefully.
+//
+// Shutdown reports the server as not ready at /health/ready, runs the hooks
+// registered with OnShutdown, stops accepting requests and waits for the
+// active ones, closes websocket subscribers with a going-away close frame,
+// cancels or waits for running actions according to server.ActionPolicy and
+// finally saves the state of all things.
+//
+// @param ctx Context limiting the time to wait
+// @return The first error, or the error of ctx if it is done before the
+// shutdown completed.
+func (server *ThingServer) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&server.shuttingDown, 1)
+
+	var firstErr error
+	check := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	server.shutdownMu.Lock()
+	hooks := server.shutdownHooks
+	server.shutdownMu.Unlock()
+	for _, hook := range hooks {
+		check(hook(ctx))
+	}
+
+	if server.Server != nil {
+		check(server.Server.Shutdown(ctx))
+	}
+
+	for _, thing := range server.Things {
+		thing.closeSubscribers(websocket.CloseGoingAway, "Server shutting down")
+	}
+
+	for _, thing := range server.Things {
+		if server.ActionPolicy == CancelActions {
+			thing.cancelActions()
+		}
+	}
+	for _, thing := range server.Things {
+		if err := thing.waitActions(ctx); err != nil {
+			thing.cancelActions()
+			check(err)
+		}
+	}
+
+	for _, thing := range server.Things {
+		if err := thing.SaveState(); err != nil {
+			thing.log().Error("Save thing state failure", "error", err)
+			check(err)
+		}
+	}
+	return firstErr
+}
+
+// closeSubscribers Close all websocket subscribers with a close frame.
+func (thing *Thing) closeSubscribers(code int, text string) {
+	thing.subscribersMu.Lock()
+	defer thing.subscribersMu.Unlock()
+
+	message := websocket.FormatCloseMessage(code, text)
+	for _, ws := range thing.subscribers {
+		ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+		// Closing the connection ends the read loop of its handler, which
+		// removes the subscriber.
+		ws.Close()
+	}
+}
+
+// actionStarted Track an action being performed, from its creation, so
+// that Shutdown also waits for actions that are not started yet.
+func (thing *Thing) actionStarted(action *Action) {
+	thing.runningMu.Lock()
+	defer thing.runningMu.Unlock()
+	if thing.running == nil {
+		thing.running = make(map[*Action]struct{})
+	}
+	thing.running[action] = struct{}{}
+}
+
+// actionStopped Stop tracking an action being performed.
+func (thing *Thing) actionStopped(action *Action) {
+	thing.runningMu.Lock()
+	defer thing.runningMu.Unlock()
+	delete(thing.running, action)
+	if len(thing.running) == 0 && thing.runningDone != nil {
+		close(thing.runningDone)
+		thing.runningDone = nil
+	}
+}
+
+// cancelActions Cancel all actions being performed. They finish with the
+// status "cancelled".
+func (thing *Thing) cancelActions() {
+	thing.runningMu.Lock()
+	var actions []*Action
+	for action := range thing.running {
+		actions = append(actions, action)
+	}
+	thing.runningMu.Unlock()
+
+	for _, action := range actions {
+		action.cancel()
+	}
+}
+
+// waitActions Wait until no action is performed any more.
+func (thing *Thing) waitActions(ctx context.Context) error {
+	for {
+		thing.runningMu.Lock()
+		if len(thing.running) == 0 {
+			thing.runningMu.Unlock()
+			return nil
+		}
+		if thing.runningDone == nil {
+			thing.runningDone = make(chan struct{})
+		}
+		done := thing.runningDone
+		thing.runningMu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package webthing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// countAction Count the actions performed.
+type countAction struct {
+	*Action
+	performed chan struct{}
+}
+
+func (a *countAction) Generator(thing *Thing) *Action {
+	action := &countAction{performed: a.performed}
+	action.Action = NewAction(uuid.New().String(), thing, "count", nil, action.PerformAction, action.Cancel)
+	return action.Action
+}
+
+func (a *countAction) PerformAction() *Action {
+	a.performed <- struct{}{}
+	return a.Action
+}
+
+func (a *countAction) Cancel() {}
+
+func TestShutdownWaitsForCreatedActions(t *testing.T) {
+	thing := NewThing("urn:dev:ops:shutdown", "Shutdown", nil, "")
+	performed := make(chan struct{}, 1)
+	thing.AddAvailableAction("count", nil, &countAction{performed: performed})
+	server := &ThingServer{Things: []*Thing{thing}}
+
+	// The action is created by a request and started by a goroutine that
+	// only runs once the shutdown began.
+	action, err := thing.PerformAction("count", nil)
+	if err != nil {
+		t.Fatalf("PerformAction: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		action.Start()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if status := action.Status(); status != "completed" {
+		t.Fatalf("Expected the action to be completed, got %s", status)
+	}
+	<-performed
+}
+
+func TestShutdownCancelsCreatedActions(t *testing.T) {
+	thing := NewThing("urn:dev:ops:shutdown", "Shutdown", nil, "")
+	performed := make(chan struct{}, 1)
+	thing.AddAvailableAction("count", nil, &countAction{performed: performed})
+	server := &ThingServer{Things: []*Thing{thing}, ActionPolicy: CancelActions}
+
+	action, err := thing.PerformAction("count", nil)
+	if err != nil {
+		t.Fatalf("PerformAction: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		action.Start()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if status := action.Status(); status != "cancelled" {
+		t.Fatalf("Expected the action to be cancelled, got %s", status)
+	}
+	select {
+	case <-performed:
+		t.Fatal("Expected the cancelled action not to be performed")
+	default:
+	}
+}
@@ -1,14 +1,20 @@
 package webthing
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/xeipuuv/gojsonschema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Thing A Web Thing struct.
@@ -19,13 +25,45 @@ type Thing struct {
 	title            string
 	description      string
 	properties       map[string]*Property
+	propertiesMu     sync.RWMutex
 	availableActions map[string]*AvailableAction
 	availableEvents  map[string]*AvailableEvent
 	actions          map[string][]*Action
 	events           []*Event
+	historyMu        sync.RWMutex
 	subscribers      map[string]*websocket.Conn
+	subscribersMu    sync.Mutex
 	hrefPrefix       string
 	uiHref           string
+	store            Store
+	state            *ThingState
+	persistMu        sync.Mutex
+	persistTimer     *time.Timer
+	hooks            hooks
+	hooksMu          sync.RWMutex
+	logger           Logger
+	tracerProvider   trace.TracerProvider
+	running          map[*Action]struct{}
+	runningDone      chan struct{}
+	runningMu        sync.Mutex
+	connectivity     Connectivity
+	connectivityMu   sync.RWMutex
+	forms            map[string][]Form
+	formsMu          sync.RWMutex
+}
+
+// maxEvents The number of events kept in the history of a thing, and saved
+// with its state. Older events are dropped.
+const maxEvents = 1000
+
+// hooks Functions observing the changes of a thing. They are called after
+// releasing hooksMu, as they may add hooks or cause other changes of the
+// thing, e.g. an alarm adding an event.
+type hooks struct {
+	property []func(*Property)
+	action   []func(*Action)
+	event    []func(*Event)
+	notify   []func(*Property)
 }
 
 // ThingMember thingmember
@@ -39,6 +77,9 @@ type ThingMember struct {
 	Actions     map[string]json.RawMessage `json:"actions,omitempty"`
 	Events      map[string]json.RawMessage `json:"events,omitempty"`
 	Links       []Link                     `json:"links"`
+
+	// Connectivity The connectivity of the device behind the thing.
+	Connectivity *Connectivity `json:"connectivity,omitempty"`
 }
 
 func NewThingMember(thing *Thing) *ThingMember {
@@ -52,6 +93,8 @@ func NewThingMember(thing *Thing) *ThingMember {
 		Actions:     make(map[string]json.RawMessage),
 		Events:      make(map[string]json.RawMessage),
 	}
+	connectivity := thing.Connectivity()
+	th.Connectivity = &connectivity
 	return th
 }
 
@@ -81,6 +124,35 @@ type Link struct {
 	MediaType string `json:"mediaType,omitempty"`
 }
 
+// Form A form of an interaction affordance, describing how to interact with
+// it through a protocol binding, e.g.
+// {"href": "mqtt://broker/things/lamp/actions/fade", "op": "invokeaction"}.
+type Form map[string]interface{}
+
+// AddForm Add a form to an interaction affordance of this thing.
+//
+// @param kind Kind of the affordance: "properties", "actions" or "events"
+// @param name Name of the affordance
+// @param form The form
+func (thing *Thing) AddForm(kind, name string, form Form) {
+	thing.formsMu.Lock()
+	defer thing.formsMu.Unlock()
+	if thing.forms == nil {
+		thing.forms = make(map[string][]Form)
+	}
+	thing.forms[kind+"/"+name] = append(thing.forms[kind+"/"+name], form)
+}
+
+// Forms Get the forms added to an interaction affordance of this thing.
+//
+// @param kind Kind of the affordance: "properties", "actions" or "events"
+// @param name Name of the affordance
+func (thing *Thing) Forms(kind, name string) []Form {
+	thing.formsMu.RLock()
+	defer thing.formsMu.RUnlock()
+	return thing.forms[kind+"/"+name]
+}
+
 func (th *ThingMember) availableActionsDesc(thing *Thing) {
 	for name := range thing.availableActions {
 		meta := thing.availableActions[name].Metadata()
@@ -90,6 +162,9 @@ func (th *ThingMember) availableActionsDesc(thing *Thing) {
 			Rel:  "action",
 			Href: filepath.Clean(fmt.Sprintf("/%s/actions/%s", thing.Href(), name)),
 		}}
+		if forms := thing.Forms("actions", name); len(forms) > 0 {
+			m["forms"] = forms
+		}
 		obj, _ := json.Marshal(m)
 		th.Actions[name] = obj
 	}
@@ -104,6 +179,9 @@ func (th *ThingMember) availableEventsDesc(thing *Thing) {
 			Rel:  "events",
 			Href: filepath.Clean(fmt.Sprintf("/%s/events/%s", thing.Href(), name)),
 		}}
+		if forms := thing.Forms("events", name); len(forms) > 0 {
+			m["forms"] = forms
+		}
 		obj, _ := json.Marshal(m)
 		th.Events[name] = obj
 	}
@@ -140,7 +218,7 @@ func (thing *Thing) AsThingDescription() []byte {
 
 	thingDescription, err := json.Marshal(th)
 	if err != nil {
-		fmt.Println(err.Error())
+		thing.log().Error("Encode thing description failure", "error", err)
 	}
 
 	return thingDescription
@@ -169,8 +247,8 @@ func (thing *Thing) UIHref() string {
 // @param {String} prefix The prefix
 func (thing *Thing) SetHrefPrefix(prefix string) {
 	thing.hrefPrefix = prefix
-	for name := range thing.properties {
-		thing.properties[name].SetHrefPrefix(prefix)
+	for _, property := range thing.propertyList() {
+		property.SetHrefPrefix(prefix)
 	}
 	for name := range thing.actions {
 		for key := range thing.actions[name] {
@@ -226,8 +304,16 @@ func (thing *Thing) Description() string {
 // @returns {Object} Properties, i.e. name -> description
 func (thing *Thing) PropertyDescriptions() string {
 	descriptions := make(map[string]json.RawMessage)
-	for name, property := range thing.properties {
+	for _, property := range thing.propertyList() {
+		name := property.Name()
 		descriptions[name] = []byte(property.AsPropertyDescription())
+		if forms := thing.Forms("properties", name); len(forms) > 0 {
+			var m map[string]interface{}
+			if err := json.Unmarshal(descriptions[name], &m); err == nil && m != nil {
+				m["forms"] = forms
+				descriptions[name], _ = json.Marshal(m)
+			}
+		}
 	}
 
 	str, _ := json.Marshal(descriptions)
@@ -239,6 +325,9 @@ func (thing *Thing) PropertyDescriptions() string {
 // @param {String?} actionName Optional action name to get descriptions for
 // @returns {Object} Action descriptions.
 func (thing *Thing) ActionDescriptions(actionName string) (descriptions []json.RawMessage) {
+	thing.historyMu.RLock()
+	defer thing.historyMu.RUnlock()
+
 	if actionName != "" {
 		return actionsDescription(thing, descriptions, actionName)
 	}
@@ -267,6 +356,9 @@ func actionsDescription(thing *Thing, descriptions []json.RawMessage, actionName
 //
 //@returns {Object} Event descriptions.
 func (thing *Thing) EventDescriptions(eventName string) []byte {
+	thing.historyMu.RLock()
+	defer thing.historyMu.RUnlock()
+
 	var descriptions []json.RawMessage
 	if len(thing.events) == 0 {
 		return []byte(`{}`)
@@ -286,16 +378,42 @@ func (thing *Thing) EventDescriptions(eventName string) []byte {
 // @param property Property to add.
 func (thing *Thing) AddProperty(property *Property) {
 	property.SetHrefPrefix(thing.hrefPrefix)
+	thing.propertiesMu.Lock()
 	thing.properties[property.Name()] = property
+	thing.propertiesMu.Unlock()
+	thing.restoreProperty(property)
 }
 
 // RemoveProperty Remove a property from this thing.
 //
 // @param property Property to remove.
 func (thing *Thing) RemoveProperty(property Property) {
-	if p, ok := thing.properties[property.Name()]; ok {
-		delete(thing.properties, p.Name())
+	thing.propertiesMu.Lock()
+	defer thing.propertiesMu.Unlock()
+	delete(thing.properties, property.Name())
+}
+
+// FindProperty Find a property by name, e.g. as an input of a computed
+// property.
+//
+// @param propertyName Name of the property to find
+// @return The property and whether it was found.
+func (thing *Thing) FindProperty(propertyName string) (*Property, bool) {
+	thing.propertiesMu.RLock()
+	defer thing.propertiesMu.RUnlock()
+	p, ok := thing.properties[propertyName]
+	return p, ok
+}
+
+// propertyList Get the properties of this thing.
+func (thing *Thing) propertyList() []*Property {
+	thing.propertiesMu.RLock()
+	defer thing.propertiesMu.RUnlock()
+	properties := make([]*Property, 0, len(thing.properties))
+	for _, property := range thing.properties {
+		properties = append(properties, property)
 	}
+	return properties
 }
 
 // Find a property by name.
@@ -303,7 +421,7 @@ func (thing *Thing) RemoveProperty(property Property) {
 // @param propertyName Name of the property to find
 // @return Property if found, else null.
 func (thing *Thing) findProperty(propertyName string) (*Property, bool) {
-	if p, ok := thing.properties[propertyName]; ok {
+	if p, ok := thing.FindProperty(propertyName); ok {
 		return p, true
 	}
 	return &Property{}, false
@@ -326,8 +444,8 @@ func (thing *Thing) Property(propertyName string) *Value {
 // @return JSON object of propertyName -&gt; value.
 func (thing *Thing) Properties() map[string]interface{} {
 	properties := make(map[string]interface{})
-	for name, property := range thing.properties {
-		properties[name] = property.Value().Get()
+	for _, property := range thing.propertyList() {
+		properties[property.Name()] = property.Value().Get()
 	}
 	return properties
 }
@@ -337,10 +455,8 @@ func (thing *Thing) Properties() map[string]interface{} {
 // @param propertyName The property to look for
 // @return Indication of property presence.
 func (thing *Thing) HasProperty(propertyName string) bool {
-	if _, ok := thing.properties[propertyName]; ok {
-		return true
-	}
-	return false
+	_, ok := thing.FindProperty(propertyName)
+	return ok
 }
 
 // SetProperty Set a property value.
@@ -350,11 +466,34 @@ func (thing *Thing) HasProperty(propertyName string) bool {
 // @param <T>          Type of the property value
 // @throws PropertyError If value could not be set.
 func (thing *Thing) SetProperty(propertyName string, value *Value) error {
-	if _, ok := thing.findProperty(propertyName); !ok {
+	return thing.SetPropertyContext(context.Background(), propertyName, value)
+}
+
+// SetPropertyContext Set a property value as part of the operation of the
+// given context, tracing the value forwarders.
+//
+// @param ctx          Context of the operation
+// @param propertyName Name of the property to set
+// @param value        Value to set
+func (thing *Thing) SetPropertyContext(ctx context.Context, propertyName string, value *Value) error {
+	ctx, span := thing.tracer().Start(ctx, "SetProperty "+propertyName,
+		trace.WithAttributes(
+			attribute.String("webthing.thing.id", thing.ID()),
+			attribute.String("webthing.property", propertyName),
+		))
+	defer span.End()
+
+	property, ok := thing.findProperty(propertyName)
+	if !ok {
+		span.SetStatus(codes.Error, "property not found")
 		return errors.New(`"General property error"`)
 	}
-	property := thing.properties[propertyName]
-	return property.SetValue(value)
+	if err := property.setValue(ctx, value.Get()); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
 }
 
 // Action Get an action.
@@ -363,6 +502,9 @@ func (thing *Thing) SetProperty(propertyName string, value *Value) error {
 // @param actionId   ID of the action
 // @return The requested action if found, else null.
 func (thing *Thing) Action(actionName, actionID string) (action *Action) {
+	thing.historyMu.RLock()
+	defer thing.historyMu.RUnlock()
+
 	if _, ok := thing.actions[actionName]; !ok {
 		return nil
 	}
@@ -380,8 +522,42 @@ func (thing *Thing) Action(actionName, actionID string) (action *Action) {
 //
 // @param event The event that occurred.
 func (thing *Thing) AddEvent(event *Event) {
-	thing.events = append(thing.events, event)
+	thing.AddEventContext(context.Background(), event)
+}
+
+// AddEventContext Add a new event emitted by the operation of the given
+// context. The event is traced in a span linked to that operation.
+//
+// @param ctx   Context of the operation
+// @param event The event that occurred.
+func (thing *Thing) AddEventContext(ctx context.Context, event *Event) {
+	if span := thing.startLinkedSpan(ctx, "Event "+event.Name(),
+		attribute.String("webthing.event", event.Name())); span != nil {
+		event.ctx = trace.ContextWithSpan(context.Background(), span)
+		defer span.End()
+	}
+
+	thing.historyMu.Lock()
+	thing.events = latestEvents(append(thing.events, event))
+	thing.historyMu.Unlock()
+
 	thing.EventNotify(event)
+	thing.persist()
+
+	thing.hooksMu.RLock()
+	hooks := thing.hooks.event
+	thing.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(event)
+	}
+}
+
+// latestEvents Keep the last maxEvents events.
+func latestEvents(events []*Event) []*Event {
+	if len(events) > maxEvents {
+		return events[len(events)-maxEvents:]
+	}
+	return events
 }
 
 // AddAvailableEvent Add an available event.
@@ -399,34 +575,46 @@ func (thing *Thing) AddAvailableEvent(name string, metadata json.RawMessage) {
 // @param input      Any action inputs
 // @return The action that was created.
 func (thing *Thing) PerformAction(actionName string, input *json.RawMessage) (*Action, error) {
+	return thing.PerformActionContext(context.Background(), actionName, input)
+}
+
+// PerformActionContext Perform an action on the thing as part of the
+// operation of the given context. The span of the context is passed on to
+// the action, see Action.Context, but not its cancellation and values: the
+// action outlives the request it was created by. The action is tracked as
+// running until it finishes, so it must be started.
+//
+// @param ctx        Context of the operation
+// @param actionName Name of the action
+// @param input      Any action inputs
+// @return The action that was created.
+func (thing *Thing) PerformActionContext(ctx context.Context, actionName string, input *json.RawMessage) (*Action, error) {
 	if _, ok := thing.availableActions[actionName]; !ok {
-		fmt.Print("Not found action: ", actionName)
 		return nil, errors.New("Not found action: " + actionName)
 	}
 
 	actionType := thing.availableActions[actionName]
 
-	schemaLoader := gojsonschema.NewGoLoader(actionType.schema)
-	documentLoader := gojsonschema.NewGoLoader(input)
-	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
+	if actionType.schema != nil {
+		schemaLoader := gojsonschema.NewGoLoader(actionType.schema)
+		documentLoader := gojsonschema.NewGoLoader(input)
+		result, err := gojsonschema.Validate(schemaLoader, documentLoader)
 
-	if err != nil {
-		str1, _ := schemaLoader.LoadJSON()
-		fmt.Println(str1)
-		str2, _ := documentLoader.LoadJSON()
-		fmt.Println(str2)
-		fmt.Println(err)
-		return nil, err
-	}
-	// if result.Valid() {
-	// 	fmt.Printf("The document is valid\n")
-	// }
-	if !result.Valid() {
-		fmt.Printf("The document is not valid. see errors :\n")
-		for _, desc := range result.Errors() {
-			fmt.Printf("- %s\n", desc)
+		if err != nil {
+			thing.log("action", actionName).Error("Validate action input failure", "error", err)
+			return nil, err
+		}
+		// if result.Valid() {
+		// 	fmt.Printf("The document is valid\n")
+		// }
+		if !result.Valid() {
+			var errs []string
+			for _, desc := range result.Errors() {
+				errs = append(errs, desc.String())
+			}
+			thing.log("action", actionName).Debug("Invalid action input", "errors", errs)
+			return nil, errors.New("Invalid action input: " + actionName)
 		}
-		return nil, err
 	}
 	// if !actionType.ValidateActionInput(input) {
 	// 	return nil
@@ -438,9 +626,13 @@ func (thing *Thing) PerformAction(actionName string, input *json.RawMessage) (*A
 	action := cls.Generator(thing)
 	action.SetInput(input)
 	action.SetHrefPrefix(thing.hrefPrefix)
+	action.ctx = trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	thing.actionStarted(action)
 
 	thing.ActionNotify(action)
+	thing.historyMu.Lock()
 	thing.actions[actionName] = append(thing.actions[actionName], action)
+	thing.historyMu.Unlock()
 
 	return action, nil
 }
@@ -452,18 +644,21 @@ func (thing *Thing) PerformAction(actionName string, input *json.RawMessage) (*A
 // @return Boolean indicating the presence of the action.
 func (thing *Thing) RemoveAction(actionName, actionID string) bool {
 	action := thing.Action(actionName, actionID)
-	if action.ID() == "" {
+	if action == nil || action.ID() == "" {
 		return false
 	}
 
-	defer action.Cancel() // Cancel action after delete from origin.
+	defer action.cancel() // Cancel action after delete from origin.
 
+	thing.historyMu.Lock()
 	actions := thing.actions[actionName]
 	for k, ac := range actions {
 		if ac != nil && ac.ID() == actionID {
 			actions[k] = nil
 		}
 	}
+	thing.historyMu.Unlock()
+	thing.persist()
 
 	return true
 }
@@ -483,6 +678,8 @@ func (thing *Thing) AddAvailableAction(name string, metadata json.RawMessage, ac
 //
 // @param ws The websocket
 func (thing *Thing) AddSubscriber(wsID string, ws *websocket.Conn) {
+	thing.subscribersMu.Lock()
+	defer thing.subscribersMu.Unlock()
 	thing.subscribers[wsID] = ws
 }
 
@@ -490,8 +687,9 @@ func (thing *Thing) AddSubscriber(wsID string, ws *websocket.Conn) {
 //
 // @param ws The websocket
 func (thing *Thing) RemoveSubscriber(name string, ws *websocket.Conn) {
-
+	thing.subscribersMu.Lock()
 	delete(thing.subscribers, name)
+	thing.subscribersMu.Unlock()
 
 	for name := range thing.availableEvents {
 		thing.RemoveEventSubscriber(name, ws)
@@ -502,69 +700,174 @@ func (thing *Thing) RemoveSubscriber(name string, ws *websocket.Conn) {
 //
 // @param name Name of the event
 // @param ws   The websocket
-func (thing *Thing) AddEventSubscriber() {}
+func (thing *Thing) AddEventSubscriber(name, wsID string, ws *websocket.Conn) error {
+	event, ok := thing.availableEvents[name]
+	if !ok {
+		return errors.New("Event not found. ")
+	}
+	thing.subscribersMu.Lock()
+	defer thing.subscribersMu.Unlock()
+	event.subscribers[wsID] = ws
+	return nil
+}
 
 // RemoveEventSubscriber Remove a websocket subscriber from an event.
 //
 // @param name Name of the event
 // @param ws   The websocket
 func (thing *Thing) RemoveEventSubscriber(name string, ws *websocket.Conn) error {
-
-	delete(thing.availableEvents, name)
-
-	if _, ok := thing.availableEvents[name]; ok {
-		for _, eventWS := range thing.availableEvents[name].subscribers {
-			if err := eventWS.Close(); err != nil {
-				return err
-			}
+	event, ok := thing.availableEvents[name]
+	if !ok {
+		return errors.New("Event not found. ")
+	}
+	thing.subscribersMu.Lock()
+	defer thing.subscribersMu.Unlock()
+	for id, eventWS := range event.subscribers {
+		if eventWS == ws {
+			delete(event.subscribers, id)
 		}
 	}
 	return nil
 }
 
+// SubscriberCount Get the number of websocket subscribers.
+func (thing *Thing) SubscriberCount() int {
+	thing.subscribersMu.Lock()
+	defer thing.subscribersMu.Unlock()
+	return len(thing.subscribers)
+}
+
+// OnPropertyChange Call a function whenever a property value changes,
+// regardless of the notification policy of the property.
+//
+// @param hook Function called with the changed property
+func (thing *Thing) OnPropertyChange(hook func(property *Property)) {
+	thing.hooksMu.Lock()
+	defer thing.hooksMu.Unlock()
+	thing.hooks.property = append(thing.hooks.property, hook)
+}
+
+// OnActionStatus Call a function whenever the status of an action changes.
+//
+// @param hook Function called with the action
+func (thing *Thing) OnActionStatus(hook func(action *Action)) {
+	thing.hooksMu.Lock()
+	defer thing.hooksMu.Unlock()
+	thing.hooks.action = append(thing.hooks.action, hook)
+}
+
+// OnEvent Call a function whenever an event is added.
+//
+// @param hook Function called with the event
+func (thing *Thing) OnEvent(hook func(event *Event)) {
+	thing.hooksMu.Lock()
+	defer thing.hooksMu.Unlock()
+	thing.hooks.event = append(thing.hooks.event, hook)
+}
+
+// propertyChanged Notify subscribers and hooks of a property change.
+func (thing *Thing) propertyChanged(ctx context.Context, property *Property) {
+	property.record()
+	if property.notifier != nil {
+		property.notifier.changed(ctx)
+	} else {
+		thing.notifyProperty(ctx, property)
+	}
+	if property.Persistent() {
+		thing.persist()
+	}
+
+	thing.hooksMu.RLock()
+	hooks := thing.hooks.property
+	thing.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(property)
+	}
+}
+
+// notifyProperty Notify subscribers and notification hooks of the value of
+// a property.
+func (thing *Thing) notifyProperty(ctx context.Context, property *Property) {
+	thing.propertyNotify(ctx, *property)
+
+	thing.hooksMu.RLock()
+	hooks := thing.hooks.notify
+	thing.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(property)
+	}
+}
+
 type message struct {
 	MessageType string          `json:"messageType"`
 	Data        json.RawMessage `json:"data"`
 }
 
+// notify Write a message to the given websockets.
+func (thing *Thing) notify(subscribers map[string]*websocket.Conn, messageType string, data json.RawMessage) error {
+	msg, err := json.Marshal(message{
+		MessageType: messageType,
+		Data:        data,
+	})
+	if err != nil {
+		return err
+	}
+
+	thing.subscribersMu.Lock()
+	defer thing.subscribersMu.Unlock()
+	for _, sub := range subscribers {
+		if e := writeMessage(sub, msg); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // PropertyNotify Notify all subscribers of a property change.
 //
 // @param property The property that changed
 func (thing *Thing) PropertyNotify(property Property) error {
-	str := message{
-		MessageType: "propertyStatus",
-		Data:        property.AsPropertyDescription(),
+	return thing.propertyNotify(context.Background(), property)
+}
+
+// propertyNotify Notify all subscribers of a property change caused by the
+// operation of ctx.
+func (thing *Thing) propertyNotify(ctx context.Context, property Property) error {
+	if span := thing.startLinkedSpan(ctx, "Notify propertyStatus",
+		attribute.String("webthing.property", property.Name())); span != nil {
+		defer span.End()
 	}
-	msg, err := json.Marshal(str)
+
+	data, err := json.Marshal(map[string]interface{}{
+		property.Name(): property.Value().Get(),
+	})
 	if err != nil {
 		return err
 	}
-	for _, sub := range thing.subscribers {
-		if err := sub.WriteJSON(msg); err != nil {
-			return err
-		}
-	}
-	return nil
+	return thing.notify(thing.subscribers, "propertyStatus", data)
 }
 
 // ActionNotify Notify all subscribers of an action status change.
 //
 // @param action The action whose status changed
 func (thing *Thing) ActionNotify(action *Action) error {
-	str := message{
-		MessageType: "actionStatus",
-		Data:        action.AsActionDescription(),
-	}
-	msg, err := json.Marshal(str)
-	if err != nil {
-		return err
+	thing.persist()
+
+	thing.hooksMu.RLock()
+	hooks := thing.hooks.action
+	thing.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(action)
 	}
-	for _, sub := range thing.subscribers {
-		if err := sub.WriteJSON(msg); err != nil {
-			return err
-		}
+
+	if span := thing.startLinkedSpan(action.Context(), "Notify actionStatus",
+		attribute.String("webthing.action", action.Name()),
+		attribute.String("webthing.action.id", action.ID()),
+		attribute.String("webthing.action.status", action.Status())); span != nil {
+		defer span.End()
 	}
-	return nil
+
+	return thing.notify(thing.subscribers, "actionStatus", action.AsActionDescription())
 }
 
 // EventNotify Notify all subscribers of an event.
@@ -575,20 +878,13 @@ func (thing *Thing) EventNotify(event *Event) error {
 	if _, ok := thing.availableEvents[eventName]; !ok {
 		return errors.New("Event not found. ")
 	}
-	str := message{
-		MessageType: "event",
-		Data:        event.AsEventDescription(),
-	}
-	msg, err := json.Marshal(str)
-	if err != nil {
-		return err
-	}
-	for _, sub := range thing.subscribers {
-		if err := sub.WriteJSON(msg); err != nil {
-			return err
+	if event.ctx != nil {
+		if span := thing.startLinkedSpan(event.ctx, "Notify event",
+			attribute.String("webthing.event", eventName)); span != nil {
+			defer span.End()
 		}
 	}
-	return nil
+	return thing.notify(thing.availableEvents[eventName].subscribers, "event", event.AsEventDescription())
 }
 
 // AvailableEvent Class to describe an event available for subscription.
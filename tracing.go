@@ -0,0 +1,92 @@
+package webthing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dravenk/webthing-go/internal/httpapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName Name of the tracer of this package.
+const instrumentationName = "github.com/dravenk/webthing-go"
+
+// SetTracerProvider Trace the actions, property writes and notifications
+// of this thing. Nothing is traced unless a provider is set here or on the
+// server.
+//
+// @param provider The OpenTelemetry tracer provider
+func (thing *Thing) SetTracerProvider(provider trace.TracerProvider) {
+	thing.tracerProvider = provider
+}
+
+// tracer Get the tracer of this thing.
+func (thing *Thing) tracer() trace.Tracer {
+	if thing == nil || thing.tracerProvider == nil {
+		return trace.NewNoopTracerProvider().Tracer(instrumentationName)
+	}
+	return thing.tracerProvider.Tracer(instrumentationName)
+}
+
+// SetTracerProvider Trace the requests of this server. Things without a
+// tracer provider of their own use it as well.
+//
+// The trace context of requests is extracted with the global propagator,
+// see otel.SetTextMapPropagator.
+//
+// @param provider The OpenTelemetry tracer provider
+func (server *ThingServer) SetTracerProvider(provider trace.TracerProvider) {
+	server.tracerProvider = provider
+	for _, thing := range server.Things {
+		if thing.tracerProvider == nil {
+			thing.SetTracerProvider(provider)
+		}
+	}
+}
+
+// traceRequest Serve a request in a span of the given route.
+func (server *ThingServer) traceRequest(route string, handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	if server.tracerProvider == nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := server.tracerProvider.Tracer(instrumentationName).Start(ctx, r.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("http.target", r.URL.Path),
+			attribute.String("webthing.request_id", RequestID(r)),
+		))
+	defer span.End()
+
+	rec := httpapi.NewStatusRecorder(w)
+	handler.ServeHTTP(rec, r.WithContext(ctx))
+
+	span.SetAttributes(attribute.Int("http.status_code", rec.Code))
+	if rec.Code >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, strconv.Itoa(rec.Code))
+	}
+}
+
+// startLinkedSpan Start a span in a new trace, linked to the span of ctx.
+// It returns nil if ctx carries no span, so untraced changes do not start
+// traces of their own.
+func (thing *Thing) startLinkedSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+	origin := trace.SpanContextFromContext(ctx)
+	if !origin.IsValid() {
+		return nil
+	}
+	_, span := thing.tracer().Start(context.Background(), name,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: origin}),
+		trace.WithAttributes(append(attrs, attribute.String("webthing.thing.id", thing.ID()))...))
+	return span
+}
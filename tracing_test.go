@@ -0,0 +1,67 @@
+package webthing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// contextAction Record the context an action is performed in.
+type contextAction struct {
+	*Action
+	err chan error
+}
+
+func (a *contextAction) Generator(thing *Thing) *Action {
+	action := &contextAction{err: a.err}
+	action.Action = NewAction(uuid.New().String(), thing, "wait", nil, action.PerformAction, action.Cancel)
+	return action.Action
+}
+
+func (a *contextAction) PerformAction() *Action {
+	a.err <- a.Context().Err()
+	return a.Action
+}
+
+func (a *contextAction) Cancel() {}
+
+func TestActionContextOutlivesRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	thing := NewThing("urn:dev:ops:tracing", "Tracing", nil, "")
+	thing.SetTracerProvider(provider)
+	errs := make(chan error, 1)
+	thing.AddAvailableAction("wait", nil, &contextAction{err: errs})
+
+	// The request creating the action ends before the action is performed.
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, request := provider.Tracer("test").Start(ctx, "POST /actions")
+	action, err := thing.PerformActionContext(ctx, "wait", nil)
+	if err != nil {
+		t.Fatalf("PerformActionContext: %v", err)
+	}
+	request.End()
+	cancel()
+
+	action.Start()
+	if err := <-errs; err != nil {
+		t.Fatalf("Expected the action context to outlive the request, got %v", err)
+	}
+
+	var performed sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "PerformAction wait" {
+			performed = span
+		}
+	}
+	if performed == nil {
+		t.Fatal("Missing span of the action")
+	}
+	if performed.Parent().SpanID() != request.SpanContext().SpanID() ||
+		performed.SpanContext().TraceID() != request.SpanContext().TraceID() {
+		t.Fatal("Expected the action span to be a child of the request span")
+	}
+}
@@ -0,0 +1,217 @@
+package webthing
+
+import (
+	"encoding/json"
+)
+
+// TypedValue A property value of type T.
+//
+// JSON values written to the property, e.g. by a PUT request, are decoded
+// into T, and values that cannot be decoded are rejected. The untyped Value
+// it embeds, e.g. as returned by Thing.Property, is the same value.
+type TypedValue[T any] struct {
+	*Value
+}
+
+// NewTypedValue Initialize the object.
+//
+// @param {*} initialValue The initial value
+// @param {function?} valueForwarder Methods that update the actual value on
+// the thing
+func NewTypedValue[T any](initialValue T, valueForwarder ...func(T)) TypedValue[T] {
+	forwarders := make([]func(interface{}), len(valueForwarder))
+	for i, forwarder := range valueForwarder {
+		forwarder := forwarder
+		forwarders[i] = func(v interface{}) {
+			t, _ := v.(T)
+			forwarder(t)
+		}
+	}
+	value := NewValue(initialValue, forwarders...)
+	value.convert = func(v interface{}) (interface{}, error) {
+		return convertTo[T](nil, v)
+	}
+	return TypedValue[T]{&value}
+}
+
+// Get Return the last known value from the underlying thing.
+//
+// @returns the value, the zero value if it is not a T.
+func (v TypedValue[T]) Get() T {
+	t, _ := convertTo[T](nil, v.Value.Get())
+	return t
+}
+
+// Set a new value for this thing.
+//
+// @param {*} value Value to set
+func (v TypedValue[T]) Set(value T) {
+	v.Value.Set(value)
+}
+
+// NotifyOfExternalUpdate Notify observers of a new value.
+//
+// @param {*} value New value
+func (v TypedValue[T]) NotifyOfExternalUpdate(value T) {
+	v.Value.NotifyOfExternalUpdate(value)
+}
+
+// OnUpdate Register an observer that is called whenever the value changes.
+//
+// @param {function} observer The method that is called with the new value
+func (v TypedValue[T]) OnUpdate(observer func(T)) {
+	v.Value.OnUpdate(func(i interface{}) {
+		t, _ := convertTo[T](nil, i)
+		observer(t)
+	})
+}
+
+// TypedProperty A property with a value of type T.
+type TypedProperty[T any] struct {
+	*Property
+}
+
+// NewTypedProperty Initialize the object. JSON numbers are decoded as
+// integers where the metadata declares an integer, also within objects and
+// arrays, e.g. when T is an interface or a map.
+//
+// @param {Object} thing Thing this property belongs to
+// @param {String} name Name of the property
+// @param {TypedValue} value Value object to hold the property value
+// @param {Object} metadata Property metadata, i.e. type, description, unit,
+// etc., as an object.
+func NewTypedProperty[T any](thing *Thing, name string, value TypedValue[T], metadata json.RawMessage) *TypedProperty[T] {
+	property := newProperty(thing, name, value.Value, metadata)
+	schema := schemaOf(metadata)
+	value.convert = func(v interface{}) (interface{}, error) {
+		return convertTo[T](schema, v)
+	}
+	return &TypedProperty[T]{property}
+}
+
+// PropertyOf Get a typed view of a property of a thing.
+//
+// @param thing The thing
+// @param name  Name of the property
+// @return The property and whether it was found.
+func PropertyOf[T any](thing *Thing, name string) (*TypedProperty[T], bool) {
+	property, ok := thing.FindProperty(name)
+	if !ok {
+		return nil, false
+	}
+	return &TypedProperty[T]{property}, true
+}
+
+// Get Get the current property value.
+//
+// @returns The value, the zero value if it is not a T.
+func (property *TypedProperty[T]) Get() T {
+	t, _ := convertTo[T](schemaOf(property.metadata), property.value.Get())
+	return t
+}
+
+// Set Set a new value, calling the value forwarders.
+//
+// @param value The value to set
+func (property *TypedProperty[T]) Set(value T) {
+	property.value.Set(value)
+}
+
+// NotifyOfExternalUpdate Notify observers of a new value reported by the
+// underlying thing.
+//
+// @param value New value
+func (property *TypedProperty[T]) NotifyOfExternalUpdate(value T) {
+	property.value.NotifyOfExternalUpdate(value)
+}
+
+// OnUpdate Register an observer that is called whenever the value changes.
+//
+// @param observer The method that is called with the new value
+func (property *TypedProperty[T]) OnUpdate(observer func(T)) {
+	TypedValue[T]{property.value}.OnUpdate(observer)
+}
+
+// InputOf Decode the input of an action into T. JSON numbers are decoded as
+// integers where the input schema of the action declares an integer.
+//
+// @param action The action
+// @return The input, the zero value if there is none.
+func InputOf[T any](action *Action) (T, error) {
+	var t T
+	input := action.Input()
+	if input == nil || len(*input) == 0 {
+		return t, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(*input, &v); err != nil {
+		return t, err
+	}
+	var schema map[string]interface{}
+	if available, ok := action.Thing().availableActions[action.Name()]; ok {
+		if raw, ok := available.schema.(json.RawMessage); ok {
+			schema = schemaOf(raw)
+		}
+	}
+	return convertTo[T](schema, v)
+}
+
+// convertTo Convert a value to T, through JSON if it is not a T.
+func convertTo[T any](schema map[string]interface{}, v interface{}) (T, error) {
+	v = coerce(schema, v)
+	if t, ok := v.(T); ok {
+		return t, nil
+	}
+	var t T
+	content, err := json.Marshal(v)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(content, &t)
+	return t, err
+}
+
+// coerce Convert the JSON numbers of a value to integers where the schema
+// declares an integer.
+func coerce(schema map[string]interface{}, v interface{}) interface{} {
+	if schema == nil {
+		return v
+	}
+	switch v := v.(type) {
+	case float64:
+		if schema["type"] == "integer" && v == float64(int(v)) {
+			return int(v)
+		}
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if properties == nil {
+			return v
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, member := range v {
+			memberSchema, _ := properties[key].(map[string]interface{})
+			result[key] = coerce(memberSchema, member)
+		}
+		return result
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		if items == nil {
+			return v
+		}
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = coerce(items, item)
+		}
+		return result
+	}
+	return v
+}
+
+// schemaOf Decode the data schema in metadata, nil if it is invalid.
+func schemaOf(metadata json.RawMessage) map[string]interface{} {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(metadata, &schema); err != nil {
+		return nil
+	}
+	return schema
+}
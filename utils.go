@@ -15,6 +15,40 @@ func Timestamp() string {
 	return now + "+00:00"
 }
 
+// Number Convert a numeric value, e.g. a property value, to float64.
+//
+// @param v The value
+// @return The number and whether v is numeric.
+func Number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
 func trimSlash(path string) string {
 	l := len(path)
 	if l != 1 && path[l-1:] == "/" {
@@ -1,5 +1,11 @@
 package webthing
 
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
 // Value A property value.
 //
 // This is used for communicating between the Thing representation and the
@@ -9,8 +15,22 @@ package webthing
 // update (command to turn the light off) or if the underlying sensor reports a
 // new value.
 type Value struct {
+	// mu Guards the last value and the observers. Copies of a value share
+	// it.
+	mu *sync.RWMutex
+
 	lastValue      interface{}
 	valueForwarder []func(interface{})
+	observers      []func(interface{})
+
+	// contextObservers Observers also receiving the context of the change.
+	contextObservers []func(context.Context, interface{})
+
+	// convert Converts new values to the type of a TypedValue.
+	convert func(interface{}) (interface{}, error)
+
+	// log Gets the logger of the property holding the value, if any.
+	log func() Logger
 }
 
 // NewValue Initialize the object.
@@ -19,13 +39,31 @@ type Value struct {
 // @param {function?} valueForwarder The method that updates the actual value
 //                                   on the thing
 func NewValue(initialValue interface{}, valueForwarder ...func(interface{})) Value {
-	return Value{initialValue, valueForwarder}
+	return Value{mu: &sync.RWMutex{}, lastValue: initialValue, valueForwarder: valueForwarder}
+}
+
+// zeroValueMu Guards values not created by NewValue.
+var zeroValueMu sync.RWMutex
+
+func (v *Value) mutex() *sync.RWMutex {
+	if v.mu == nil {
+		return &zeroValueMu
+	}
+	return v.mu
 }
 
 // Set a new value for this thing.
 //
 // @param {*} value Value to set
 func (v *Value) Set(value interface{}) {
+	if v.convert != nil && value != nil {
+		converted, err := v.convert(value)
+		if err != nil {
+			v.logger().Debug("Invalid property value", "error", err)
+			return
+		}
+		value = converted
+	}
 	if v.valueForwarder != nil {
 		for _, valueForwarder := range v.valueForwarder {
 			valueForwarder(value)
@@ -39,6 +77,9 @@ func (v *Value) Set(value interface{}) {
 //
 // @returns the value.
 func (v *Value) Get() interface{} {
+	mu := v.mutex()
+	mu.RLock()
+	defer mu.RUnlock()
 	return v.lastValue
 }
 
@@ -46,8 +87,67 @@ func (v *Value) Get() interface{} {
 //
 // @param {*} value New value
 func (v *Value) NotifyOfExternalUpdate(value interface{}) {
-	if value != nil && value != v.lastValue {
-		v.lastValue = value
-		//v.emit('update', value);
+	v.NotifyOfExternalUpdateContext(context.Background(), value)
+}
+
+// NotifyOfExternalUpdateContext Notify observers of a new value caused by
+// the operation of the given context, e.g. a traced action.
+//
+// @param {Context} ctx Context of the change
+// @param {*} value New value
+func (v *Value) NotifyOfExternalUpdateContext(ctx context.Context, value interface{}) {
+	if v.convert != nil && value != nil {
+		converted, err := v.convert(value)
+		if err != nil {
+			v.logger().Debug("Invalid property value", "error", err)
+			return
+		}
+		value = converted
+	}
+	mu := v.mutex()
+	mu.Lock()
+	if value == nil || reflect.DeepEqual(value, v.lastValue) {
+		mu.Unlock()
+		return
+	}
+	v.lastValue = value
+	observers := v.observers
+	contextObservers := v.contextObservers
+	mu.Unlock()
+
+	// The observers are called without the lock, they may read the value.
+	for _, observer := range observers {
+		observer(value)
+	}
+	for _, observer := range contextObservers {
+		observer(ctx, value)
+	}
+}
+
+// OnUpdate Register an observer that is called whenever the value changes.
+//
+// @param {function} observer The method that is called with the new value
+func (v *Value) OnUpdate(observer func(interface{})) {
+	mu := v.mutex()
+	mu.Lock()
+	defer mu.Unlock()
+	v.observers = append(v.observers, observer)
+}
+
+// onUpdateContext Register an observer that is called with the context of
+// the change whenever the value changes.
+func (v *Value) onUpdateContext(observer func(context.Context, interface{})) {
+	mu := v.mutex()
+	mu.Lock()
+	defer mu.Unlock()
+	v.contextObservers = append(v.contextObservers, observer)
+}
+
+// logger Get the logger of the property holding the value, or a logger
+// discarding all messages.
+func (v *Value) logger() Logger {
+	if v.log == nil {
+		return nopLogger{}
 	}
+	return v.log()
 }
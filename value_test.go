@@ -0,0 +1,52 @@
+package webthing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordLogger A Logger recording the messages.
+type recordLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordLogger) record(level, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf("%s %s %v", level, msg, args))
+}
+
+func (l *recordLogger) Debug(msg string, args ...interface{}) { l.record("DEBUG", msg, args...) }
+func (l *recordLogger) Info(msg string, args ...interface{})  { l.record("INFO", msg, args...) }
+func (l *recordLogger) Warn(msg string, args ...interface{})  { l.record("WARN", msg, args...) }
+func (l *recordLogger) Error(msg string, args ...interface{}) { l.record("ERROR", msg, args...) }
+
+func TestValueLogsInvalidValues(t *testing.T) {
+	thing := NewThing("urn:dev:ops:value", "Value", nil, "")
+	logger := &recordLogger{}
+	thing.SetLogger(logger)
+	property := NewTypedProperty(thing, "level", NewTypedValue(1), json.RawMessage(`{"type": "integer"}`))
+	thing.AddProperty(property.Property)
+
+	property.value.Set("high")
+	property.value.NotifyOfExternalUpdate([]int{1})
+	if level := property.Get(); level != 1 {
+		t.Fatalf("Expected the invalid values to be dropped, got %v", level)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if len(logger.messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %q", logger.messages)
+	}
+	for _, message := range logger.messages {
+		want := "DEBUG Invalid property value [thing urn:dev:ops:value property level error"
+		if !strings.HasPrefix(message, want) {
+			t.Fatalf("Unexpected message %q", message)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package webthing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{SubprotocolCBOR, SubprotocolMessagePack, SubprotocolJSON},
+}
+
+// WebSocketThingHandle Handle a websocket connection to a thing.
+type WebSocketThingHandle struct {
+	*ThingHandle
+	id string
+	ws *websocket.Conn
+}
+
+// Handle Upgrade the request and serve the websocket until it is closed.
+func (h *WebSocketThingHandle) Handle(w http.ResponseWriter, r *http.Request) {
+	u := upgrader
+	if server, ok := r.Context().Value(serverKey{}).(*ThingServer); ok {
+		u.CheckOrigin = server.CheckOrigin
+	}
+	ws, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		h.Thing.requestLog(r).Debug("Websocket upgrade failure", "error", err)
+		return
+	}
+	h.id = uuid.New().String()
+	h.ws = ws
+
+	h.Thing.AddSubscriber(h.id, ws)
+	defer func() {
+		h.Thing.RemoveSubscriber(h.id, ws)
+		ws.Close()
+	}()
+
+	for {
+		msg, err := readMessage(ws)
+		if err != nil {
+			return
+		}
+		h.onMessage(r.Context(), msg)
+	}
+}
+
+// onMessage Handle an incoming message.
+//
+// @param {Context} ctx Context of the websocket connection
+// @param {String} msg Message to handle
+func (h *WebSocketThingHandle) onMessage(ctx context.Context, msg []byte) {
+	var m struct {
+		MessageType string                     `json:"messageType"`
+		Data        map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(msg, &m); err != nil || m.MessageType == "" || m.Data == nil {
+		h.sendError("400 Bad Request", "Invalid message", nil)
+		return
+	}
+
+	ctx, span := h.Thing.tracer().Start(ctx, "WebSocket "+m.MessageType,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("webthing.thing.id", h.Thing.ID()),
+			attribute.String("webthing.websocket.id", h.id),
+		))
+	defer span.End()
+
+	switch m.MessageType {
+	case "setProperty":
+		for name, raw := range m.Data {
+			var v interface{}
+			json.Unmarshal(raw, &v)
+			value := NewValue(v)
+			if err := h.Thing.SetPropertyContext(ctx, name, &value); err != nil {
+				h.sendError("400 Bad Request", err.Error(), msg)
+			}
+		}
+	case "requestAction":
+		for name, raw := range m.Data {
+			var params map[string]*json.RawMessage
+			json.Unmarshal(raw, &params)
+			action, err := h.Thing.PerformActionContext(ctx, name, params["input"])
+			if action == nil || err != nil {
+				h.sendError("400 Bad Request", "Invalid action request", msg)
+				continue
+			}
+			// Perform an Action in a goroutine.
+			go action.Start()
+		}
+	case "addEventSubscription":
+		for name := range m.Data {
+			h.Thing.AddEventSubscriber(name, h.id, h.ws)
+		}
+	default:
+		h.sendError("400 Bad Request", "Unknown messageType: "+m.MessageType, msg)
+	}
+}
+
+// sendError Send an error message to the websocket.
+func (h *WebSocketThingHandle) sendError(status, message string, request json.RawMessage) {
+	data := map[string]interface{}{
+		"status":  status,
+		"message": message,
+	}
+	if request != nil {
+		data["request"] = request
+	}
+	content, _ := json.Marshal(map[string]interface{}{
+		"messageType": "error",
+		"data":        data,
+	})
+
+	h.Thing.subscribersMu.Lock()
+	defer h.Thing.subscribersMu.Unlock()
+	if err := writeMessage(h.ws, content); err != nil {
+		h.Thing.log("websocket", h.id).Error("Write websocket message failure", "error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package webthing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialOrigin Open a websocket to a thing served by server, sending origin.
+func dialOrigin(t *testing.T, server *ThingServer, origin string) (*websocket.Conn, *http.Response, error) {
+	thing := NewThing("urn:dev:ops:origin", "Origin", nil, "")
+	handle := &ThingHandle{thing}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle.Handle(w, r.WithContext(context.WithValue(r.Context(), serverKey{}, server)))
+	}))
+	t.Cleanup(s.Close)
+
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", strings.Replace(origin, "SERVER", s.URL, 1))
+	}
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), header)
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	cases := []struct {
+		name        string
+		checkOrigin func(r *http.Request) bool
+		origin      string
+		accepted    bool
+	}{
+		{"no origin", nil, "", true},
+		{"same origin", nil, "SERVER", true},
+		{"cross origin", nil, "http://evil.example.com", false},
+		{"allowed origin", func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "http://home.example.com"
+		}, "http://home.example.com", true},
+		{"denied origin", func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "http://home.example.com"
+		}, "http://evil.example.com", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ws, resp, err := dialOrigin(t, &ThingServer{CheckOrigin: c.checkOrigin}, c.origin)
+			if c.accepted {
+				if err != nil {
+					t.Fatalf("Expected the connection to be accepted: %v", err)
+				}
+				ws.Close()
+				return
+			}
+			if err == nil {
+				ws.Close()
+				t.Fatal("Expected the connection to be rejected")
+			}
+			if resp == nil || resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("Expected 403, got %v", resp)
+			}
+		})
+	}
+}